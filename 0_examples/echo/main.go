@@ -1,12 +1,11 @@
 package main
 
 import (
-	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/signal"
 	"strings"
 	"time"
 
@@ -20,6 +19,10 @@ func main() {
 		W:       os.Stdout,
 		HelpCmd: "help", // will generate the help command for us, it will be accesible under the "help" keyword.
 		QuitCmd: "quit", // will generate the quit command for us, it will be accesible under the "quit" keyword.
+		// <Ctrl-C> cancels the running command (twice quits) and SIGTERM gracefully shuts down the dialogue with a 5 second
+		// timeout.
+		HandleSignals: true,
+		ShutdownGrace: 5 * time.Second,
 	}
 
 	fs := flag.NewFlagSet("echo", flag.ContinueOnError)
@@ -49,21 +52,7 @@ func main() {
 		},
 	)
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-
-	go func() {
-		<-c
-		log.Println()
-		log.Println("gracefully shutting down dialogue with a 5 second timeout...")
-
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		d.Shutdown(ctx)
-	}()
-
-	if err := d.Open(); err != nil {
+	if err := d.Open(); !errors.Is(err, dialogue.ErrDialogueClosed) && !errors.Is(err, dialogue.ErrEOF) {
 		log.Fatal(err)
 	}
 }
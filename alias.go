@@ -0,0 +1,174 @@
+package dialogue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// aliasTable holds the aliases defined with the alias command, an alias maps a name to the command line it expands to.
+// The table is persisted in the state store under prefix, if any.
+type aliasTable struct {
+	mu     sync.Mutex
+	m      map[string]string
+	store  StateStore
+	prefix string
+}
+
+// aliasPrefix and variablePrefix prefix the keys of the aliases and of the variables set with EnvCmd in the state store.
+const (
+	aliasPrefix    = "alias/"
+	variablePrefix = "env/"
+)
+
+// load reads the table from the keys of store starting with prefix, if any, the changes are then persisted in store.
+func (t *aliasTable) load(ctx context.Context, store StateStore, prefix string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.m, t.store, t.prefix = nil, store, prefix
+	if store == nil {
+		return nil
+	}
+
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	t.m = make(map[string]string, len(keys))
+	for _, key := range keys {
+		v, ok, err := store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			t.m[strings.TrimPrefix(key, prefix)] = v
+		}
+	}
+
+	return nil
+}
+
+func (t *aliasTable) get(name string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	line, ok := t.m[name]
+	return line, ok
+}
+
+func (t *aliasTable) set(ctx context.Context, name, line string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.m == nil {
+		t.m = make(map[string]string)
+	}
+	t.m[name] = line
+
+	if t.store == nil {
+		return nil
+	}
+
+	return t.store.Set(ctx, t.prefix+name, line)
+}
+
+func (t *aliasTable) unset(ctx context.Context, name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.m, name)
+	if t.store == nil {
+		return nil
+	}
+
+	return t.store.Delete(ctx, t.prefix+name)
+}
+
+// rows returns the aliases sorted by name.
+func (t *aliasTable) rows() [][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rows := make([][]string, 0, len(t.m))
+	for name, line := range t.m {
+		rows = append(rows, []string{name, line})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+
+	return rows
+}
+
+func (t *aliasTable) reset() {
+	t.mu.Lock()
+	t.m, t.store = nil, nil
+	t.mu.Unlock()
+}
+
+type expandingKey struct{}
+
+// expandAlias dispatches the command line the alias named by the first field of line expands to, followed by the rest of
+// line. ok is false if there is no such alias or if it is already being expanded, aliases can refer to each other but not
+// recursively.
+func (d *Dialogue) expandAlias(parent context.Context, line string, fields []string) (ok bool, err error) {
+	expansion, ok := d.userAlias.get(fields[0])
+	if !ok {
+		return false, nil
+	}
+
+	expanding, _ := parent.Value(expandingKey{}).([]string)
+	for _, name := range expanding {
+		if name == fields[0] {
+			return false, nil
+		}
+	}
+	parent = context.WithValue(parent, expandingKey{}, append(expanding[:len(expanding):len(expanding)], fields[0]))
+
+	line = expansion + strings.TrimPrefix(strings.TrimLeftFunc(line, unicode.IsSpace), fields[0])
+	return true, d.dispatchHandler(parent, line, strings.Fields(line))
+}
+
+func (d *Dialogue) aliasCommand(name string) *Command {
+	return &Command{
+		Name:      name,
+		Structure: fmt.Sprintf("%v [<alias> [<command-line> | -]]", name),
+		HelpShort: "lists, shows or defines the aliases of command lines",
+		HelpLong: `alias lists the aliases when ran without arguments and shows the expansion of a single alias. "alias ll ls -l"
+makes "ll /tmp" run "ls -l /tmp", - removes the alias. Registered commands take precedence over aliases.`,
+		Exec: func(chain *CallChain, args []string) error {
+			ctx := chain.GetCurrent().Context()
+			switch {
+			case len(args) == 0:
+				return d.renderer.Table(d.userAlias.rows())
+			case len(args) == 1:
+				line, ok := d.userAlias.get(args[0])
+				if !ok {
+					return d.reportError(ctx, name, fmt.Errorf("no alias named %v", args[0]))
+				}
+
+				return d.renderer.PrintLine(line)
+			case len(args) == 2 && args[1] == "-":
+				if err := d.userAlias.unset(ctx, args[0]); err != nil {
+					return d.reportError(ctx, name, fmt.Errorf("removing alias: %w", err))
+				}
+
+				return nil
+			}
+
+			if _, ok := d.command(args[0]); ok {
+				return d.reportError(ctx, name, fmt.Errorf("%v is a command", args[0]))
+			}
+
+			if err := d.userAlias.set(ctx, args[0], strings.Join(args[1:], " ")); err != nil {
+				return d.reportError(ctx, name, fmt.Errorf("saving alias: %w", err))
+			}
+
+			return nil
+		},
+	}
+}
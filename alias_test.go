@@ -0,0 +1,39 @@
+package dialogue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestAliasCommand(t *testing.T) {
+	w := newWriteExpected(t, []byte("[long /tmp]\nll   ls long\nls2  ll\n[long x]\nCommand: loop not found\nCommand: ls2 not found\n"))
+	d := &Dialogue{W: w, AliasCmd: "alias", FormatHelp: func(string, map[string]*Command) string { return "" }}
+	d.RegisterCommands(&Command{
+		Name: "ls",
+		Exec: func(_ *CallChain, args []string) error {
+			_, err := fmt.Fprintln(w, args)
+			return err
+		},
+	})
+
+	for _, line := range []string{
+		"alias ll ls long",
+		"ll /tmp",
+		"alias ls2 ll",
+		"alias",
+		"ls2 x",
+		"alias loop loop",
+		"loop",
+		"alias ls2 -",
+		"ls2",
+	} {
+		if err := d.Execute(context.Background(), line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,294 @@
+package dialogue
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Builtin identifies a builtin command, or a group of related builtin commands, enabled by EnableBuiltins.
+type Builtin uint64
+
+const (
+	BuiltinQuit        Builtin = 1 << iota // quit, see QuitCmd.
+	BuiltinHelp                            // help, see HelpCmd.
+	BuiltinVerbosity                       // verbosity, see VerbosityCmd.
+	BuiltinTrace                           // trace, see TraceCmd.
+	BuiltinDryRun                          // dry-run, see DryRunCmd.
+	BuiltinUndo                            // undo, see UndoCmd.
+	BuiltinTransaction                     // begin, commit and abort, see BeginCmd.
+	BuiltinMacros                          // record and play, see RecordCmd.
+	BuiltinSchedules                       // every, schedules and unschedule, see EveryCmd.
+	BuiltinWatch                           // watch, see WatchCmd.
+	BuiltinShow                            // show, see ShowCmd.
+	BuiltinUse                             // use, see UseCmd.
+	BuiltinClear                           // clear, see ClearCmd.
+	BuiltinStatus                          // status, see StatusCmd.
+	BuiltinUtility                         // sleep, wait-for and repeat, see SleepCmd.
+	BuiltinHistory                         // history, see HistoryCmd.
+	BuiltinAlias                           // alias, see AliasCmd.
+	BuiltinEnv                             // env, see EnvCmd.
+
+	// BuiltinAll enables every builtin command.
+	BuiltinAll Builtin = 1<<iota - 1
+)
+
+// EnableBuiltins enables the builtin commands in b under their default names, the names are the ones listed by the Builtin
+// constants:
+//
+//	d.EnableBuiltins(dialogue.BuiltinHelp | dialogue.BuiltinQuit | dialogue.BuiltinHistory | dialogue.BuiltinClear)
+//
+// It sets the corresponding dialogue fields (QuitCmd for BuiltinQuit for example), the fields already set keep their name.
+// If the dialogue is running the call is no-op.
+func (d *Dialogue) EnableBuiltins(b Builtin) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return
+	}
+
+	for _, def := range d.builtins() {
+		if b&def.builtin != 0 && *def.field == "" {
+			*def.field = def.name
+		}
+	}
+}
+
+// builtinCommand describes a builtin command: the Builtin enabling it, the dialogue field holding its name, its default
+// name and the function building it.
+type builtinCommand struct {
+	builtin Builtin
+	field   *string
+	name    string
+	build   func(name string) *Command
+}
+
+// builtins returns the builtin commands of the dialogue, it is the single table used to enable, install and reserve them.
+func (d *Dialogue) builtins() []builtinCommand {
+	return []builtinCommand{
+		{BuiltinQuit, &d.QuitCmd, "quit", d.quitCommand},
+		{BuiltinHelp, &d.HelpCmd, "help", d.helpCommand},
+		{BuiltinVerbosity, &d.VerbosityCmd, "verbosity", d.verbosityCommand},
+		{BuiltinTrace, &d.TraceCmd, "trace", d.traceCommand},
+		{BuiltinDryRun, &d.DryRunCmd, "dry-run", d.dryRunCommand},
+		{BuiltinUndo, &d.UndoCmd, "undo", d.undoCommand},
+		{BuiltinTransaction, &d.BeginCmd, "begin", d.beginCommand},
+		{BuiltinTransaction, &d.CommitCmd, "commit", d.commitCommand},
+		{BuiltinTransaction, &d.AbortCmd, "abort", d.abortCommand},
+		{BuiltinMacros, &d.RecordCmd, "record", d.recordCommand},
+		{BuiltinMacros, &d.PlayCmd, "play", d.playCommand},
+		{BuiltinSchedules, &d.EveryCmd, "every", d.everyCommand},
+		{BuiltinSchedules, &d.SchedulesCmd, "schedules", d.schedulesCommand},
+		{BuiltinSchedules, &d.UnscheduleCmd, "unschedule", d.unscheduleCommand},
+		{BuiltinWatch, &d.WatchCmd, "watch", d.watchCommand},
+		{BuiltinShow, &d.ShowCmd, "show", d.showCommand},
+		{BuiltinUse, &d.UseCmd, "use", d.useCommand},
+		{BuiltinClear, &d.ClearCmd, "clear", d.clearCommand},
+		{BuiltinStatus, &d.StatusCmd, "status", d.statusCommand},
+		{BuiltinUtility, &d.SleepCmd, "sleep", d.sleepCommand},
+		{BuiltinUtility, &d.WaitForCmd, "wait-for", d.waitForCommand},
+		{BuiltinUtility, &d.RepeatCmd, "repeat", d.repeatCommand},
+		{BuiltinHistory, &d.HistoryCmd, "history", d.historyCommand},
+		{BuiltinAlias, &d.AliasCmd, "alias", d.aliasCommand},
+		{BuiltinEnv, &d.EnvCmd, "env", d.envCommand},
+	}
+}
+
+// installBuiltinsLocked registers the builtin commands enabled by the dialogue fields. Builtins never replace commands
+// registered under the same name and the builtins removed with UnregisterCommands arent installed again.
+func (d *Dialogue) installBuiltinsLocked() {
+	for _, def := range d.builtins() {
+		if !d.removed[*def.field] {
+			d.installBuiltinLocked(*def.field, def.build)
+		}
+	}
+}
+
+// builtinNamesLocked returns the names of the builtin commands enabled by the dialogue fields, without the unregistered ones.
+func (d *Dialogue) builtinNamesLocked() []string {
+	var names []string
+	for _, def := range d.builtins() {
+		if name := *def.field; name != "" && !d.removed[name] {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// installBuiltinLocked registers the command built by build under name if name isnt empty or already registered.
+func (d *Dialogue) installBuiltinLocked(name string, build func(name string) *Command) {
+	if _, ok := d.commands[name]; name != "" && !ok {
+		cmd := build(name)
+		if d.LocalizeBuiltin != nil {
+			d.LocalizeBuiltin(cmd)
+		}
+		cmd.immediate = true
+		d.commands[name] = cmd
+	}
+}
+
+func (d *Dialogue) quitCommand(name string) *Command {
+	return &Command{
+		Name:      name,
+		HelpShort: "quits the dialogue abruptly",
+		Exec: func(_ *CallChain, _ []string) error {
+			// no point in setting running state to false in here to prevent other calls to Shutdown or Close since in the end
+			// they all play into the same side effects: ErrDialogueClosed returned from Open(), context cancelled and running
+			// state set to false safely.
+			return ErrDialogueClosed
+		},
+	}
+}
+
+func (d *Dialogue) helpCommand(name string) *Command {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(d.eout)
+	nParam := fs.String("n", "", "specifies the command name you want help on")
+
+	return &Command{
+		Name:      name,
+		Structure: fmt.Sprintf("%v [-n <command-name>]", name),
+		HelpShort: "outputs the help prompt for all commands or a specified command via the -n flag",
+		HelpLong: `help formats a short version of help prompts for all available commands when ran without the -n flag,
+optinally you can provide the -n flag to get a more thorough help prompt for a specific command indicated by the name passed after
+the -n flag.`,
+		FlagSet: fs,
+		Exec: func(chain *CallChain, _ []string) error {
+			cmds := d.enabledCommands(chain.GetCurrent().Context())
+			name := *nParam
+			if resolved, ok := d.namespace.resolve(name, cmds); ok {
+				name = resolved
+			}
+
+			out := d.FormatHelp(name, cmds)
+			if name == "" {
+				if macros := d.formatMacros(); macros != "" {
+					out += "\n" + macros
+				}
+			} else if cmd, ok := cmds[name]; ok && len(cmd.SeeAlso) > 0 {
+				out += fmt.Sprintf("\nRun \"%v -n %v\" for the help of a referenced command.\n", d.HelpCmd, cmd.SeeAlso[0])
+			}
+
+			r := d.commandRenderer(name)
+			if cmd, _ := d.command(name); cmd == nil || cmd.Output == nil {
+				if w := d.helpWriter(); w != nil {
+					r = d.rendererTo(r, w)
+				}
+			}
+
+			return printText(r, out)
+		},
+	}
+}
+
+// Verbosity is the dialogue wide output level, commands read it via VerbosityFromContext to adjust their output.
+type Verbosity int32
+
+const (
+	VerbosityQuiet   Verbosity = -1
+	VerbosityNormal  Verbosity = 0
+	VerbosityVerbose Verbosity = 1
+)
+
+var verbosityNames = map[Verbosity]string{
+	VerbosityQuiet:   "quiet",
+	VerbosityNormal:  "normal",
+	VerbosityVerbose: "verbose",
+}
+
+func (v Verbosity) String() string {
+	if name, ok := verbosityNames[v]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Verbosity(%d)", int32(v))
+}
+
+// verbosityLevel holds the current verbosity of a dialogue, it can be changed by the verbosity command while commands read it.
+type verbosityLevel struct {
+	atomic.Int32
+}
+
+func (l *verbosityLevel) get() Verbosity {
+	return Verbosity(l.Load())
+}
+
+func (l *verbosityLevel) set(v Verbosity) {
+	l.Store(int32(v))
+}
+
+func (d *Dialogue) verbosityCommand(name string) *Command {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(d.eout)
+	verbose := fs.Bool("v", false, "sets the verbosity to verbose")
+	quiet := fs.Bool("q", false, "sets the verbosity to quiet")
+
+	return &Command{
+		Name:      name,
+		Structure: fmt.Sprintf("%v [-v | -q | quiet | normal | verbose]", name),
+		HelpShort: "shows or sets the verbosity of the dialogue",
+		HelpLong: `verbosity shows the current verbosity of the dialogue when ran without arguments, the -v and -q flags set the
+verbosity to verbose and quiet respectively, alternatively the level can be passed by name.`,
+		FlagSet:      fs,
+		ValidateArgs: func(args []string) error { return Validate(args, Range(0, 1), OneOf("quiet", "normal", "verbose")) },
+		Exec: func(_ *CallChain, args []string) error {
+			switch {
+			case *verbose && *quiet:
+				return d.renderer.PrintError(errors.New("-v and -q are mutually exclusive"))
+			case *verbose:
+				d.verbosity.set(VerbosityVerbose)
+			case *quiet:
+				d.verbosity.set(VerbosityQuiet)
+			case len(args) == 1:
+				for v, name := range verbosityNames {
+					if strings.EqualFold(args[0], name) {
+						d.verbosity.set(v)
+					}
+				}
+			default:
+				return d.renderer.PrintLine(d.verbosity.get().String())
+			}
+
+			return nil
+		},
+	}
+}
+
+func (d *Dialogue) traceCommand(name string) *Command {
+	return d.toggleCommand(name, &d.trace, "shows or toggles the trace mode of the dialogue",
+		`trace shows if the trace mode is on when ran without arguments, on and off toggle it. In trace mode the resolved
+command path, flag values and args of every command are written before it is executed.`)
+}
+
+func (d *Dialogue) dryRunCommand(name string) *Command {
+	return d.toggleCommand(name, &d.dryRun, "shows or toggles the dry-run mode of the dialogue",
+		`dry-run shows if the dry-run mode is on when ran without arguments, on and off toggle it. In dry-run mode the
+commands which support it only report what they would do, the commands which support dry-run are marked in the help output.`)
+}
+
+// toggleCommand builds a command which shows the state when ran without arguments and sets it when ran with on or off.
+func (d *Dialogue) toggleCommand(name string, state *atomic.Bool, short, long string) *Command {
+	return &Command{
+		Name:         name,
+		Structure:    fmt.Sprintf("%v [on | off]", name),
+		HelpShort:    short,
+		HelpLong:     long,
+		ValidateArgs: func(args []string) error { return Validate(args, Range(0, 1), OneOf("on", "off")) },
+		Exec: func(_ *CallChain, args []string) error {
+			if len(args) == 1 {
+				state.Store(args[0] == "on")
+				return nil
+			}
+
+			out := "off"
+			if state.Load() {
+				out = "on"
+			}
+			return d.renderer.PrintLine(out)
+		},
+	}
+}
@@ -0,0 +1,145 @@
+package dialogue
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// KeyCtrlC is the byte sent by Ctrl+C when the terminal is in raw mode, the default CancelKey.
+const KeyCtrlC byte = 0x03
+
+// keyReader reads ahead from r in its own go routine so the cancel key is seen while a command runs and nothing reads
+// the lines. The cancel keys are removed from the input and reported to onKey, the rest of the input is kept for the
+// next reads. The go routine stops after its current read once the keyReader is paused, the next Read starts it again.
+type keyReader struct {
+	r     io.Reader
+	key   byte
+	onKey func()
+
+	mu      sync.Mutex
+	cond    *sync.Cond // cond signals the changes to buf, err and reading.
+	buf     []byte
+	err     error // sticky error of r.
+	reading bool  // reading is set while the read ahead go routine runs.
+	paused  bool
+}
+
+func newKeyReader(r io.Reader, key byte, onKey func()) *keyReader {
+	k := &keyReader{r: r, key: key, onKey: onKey}
+	k.cond = sync.NewCond(&k.mu)
+	return k
+}
+
+func (k *keyReader) Read(p []byte) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.paused = false
+	for len(k.buf) == 0 && k.err == nil {
+		// start reading ahead on the first read, like the reads of the preamptive reader r isnt read before the dialogue
+		// reads a line.
+		if !k.reading {
+			k.reading = true
+			go k.readAhead()
+		}
+
+		k.cond.Wait()
+	}
+
+	if len(k.buf) == 0 {
+		return 0, k.err
+	}
+
+	n := copy(p, k.buf)
+	k.buf = k.buf[n:]
+	return n, nil
+}
+
+// pause stops reading ahead from r once the current read returns, the bytes it reads are kept for the next Read.
+func (k *keyReader) pause() {
+	k.mu.Lock()
+	k.paused = true
+	k.mu.Unlock()
+}
+
+// readAhead reads from r until it fails or the keyReader is paused.
+func (k *keyReader) readAhead() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := k.r.Read(buf)
+
+		keys := 0
+		k.mu.Lock()
+		for _, b := range buf[:n] {
+			if b == k.key {
+				keys++
+				continue
+			}
+			k.buf = append(k.buf, b)
+		}
+		if err != nil {
+			k.err = err
+		}
+		stop := err != nil || k.paused
+		if stop {
+			k.reading = false
+		}
+		k.cond.Broadcast()
+		k.mu.Unlock()
+
+		for ; keys > 0; keys-- {
+			k.onKey()
+		}
+
+		if stop {
+			return
+		}
+	}
+}
+
+// sourceLocked returns the reader the preamptive reader wraps: R decoded with Encoding, read through a keyReader if the
+// cancel key is handled. The key is matched once R is decoded so the multi byte encodings cant hide or fake it.
+func (d *Dialogue) sourceLocked() io.Reader {
+	d.pauseKeysLocked()
+	d.keys = nil
+	if d.R == nil {
+		return nil
+	}
+
+	r := d.decode(d.R)
+	if !d.HandleCancelKey {
+		return r
+	}
+
+	key := d.CancelKey
+	if key == 0 {
+		key = KeyCtrlC
+	}
+
+	d.keys = newKeyReader(r, key, d.cancelForeground)
+	return d.keys
+}
+
+// pauseKeysLocked stops reading R ahead for the cancel key, it is called once the session ends or R is dropped.
+func (d *Dialogue) pauseKeysLocked() {
+	if d.keys != nil {
+		d.keys.pause()
+	}
+}
+
+// cancelForeground cancels the context of the command dispatched from R, if any, the dialogue keeps running.
+func (d *Dialogue) cancelForeground() {
+	d.fg.mu.Lock()
+	cancel := d.fg.cancel
+	d.fg.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	if !d.Quiet {
+		d.renderer.PrintError(errors.New("interrupted"))
+	}
+}
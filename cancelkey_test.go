@@ -0,0 +1,141 @@
+package dialogue
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCancelKey(t *testing.T) {
+	var lines []string
+	var cmdErr error
+	started := make(chan struct{})
+	r, pw := io.Pipe()
+	d := &Dialogue{R: r, W: nopReadWriter{}, HandleCancelKey: true}
+	d.RegisterCommands(
+		&Command{
+			Name: "hang",
+			Exec: func(chain *CallChain, _ []string) error {
+				ctx := chain.GetCurrent().Context()
+				close(started)
+				<-ctx.Done()
+
+				cmdErr = ctx.Err()
+				return nil
+			},
+		},
+		&Command{
+			Name: "say",
+			Exec: func(_ *CallChain, args []string) error {
+				lines = append(lines, args...)
+				return nil
+			},
+		},
+	)
+
+	go func() {
+		io.WriteString(pw, "hang\n")
+		<-started
+		io.WriteString(pw, "say a\x03\n")
+		pw.Close()
+	}()
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if cmdErr != context.Canceled {
+		t.Fatalf("expected the context of the command to be cancelled, got: %v", cmdErr)
+	}
+
+	// the key is removed from the input and the session goes on.
+	if !reflect.DeepEqual(lines, []string{"a"}) {
+		t.Fatalf("expected the next line to be dispatched but got %v", lines)
+	}
+}
+
+func TestKeyReader(t *testing.T) {
+	var keys int
+	k := newKeyReader(strings.NewReader("a\x1bb\x1b\x1bc"), '\x1b', func() { keys++ })
+
+	b, err := io.ReadAll(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "abc" || keys != 3 {
+		t.Fatalf("expected %q and 3 keys, got %q and %d keys", "abc", b, keys)
+	}
+}
+
+// chanReader returns the chunks sent on its channel, one per read.
+type chanReader chan string
+
+func (r chanReader) Read(p []byte) (int, error) {
+	return copy(p, <-r), nil
+}
+
+func TestCancelKeySession(t *testing.T) {
+	var lines []string
+	r := make(chanReader)
+	d := &Dialogue{R: r, W: nopReadWriter{}, QuitCmd: "quit", HandleCancelKey: true}
+	d.RegisterCommands(&Command{
+		Name: "say",
+		Exec: func(_ *CallChain, args []string) error {
+			lines = append(lines, args...)
+			return nil
+		},
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- d.Open() }()
+	r <- "quit\n"
+	if err := <-errs; !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	// the read stranded by the session returns, R isnt read ahead anymore.
+	r <- "say a\n"
+	select {
+	case r <- "say b\n":
+		t.Fatal("expected R not to be read ahead once the session ended")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	go func() { errs <- d.Open() }()
+	r <- "say b\nquit\n"
+	if err := <-errs; !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if !reflect.DeepEqual(lines, []string{"a", "b"}) {
+		t.Fatalf("expected the stranded read to be kept for the next session, got: %v", lines)
+	}
+}
+
+func TestCancelKeyEncoding(t *testing.T) {
+	var lines []string
+	// the UTF-16 code unit of ă holds the byte of the cancel key.
+	d := &Dialogue{R: bytes.NewReader(encodeUTF16("say ă\n", binary.LittleEndian)), W: nopReadWriter{}, Encoding: UTF16LE, HandleCancelKey: true}
+	d.RegisterCommands(&Command{
+		Name: "say",
+		Exec: func(_ *CallChain, args []string) error {
+			lines = append(lines, args...)
+			return nil
+		},
+	})
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if !reflect.DeepEqual(lines, []string{"ă"}) {
+		t.Fatalf("expected the key to be matched on the decoded input, got: %v", lines)
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/tabwriter"
 )
 
@@ -20,13 +24,201 @@ func (e ErrNoExec) Error() string {
 	return fmt.Sprintf("dialogue: %v has no exec function", e.name)
 }
 
+// ErrExitOnError is reported as a warning when a command uses a flag set with flag.ExitOnError, since any malformed
+// invocation of the command would exit the whole process.
+type ErrExitOnError struct {
+	name string
+}
+
+func (e ErrExitOnError) Error() string {
+	return fmt.Sprintf("dialogue: warning: %v uses flag.ExitOnError, a malformed invocation will exit the process", e.name)
+}
+
+// ErrBadRedirect is returned on dialogue startup when a command redirects to a command which isnt registered or when the
+// redirects of commands form a cycle.
+type ErrBadRedirect struct {
+	name, to string
+}
+
+func (e ErrBadRedirect) Error() string {
+	return fmt.Sprintf("dialogue: %v redirects to %v which isnt registered or redirects back", e.name, e.to)
+}
+
+// ErrReentrant is returned instead of executing a serialized command which is executed again from its own execution, for
+// example through a macro or a call chain it advances, since it would wait for itself forever. See Command.Serialize.
+type ErrReentrant struct {
+	Name string
+}
+
+func (e ErrReentrant) Error() string {
+	return fmt.Sprintf("dialogue: %v is serialized and cant execute itself", e.Name)
+}
+
+// ErrAborted is returned by AdvanceExec once a command aborted the call chain with CallChain.Abort, the dispatcher reports
+// it to the user and keeps the dialogue running instead of treating it as a failure.
+type ErrAborted struct {
+	Name   string // Name is the name of the command which aborted the call chain.
+	Reason error
+}
+
+func (e ErrAborted) Error() string {
+	if e.Reason == nil {
+		return fmt.Sprintf("%v: aborted", e.Name)
+	}
+
+	return fmt.Sprintf("%v: aborted: %v", e.Name, e.Reason)
+}
+
+func (e ErrAborted) Unwrap() error {
+	return e.Reason
+}
+
+// ErrBadSeeAlso is returned on dialogue startup when a command references a command which isnt registered in SeeAlso.
+type ErrBadSeeAlso struct {
+	name, ref string
+}
+
+func (e ErrBadSeeAlso) Error() string {
+	return fmt.Sprintf("dialogue: %v references %v which isnt registered", e.name, e.ref)
+}
+
+// ErrUnknownConfigFlag is returned on dialogue startup when the config file sets a flag which the command doesnt define.
+type ErrUnknownConfigFlag struct {
+	name, flag string
+}
+
+func (e ErrUnknownConfigFlag) Error() string {
+	return fmt.Sprintf("dialogue: config: %v has no flag -%v", e.name, e.flag)
+}
+
+// parseError wraps an error returned by the flag set of cmd.
+type parseError struct {
+	cmd *Command
+	err error
+}
+
+func (e parseError) Error() string {
+	return e.err.Error()
+}
+
+func (e parseError) Unwrap() error {
+	return e.err
+}
+
 // ErrNoName identifies a command with no name.
 var ErrNoName = errors.New("dialogue: command has no name")
 
 // CallChain represents a linked list pathed through the command tree following a path of execution.
 //
 // It starts inverted, the last command in the tree will be the first in the call chain.
-type CallChain []*Command
+type CallChain []*Invocation
+
+// Invocation is a single hop of a call chain, it holds the state of one invocation of a command: its context, its
+// arguments and its flag values. The command itself isnt mutated while executing which makes it safe to invoke the same
+// command recursively or from multiple call chains.
+//
+// Invocation replaces the per execution state which used to live on Command: CallChain.GetCurrent and CallChain.Next
+// return an *Invocation instead of a *Command and Command.Context is now Invocation.Context. The command is embedded so
+// chain.GetCurrent().Context() and the fields of the command keep working, use the Command field where a *Command is
+// expected.
+//
+// The variables bound to the FlagSet of a command are shared by all its invocations, they only hold the values of an
+// invocation until the next one is parsed. Commands which can run concurrently or recursively, such as the commands of
+// schedules, FanOut or several dialogues, should read their flags with Flag.
+type Invocation struct {
+	*Command
+
+	ctx         context.Context
+	args        []string
+	flags       map[string]any // flags holds the values of the flags right after parsing, see Flag.
+	yes         bool           // yes is set if the invocation skips the confirmation prompt with -y or -yes.
+	subArgs     []string
+	passThrough []string
+	step        StepFunc // step wraps Exec with the middleware of the call chain, nil without middleware.
+	aborted     error    // aborted is the error returned instead of executing the invocation after an abort.
+	result      any      // result is set by the command with SetResult.
+	executed    bool     // executed indicates if the call chain reached the invocation.
+
+	ran   *[]*Invocation // ran logs the hops of the call chain in the order they executed, shared by the hops.
+	block *chainBlock    // block is the pooled allocation backing the call chain, released by clean.
+}
+
+// StepFunc executes a single hop of a call chain, it has the signature of Command.Exec.
+type StepFunc func(chain *CallChain, args []string) error
+
+// serialKey is the context key of the serialized executions in progress, see Command.Serialize.
+type serialKey struct{}
+
+// serialHold links the locks of the serialized executions in progress, innermost first.
+type serialHold struct {
+	mu     *sync.Mutex
+	parent *serialHold
+}
+
+// holds reports whether the lock mu is held by one of the executions of h.
+func (h *serialHold) holds(mu *sync.Mutex) bool {
+	for ; h != nil; h = h.parent {
+		if h.mu == mu {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exec executes the invocation through the middleware of the call chain.
+func (i *Invocation) exec(c *CallChain) error {
+	if i.Serialize && i.serialMu != nil {
+		held, _ := i.Context().Value(serialKey{}).(*serialHold)
+		if held.holds(i.serialMu) {
+			return ErrReentrant{i.Name}
+		}
+
+		i.serialMu.Lock()
+		defer i.serialMu.Unlock()
+		i.ctx = context.WithValue(i.Context(), serialKey{}, &serialHold{i.serialMu, held})
+	}
+
+	if i.step != nil {
+		return i.step(c, i.args)
+	}
+
+	return i.Exec(c, i.args)
+}
+
+// Context fetches the context of the invocation. If the context is nil, context.Background will be returned.
+func (i *Invocation) Context() context.Context {
+	if i.ctx == nil {
+		return context.Background()
+	}
+
+	return i.ctx
+}
+
+// Flag returns the value of the flag called name as parsed for the invocation: the value returned by flag.Getter or the
+// string form of the values which dont implement it. ok is false if the command has no such flag. Unlike the variables
+// bound to the FlagSet, the value isnt changed by the other invocations of the command.
+//
+//	n, _ := chain.GetCurrent().Flag("n")
+//	count := n.(int)
+func (i *Invocation) Flag(name string) (v any, ok bool) {
+	v, ok = i.flags[name]
+	return v, ok
+}
+
+// Args returns the positional arguments which belong to the invocation: the arguments left after parsing its flags up to
+// the name of its sub command. Each invocation owns its args, appending to them doesnt affect the other invocations.
+func (i *Invocation) Args() []string {
+	return i.args
+}
+
+// SubArgs returns the arguments which followed the name of the sub command of the invocation, flags included, they are
+// parsed by the sub command. It returns nil for the last invocation of the chain.
+//
+//	root -f a sub -v b // root: Args [a], SubArgs [-v b]; sub: Args [b]
+func (i *Invocation) SubArgs() []string {
+	return i.subArgs
+}
 
 // Advance advances the call chain n positions, it panics if n >= len(c) or n < 0.
 func (c *CallChain) Advance(n int) {
@@ -48,17 +240,114 @@ func (c *CallChain) AdvanceExec(n int, ctx context.Context) error {
 		ctx = context.Background()
 	}
 
-	cmd := (*c)[0]
-	cmd.ctx = ctx
+	inv := (*c)[0]
+	if inv.aborted != nil {
+		return inv.aborted
+	}
+	inv.ctx = ctx
+	if !inv.executed && inv.ran != nil {
+		*inv.ran = append(*inv.ran, inv)
+	}
+	inv.executed = true
+
+	return inv.exec(c)
+}
+
+// run executes the call chain in order starting with ctx.
+func (c *CallChain) run(ctx context.Context, order ExecOrder) error {
+	if order != ExecRootFirst {
+		return c.AdvanceExec(0, ctx)
+	}
+
+	for i := len(*c) - 1; i >= 0; i-- {
+		stage := (*c)[i:]
+		if err := stage.AdvanceExec(0, ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Abort stops the execution of the call chain, the remaining commands arent executed: AdvanceExec returns the returned
+// ErrAborted instead. Return the error from Exec so the dispatcher reports the command as aborted with reason rather than
+// failed:
+//
+//	if !ready {
+//		return chain.Abort(errors.New("nothing to deploy"))
+//	}
+func (c *CallChain) Abort(reason error) error {
+	err := ErrAborted{(*c)[0].Name, reason}
+	for _, inv := range (*c)[1:] {
+		inv.aborted = err
+	}
+
+	return err
+}
+
+// Skip drops the n invocations following the current one without executing them, the next call to AdvanceExec(1, ctx)
+// executes the invocation after them. Use it to skip optional intermediate commands. It panics if n >= len(c) or n < 0.
+func (c *CallChain) Skip(n int) {
+	if n >= len(*c) || n < 0 {
+		panic("cannot skip")
+	}
+
+	*c = append(CallChain{(*c)[0]}, (*c)[1+n:]...)
+}
+
+// AdvanceExecResult is like AdvanceExec but it also returns the result the executed command set with SetResult, nil if it
+// didnt set one. It lets a command post-process or summarize the outcome of the command it advances to:
+//
+//	res, err := chain.AdvanceExecResult(1, ctx)
+//	if n, ok := res.(int); ok {
+//		fmt.Fprintf(w, "%v items updated\n", n)
+//	}
+func (c *CallChain) AdvanceExecResult(n int, ctx context.Context) (any, error) {
+	if n >= len(*c) || n < 0 {
+		panic("cannot advance")
+	}
+
+	// the executed command can advance the chain further.
+	inv := (*c)[n]
+	err := c.AdvanceExec(n, ctx)
+	return inv.result, err
+}
+
+// SetResult sets the result of the current invocation returned by AdvanceExecResult to the command which advanced the
+// chain to it.
+func (c *CallChain) SetResult(v any) {
+	(*c)[0].result = v
+}
 
-	return cmd.Exec(c, cmd.args)
+// Wrap wraps every hop of the call chain which hasnt been executed yet with mw, the hops are executed through the middleware
+// by AdvanceExec. Use it for cross-cutting concerns such as timing each stage of a command or injecting per hop context
+// values. The middleware of the last call to Wrap is the outermost.
+//
+//	chain.Wrap(func(next dialogue.StepFunc) dialogue.StepFunc {
+//		return func(chain *dialogue.CallChain, args []string) error {
+//			defer func(start time.Time) { log.Println(chain.GetCurrent().Name, time.Since(start)) }(time.Now())
+//			return next(chain, args)
+//		}
+//	})
+func (c *CallChain) Wrap(mw func(next StepFunc) StepFunc) {
+	for _, inv := range *c {
+		if inv.executed {
+			continue
+		}
+
+		next := inv.step
+		if next == nil {
+			next = inv.Exec
+		}
+		inv.step = mw(next)
+	}
 }
 
-// Next peeks into the next command without advancing the chain, if there is no next command
-// nil is returned. If there is the command is returned with the specified context.
+// Next peeks into the next invocation without advancing the chain, if there is no next invocation
+// nil is returned. If there is the invocation is returned with the specified context.
 //
 // If the context is nil context.Background will be used.
-func (c *CallChain) Next(ctx context.Context) *Command {
+func (c *CallChain) Next(ctx context.Context) *Invocation {
 	if len(*c) <= 1 {
 		return nil
 	}
@@ -67,25 +356,148 @@ func (c *CallChain) Next(ctx context.Context) *Command {
 		ctx = context.Background()
 	}
 
-	cmd := (*c)[1]
-	cmd.ctx = ctx
-	return cmd
+	inv := (*c)[1]
+	inv.ctx = ctx
+	return inv
 }
 
-// GetCurrent gets the current command in the chain.
-func (c *CallChain) GetCurrent() *Command {
+// PassThrough returns the arguments which followed the "--" terminator. The pass-through arguments are also included in the
+// args of the command which saw the terminator but are never parsed as flags or sub commands.
+func (c *CallChain) PassThrough() []string {
+	return (*c)[0].passThrough
+}
+
+// GetCurrent gets the current invocation in the chain.
+func (c *CallChain) GetCurrent() *Invocation {
 	return (*c)[0]
 }
 
-// clean sets all used flags in the call chain back to their default values.
+// validate runs the ValidateArgs function of every command in the call chain.
+func (c *CallChain) validate() error {
+	for _, inv := range *c {
+		if inv.ValidateArgs == nil {
+			continue
+		}
+
+		if err := inv.ValidateArgs(inv.args); err != nil {
+			return fmt.Errorf("%v: %w", inv.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// clean sets the flags in the call chain back to their default values according to the flag reset policy of each command.
+// The call chains parsed by a dispatch are recycled, they and their invocations must not be used after clean.
 func (c *CallChain) clean() {
-	for _, cmd := range *c {
-		cmd.FlagSet.Visit(func(f *flag.Flag) {
-			f.Value.Set(f.DefValue)
+	var block *chainBlock
+
+	for _, inv := range *c {
+		unlock := inv.lockFlags()
+		switch inv.reset {
+		case FlagResetSticky:
+		case FlagResetAll:
+			inv.FlagSet.VisitAll(resetFlag)
+		default:
+			// Visit sorts the set flags on every call, skip it when no flag was ever set.
+			if inv.FlagSet.NFlag() > 0 {
+				inv.FlagSet.Visit(resetFlag)
+			}
+		}
+
+		unlock()
+		block = inv.block
+	}
+
+	if block != nil {
+		block.release()
+	}
+}
+
+// trace writes the resolved path of the call chain (root > sub) followed by a line holding the flag values and args of every
+// invocation, root first. Every line is prefixed by "+ " like the shell trace output and rewritten by redact.
+func (c *CallChain) trace(w io.Writer, redact func(string) string) error {
+	var path strings.Builder
+	path.WriteString("+ ")
+	for i := len(*c) - 1; i >= 0; i-- {
+		path.WriteString((*c)[i].Name)
+		if i > 0 {
+			path.WriteString(" > ")
+		}
+	}
+	lines := []string{path.String()}
+
+	for i := len(*c) - 1; i >= 0; i-- {
+		inv := (*c)[i]
+
+		var b strings.Builder
+		b.WriteString("+ " + inv.Name)
+		inv.FlagSet.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(&b, " -%v=%v", f.Name, f.Value)
 		})
+		fmt.Fprintf(&b, " %q", inv.args)
+		lines = append(lines, b.String())
 	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(redact(line) + "\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// resetFlag sets f back to its default value.
+func resetFlag(f *flag.Flag) {
+	if r, ok := f.Value.(resetter); ok {
+		r.Reset()
+		return
+	}
+
+	f.Value.Set(f.DefValue)
 }
 
+// FlagReset controls how the flags of a command are restored after each invocation.
+type FlagReset int
+
+const (
+	// FlagResetDefault inherits the policy of the dialogue, for the dialogue itself it means FlagResetVisited.
+	FlagResetDefault FlagReset = iota
+
+	// FlagResetVisited resets the flags set during the invocation back to their default values.
+	FlagResetVisited
+
+	// FlagResetSticky retains the flag values across invocations, useful for session wide toggles such as -verbose.
+	FlagResetSticky
+
+	// FlagResetAll resets every flag back to its default value, including the flags set programmatically between
+	// invocations.
+	FlagResetAll
+)
+
+// Example is a concrete invocation of a command listed by the default help formatter.
+type Example struct {
+	Cmd         string // Cmd is the command line, such as "deploy -force app1".
+	Description string
+}
+
+// ExecOrder controls the order in which the commands of a call chain are executed.
+type ExecOrder int
+
+const (
+	// ExecOrderDefault inherits the order of the dialogue, for the dialogue itself it means ExecLeafFirst.
+	ExecOrderDefault ExecOrder = iota
+
+	// ExecLeafFirst executes the last sub command of the call chain, its parents only run if it advances the chain to them.
+	ExecLeafFirst
+
+	// ExecRootFirst executes every command of the call chain as a stage, from the root command to the last sub command,
+	// like the pre-run hooks of cobra. Each stage sees the call chain starting at its own invocation and shouldnt advance
+	// it, a stage returning an error (or an ErrAborted from CallChain.Abort) stops the following stages.
+	ExecRootFirst
+)
+
 // Command represents a parsable, executable and chainable instruction from the command line.
 // It stores a flagset used to parse command line arguments, an exec function which is called
 // upon execution, other commands in the form of sub commands which allows tree like branching and
@@ -95,6 +507,10 @@ type Command struct {
 	// or when displayed in help / usage texts. This field is required.
 	Name string
 
+	// Aliases are optional alternative names the command can be called upon with, such as localized names ("ayuda" for
+	// "help"). The names of the commands take precedence over the aliases of other commands.
+	Aliases []string
+
 	// Structure displays the structure text for the command. This field isnt required but its
 	// recommended. It is consumed by the DefaultHelpFunc and displayed at the top of the
 	// help output. It should show the structure of optional or required flags of the command.
@@ -110,6 +526,28 @@ type Command struct {
 	// of the sub commands.
 	HelpShort string
 
+	// Examples optionally lists concrete invocations of the command, the default help formatter writes them in an EXAMPLES
+	// section of the focused help.
+	Examples []Example
+
+	// SeeAlso optionally references related commands by name, the default help formatter lists them in a SEE ALSO section
+	// of the focused help. The names are checked on dialogue startup.
+	SeeAlso []string
+
+	// Annotations optionally holds extension metadata of the command such as "audit": "true", it isnt used by the
+	// dialogue. Middleware, authorization checks and custom formatters read it from the invocations of the call chain:
+	//
+	//	if chain.GetCurrent().Annotations["audit"] == "true" {
+	Annotations map[string]string
+
+	// Output optionally replaces W for the command, for example to point a noisy diagnostic command at a log file while
+	// the rest of the output stays on the console. The writer returned by OutFromContext, the errors reported while
+	// dispatching the command, its usage and its help are written to Output. The output written to Output isnt captured
+	// for LastOutputFromContext and a custom Renderer is still used for the errors and the help.
+	//
+	// The output of a dispatch follows the command named by the line, the Output of a sub command only redirects its usage.
+	Output io.Writer
+
 	// HelpFunc consumes a command and outputs a help string for the command to FlagSet.Output().
 	// The function is invoced by the -h or --help flag under the recieved command object. The HelpFunc
 	// should be capable of consuming the Name, Structure, HelpLong, HelpShort, FlagSet and SubCommands
@@ -119,6 +557,11 @@ type Command struct {
 	// the FormatHelp call was called in a batch with other calls and shouldnt be very specific.
 	FormatHelp func(cmd *Command, focus bool) string
 
+	// SortOrder orders the command in the help output, Visit and the completion candidates: commands with a lower sort
+	// order come first, commands with the same sort order are ordered by name. Sub commands with the same sort order keep
+	// their order in SubCommands.
+	SortOrder int
+
 	// SubCommands holds the sub commands accessible from the root command. This structure allows
 	// commands to branch out like a tree.
 	SubCommands []*Command
@@ -132,115 +575,752 @@ type Command struct {
 	// next command via the call chain. This way you can controll the execution flow of your
 	// commands and return any errors. Contextual information should be handeled by context parameter
 	// when advancing the chain.
+	//
+	// The args, the call chain and its invocations are recycled once the line is dispatched, copy the args which have to
+	// outlive Exec.
 	Exec func(chain *CallChain, args []string) error
 
-	// computated at command runtime.
-	ctx  context.Context
-	args []string
+	// ValidateArgs is an optional function which validates the positional arguments of the command after parsing and before
+	// any command in the call chain gets executed. The returned error is written to the dialogue writer and the command isnt
+	// executed. Use Validate to compose the provided validators:
+	//
+	//	ValidateArgs: func(args []string) error {
+	//		return dialogue.Validate(args, dialogue.Range(1, 1), dialogue.Match(idRegexp))
+	//	}
+	ValidateArgs func(args []string) error
+
+	// InterleavedFlags enables GNU style parsing where flags can appear after positional arguments (deploy app1 -force). By
+	// default parsing stops at the first non flag argument like the standard flag package does. In interleaved mode parsing
+	// still stops at the first sub command name or at the "--" terminator.
+	InterleavedFlags bool
+
+	// UsageOnError optionally overrides the dialogue usage policy for this command. It is called after the flag set reported
+	// a malformed invocation of the command.
+	UsageOnError UsagePolicy
+
+	// EnvPrefix optionally binds the flags of the command to environment variables. The environment variable of a flag is
+	// the prefix followed by the upper cased flag name with dashes replaced by underscores (EnvPrefix "ECHO_" binds -n to
+	// ECHO_N). Environment variables are applied before every invocation and take precedence over the dialogue config file
+	// but not over the command line.
+	EnvPrefix string
+
+	// FlagReset optionally overrides the dialogue flag reset policy for this command.
+	FlagReset FlagReset
+
+	// ExecOrder optionally overrides the dialogue execution order for the call chains starting at this command, it is
+	// ignored on sub commands.
+	ExecOrder ExecOrder
+
+	// SupportsDryRun marks the command as honouring the dialogue dry-run mode (see DryRunFromContext), the default help
+	// formatter annotates such commands.
+	SupportsDryRun bool
+
+	// Confirm is an optional prompt such as "This will delete X, proceed? [y/N]" which the dialogue writes before executing
+	// the command, the command is only executed if the answer read from the dialogue reader is y or yes. The prompt can be
+	// bypassed with the -y or -yes flags which are added to the flag set of the command unless already defined.
+	//
+	// See Dialogue.ConfirmPolicy for the behaviour of non interactive dialogues.
+	Confirm string
+
+	// CompleteFlag optionally completes the values of the flags of the command for the default completer, it returns the
+	// candidate values of the flag named name, the candidates not starting with prefix are filtered out. The choices of
+	// EnumFlag flags are used when it is nil or returns no candidates.
+	CompleteFlag func(name, prefix string) []string
+
+	// Enabled optionally gates the availability of the command, for example on a license tier or a runtime feature flag. It
+	// is consulted with the dispatch context before dispatching the command and before formatting the help output, disabled
+	// commands are treated as not registered. Enabled is only consulted for the commands registered to the dialogue, not
+	// for sub commands.
+	Enabled func(ctx context.Context) bool
+
+	// RedirectTo deprecates the command in favour of the named command registered to the dialogue: invoking the command
+	// dispatches the named command with the same args instead, Exec isnt required. The first invocation writes a
+	// deprecation notice. Every redirect is reported to Dialogue.OnRedirect so the usage of the old name can be tracked.
+	// Only consulted for the commands registered to the dialogue, not for sub commands.
+	RedirectTo string
+
+	// Undo optionally reverts the side effects of an execution of the command, it is called by the dialogue undo command
+	// (see Dialogue.UndoCmd) with the args of the reverted execution. Only the executions which returned no error and
+	// were reached by the call chain are recorded.
+	Undo func(ctx context.Context, args []string) error
+
+	// Retry optionally retries the executions of the command which fail, see RetryPolicy. The retries are applied inside
+	// the middleware of the dialogue, the command reads its attempt with AttemptFromContext and Timing reports the attempts
+	// of the command.
+	Retry *RetryPolicy
+
+	// Serialize makes the executions of the command mutually exclusive when it is executed concurrently, for example by
+	// FanOut or by several dialogues sharing the command: an execution waits for the previous one to return. Use it to
+	// protect the commands which mutate shared state without serializing every command. The lock is held until Exec
+	// returns, including the hops it advances to, so a serialized command cant execute itself: executing it again with the
+	// context of its invocation returns ErrReentrant. The lock is set up when the dialogue is opened, the commands
+	// executed without a dialogue arent serialized.
+	Serialize bool
+
+	// config holds the flag values from the dialogue config file and reset holds the resolved flag reset policy, both are
+	// set on dialogue startup.
+	config map[string][]string
+	reset  FlagReset
+
+	lookupEnv   func(key string) (string, bool) // lookupEnv looks the EnvPrefix variables up, set on dialogue startup.
+	parseOutput io.Writer                       // parseOutput replaces the output of the flag set while parsing, set on dialogue startup.
+
+	flagMu     *sync.Mutex // flagMu serializes the parsing and the cleaning of the flag set, set on init.
+	flagUnlock func()      // flagUnlock unlocks flagMu, bound once so locking the flags doesnt allocate.
+	serialMu   *sync.Mutex // serialMu serializes the executions of the command if Serialize is set, set on init.
+
+	lazy      *lazyCommand // lazy constructs the command on first use, set for the commands registered by RegisterLazy.
+	immediate bool         // immediate commands are executed even inside transactions, set for the builtin commands.
+
+	// compiled state, set by Dialogue.Compile.
+	subIndex map[string]*Command // subIndex maps the lower cased sub command names to the sub commands.
+	help     [2]string           // help holds the out of focus and focused help output.
+
+	// the warnings about the command are written once, not every time the command is compiled or dispatched. Both are
+	// guarded by the lock of the dialogue.
+	warnedExitOnError bool // warnedExitOnError is set once the ErrExitOnError warning is reported.
+	warnedRedirect    bool // warnedRedirect is set once the deprecation notice of RedirectTo is written.
 }
 
-// Context fetches the context from the command. If the context is nil, context.Background will
-// be returned.
-func (c *Command) Context() context.Context {
-	if c.ctx == nil {
-		c.ctx = context.Background()
+// chainBlockSize is the number of hops which can be backed by a single chainBlock allocation.
+const chainBlockSize = 4
+
+// chainPool recycles the chainBlocks of the call chains parsed by a dispatch, see CallChain.clean.
+var chainPool = sync.Pool{New: func() any { return new(chainBlock) }}
+
+// chainBlock backs a call chain of up to chainBlockSize hops with a single allocation.
+type chainBlock struct {
+	cc     CallChain
+	ran    []*Invocation
+	ptrs   [chainBlockSize]*Invocation
+	invs   [chainBlockSize]Invocation
+	ranBuf [chainBlockSize]*Invocation
+}
+
+// release drops the references held by the block, the commands, contexts and args of the invocations, and puts it back in
+// chainPool.
+func (b *chainBlock) release() {
+	*b = chainBlock{}
+	chainPool.Put(b)
+}
+
+// Resolve follows args down the command tree of c without executing anything, it returns the call chain of the
+// invocation and the arguments of the resolved command (the leaf). Use it to resolve invocations in external tooling such
+// as doc generators or dry-run validators, no running Dialogue is needed.
+//
+// The flags are parsed into the flag sets of the commands like during a dispatch and stay set. Commands without a FlagSet
+// get one.
+func (c *Command) Resolve(args []string) (*CallChain, []string, error) {
+	chain, err := c.parse(args)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return c.ctx
+	return chain, chain.GetCurrent().Args(), nil
 }
 
-// parse the command trees recursively building the command chain.
+// parse the command tree following args building the command chain.
 func (c *Command) parse(args []string) (*CallChain, error) {
+	return c.parseDepth(args, 0, false)
+}
+
+// parseDepth is like parse but it returns an ErrInputLimit if the call chain has more than max commands, max is ignored
+// unless positive. Sub commands can reference each other so the depth of the call chain is only bounded by args.
+//
+// If pooled is set the call chain is backed by chainPool and recycled by clean, it is only set by the dispatches which
+// dont hand the call chain out once it is cleaned.
+func (c *Command) parseDepth(args []string, max int, pooled bool) (*CallChain, error) {
+	// resolve the hops from the root to the leaf, most trees are shallow so the scratch space stays on the stack.
+	var scratch [chainBlockSize]Invocation
+	hops := scratch[:0]
+
+	for cmd := c; cmd != nil; {
+		if max > 0 && len(hops) == max {
+			newCallChain(hops, pooled).clean()
+			return nil, ErrInputLimit{"depth", max}
+		}
+
+		inv, next, rest, err := cmd.resolve(args)
+		if err != nil {
+			// the flags parsed before the error, by cmd or its parents, dont carry over to the next invocation.
+			newCallChain(append(hops, Invocation{Command: cmd}), pooled).clean()
+			return nil, err
+		}
+
+		hops = append(hops, inv)
+		cmd, args = next, rest
+	}
+
+	return newCallChain(hops, pooled), nil
+}
+
+// resolve parses the flags of the command from args and searches the remaining arguments for a sub command. It returns the
+// invocation of the command and, if found, the sub command together with its arguments.
+func (c *Command) resolve(args []string) (inv Invocation, next *Command, rest []string, err error) {
+	unlock := c.lockFlags()
+	c.initFlagSet()
+	defaulted, err := c.applyDefaults()
+	if err != nil {
+		unlock()
+		return inv, nil, nil, err
+	}
+
+	restore := c.replaceDefaults(defaulted)
+	restoreOutput := c.redirectOutput()
+	cmdArgs, err := c.parseFlags(args)
+	restoreOutput()
+	restore()
+	if err != nil {
+		unlock()
+		return inv, nil, nil, parseError{c, err}
+	}
+
+	inv.Command = c
+	inv.flags = c.snapshotFlags()
+	inv.yes = c.skipsConfirm(inv.flags)
+	unlock()
+
+	// search sub commands in command args.
+	for i, arg := range cmdArgs {
+		// found terminator, everything after it is positional.
+		if arg == "--" {
+			inv.passThrough = cmdArgs[i+1:]
+			inv.args = append(cmdArgs[:i:i], inv.passThrough...)
+			return inv, nil, nil, nil
+		}
+
+		// found match, truncate arguments and pass the rest to the next. The capacity is truncated too so appending to the
+		// args of the invocation cant overwrite the args of the sub command.
+		if subCmd := c.subCommand(arg); subCmd != nil {
+			inv.args = cmdArgs[:i:i]
+			inv.subArgs = cmdArgs[i+1:] // exclude the sub command name.
+			return inv, subCmd, inv.subArgs, nil
+		}
+	}
+
+	// BASE CASE:
+	// Exhausted all arguments and found no matches to any sub commands.
+	inv.args = cmdArgs
+	return inv, nil, nil, nil
+}
+
+// newCallChain builds the call chain from hops ordered from the root to the leaf. If pooled is set the chainBlock backing
+// the call chain is taken from chainPool.
+func newCallChain(hops []Invocation, pooled bool) *CallChain {
+	n := len(hops)
+
+	var out *CallChain
+	var cc CallChain
+	var invs []Invocation
+	var ran *[]*Invocation
+	var block *chainBlock
+	if n <= chainBlockSize {
+		var b *chainBlock
+		if pooled {
+			b = chainPool.Get().(*chainBlock)
+			block = b
+		} else {
+			b = new(chainBlock)
+		}
+		b.ran = b.ranBuf[:0]
+		out, cc, invs, ran = &b.cc, b.ptrs[:n], b.invs[:n], &b.ran
+	} else {
+		log := make([]*Invocation, 0, n)
+		out, cc, invs, ran = new(CallChain), make(CallChain, n), make([]Invocation, n), &log
+	}
+
+	// the chain starts inverted at the leaf, every hop shares the pass-through args of the leaf.
+	passThrough := hops[n-1].passThrough
+	for i := range invs {
+		invs[i] = hops[n-1-i]
+		invs[i].passThrough = passThrough
+		invs[i].ran = ran
+		invs[i].block = block
+		cc[i] = &invs[i]
+	}
+
+	*out = cc
+	return out
+}
+
+// applyDefaults sets the flags of the command from the config file values and the environment, in this order, before any
+// parsing happens so command line flags take precedence over both. It returns the flags it set.
+func (c *Command) applyDefaults() (map[string]bool, error) {
+	// sticky flags keep the values set by previous invocations.
+	var set map[string]bool
+	if c.reset == FlagResetSticky {
+		set = make(map[string]bool)
+		c.FlagSet.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	}
+
+	// most commands have no defaults, defaulted is only allocated once one is set.
+	var defaulted map[string]bool
+	for name, values := range c.config {
+		if set[name] {
+			continue
+		}
+
+		for _, value := range values {
+			if err := c.FlagSet.Set(name, value); err != nil {
+				return nil, fmt.Errorf("%v: config value for flag -%v: %w", c.Name, name, err)
+			}
+		}
+		if defaulted == nil {
+			defaulted = make(map[string]bool)
+		}
+		defaulted[name] = true
+	}
+
+	if c.EnvPrefix == "" {
+		return defaulted, nil
+	}
+
+	lookup := c.lookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	var err error
+	c.FlagSet.VisitAll(func(f *flag.Flag) {
+		key := c.EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := lookup(key); ok && err == nil && !set[f.Name] {
+			// the environment replaces the config values of the accumulating flags instead of adding to them.
+			if defaulted[f.Name] {
+				resetFlag(f)
+			}
+
+			// set through the flag set to mark the flag as set so it gets cleaned after the invocation.
+			if serr := c.FlagSet.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("%v: environment variable %v: %w", c.Name, key, serr)
+			}
+			if defaulted == nil {
+				defaulted = make(map[string]bool)
+			}
+			defaulted[f.Name] = true
+		}
+	})
+
+	return defaulted, err
+}
+
+// replaceValue resets an accumulating flag value set by applyDefaults the first time the command line sets it, so the
+// command line replaces the defaults instead of adding to them.
+type replaceValue struct {
+	flag.Value
+	replaced bool
+}
+
+func (v *replaceValue) Set(s string) error {
+	if !v.replaced {
+		v.replaced = true
+		v.Value.(resetter).Reset()
+	}
+
+	return v.Value.Set(s)
+}
+
+// replaceDefaults wraps the accumulating flags in defaulted with a replaceValue for the parsing of the command line, the
+// returned function restores them.
+func (c *Command) replaceDefaults(defaulted map[string]bool) func() {
+	var wrapped []*flag.Flag
+	for name := range defaulted {
+		f := c.FlagSet.Lookup(name)
+		if f == nil {
+			continue
+		}
+
+		if _, ok := f.Value.(resetter); ok {
+			f.Value = &replaceValue{Value: f.Value}
+			wrapped = append(wrapped, f)
+		}
+	}
+
+	return func() {
+		for _, f := range wrapped {
+			f.Value = f.Value.(*replaceValue).Value
+		}
+	}
+}
+
+// redirectOutput points the flag set to parseOutput, if set, so the parse errors it writes before the usage go where the
+// usage goes. The returned function restores the output of the flag set.
+func (c *Command) redirectOutput() func() {
+	if c.parseOutput == nil {
+		return func() {}
+	}
+
+	out := c.FlagSet.Output()
+	c.FlagSet.SetOutput(c.parseOutput)
+	return func() { c.FlagSet.SetOutput(out) }
+}
+
+// confirmFlag is the value of the -y and -yes flags added to the commands which require confirmation.
+type confirmFlag bool
+
+func (f *confirmFlag) String() string {
+	return strconv.FormatBool(bool(*f))
+}
+
+func (f *confirmFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+
+	*f = confirmFlag(v)
+	return nil
+}
+
+func (f *confirmFlag) Get() any {
+	return bool(*f)
+}
+
+func (f *confirmFlag) IsBoolFlag() bool {
+	return true
+}
+
+// skipsConfirm reports whether the parsed flags of an invocation skip the confirmation prompt of the command. The -y and
+// -yes flags defined by the command itself dont skip it. The flags are cleared right away so they never apply to the next
+// invocation, even when it is parsed before this one is cleaned.
+func (c *Command) skipsConfirm(flags map[string]any) bool {
+	if c.Confirm == "" {
+		return false
+	}
+
+	var yes bool
+	for _, name := range [...]string{"y", "yes"} {
+		if f := c.FlagSet.Lookup(name); f != nil {
+			if v, ok := f.Value.(*confirmFlag); ok {
+				yes = yes || flags[name] == true
+				*v = false
+			}
+		}
+	}
+
+	return yes
+}
+
+// lockFlags locks the flag set of the command while it is parsed or cleaned and returns the unlock function. The flag
+// sets of the commands which werent initialised by a dialogue arent locked.
+func (c *Command) lockFlags() func() {
+	if c.flagMu == nil {
+		return func() {}
+	}
+
+	c.flagMu.Lock()
+	return c.flagUnlock
+}
+
+// resetFlags sets every flag of the command back to its default value whatever its flag reset policy, see Dialogue.Reset.
+func (c *Command) resetFlags() {
+	if c.FlagSet == nil {
+		return
+	}
+
+	unlock := c.lockFlags()
+	c.FlagSet.VisitAll(resetFlag)
+	unlock()
+}
+
+// snapshotFlags returns the values of the flags of the command right after parsing, see Invocation.Flag.
+func (c *Command) snapshotFlags() map[string]any {
+	var flags map[string]any
+	c.FlagSet.VisitAll(func(f *flag.Flag) {
+		if flags == nil {
+			flags = make(map[string]any)
+		}
+
+		if g, ok := f.Value.(flag.Getter); ok {
+			flags[f.Name] = g.Get()
+			return
+		}
+		flags[f.Name] = f.Value.String()
+	})
+
+	return flags
+}
+
+// parseFlags parses the flags of the command from args and returns the remaining positional arguments. If the flag set
+// stopped parsing at a "--" terminator, the terminator is kept as the first positional argument.
+func (c *Command) parseFlags(args []string) ([]string, error) {
 	if err := c.FlagSet.Parse(args); err != nil {
 		return nil, err
 	}
 
-	cmdArgs := c.FlagSet.Args()
+	var positional []string
+	for rest := c.FlagSet.Args(); len(rest) > 0; rest = c.FlagSet.Args() {
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			// reuse the terminator in args when possible.
+			if positional == nil {
+				return args[consumed-1:], nil
+			}
 
-	// search sub commands in command args.
-	if len(cmdArgs) > 0 {
-		for _, subCmd := range c.SubCommands {
-			for i, arg := range args {
-				// found match, truncate arguments and pass the rest to the next.
-				if strings.EqualFold(arg, subCmd.Name) {
-					c.args = cmdArgs[:i]
-					cc, err := subCmd.parse(cmdArgs[i+1:]) // exclude the sub command name.
-					if err != nil {
-						return nil, err
-					}
-
-					*cc = append(*cc, c)
-					return cc, nil
-				}
+			positional = append(positional, "--")
+			return append(positional, rest...), nil
+		}
+
+		// stop at sub commands in interleaved mode, the rest is left untouched.
+		if !c.InterleavedFlags || c.subCommand(rest[0]) != nil {
+			if positional == nil {
+				return rest, nil
 			}
+
+			return append(positional, rest...), nil
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+		if err := c.FlagSet.Parse(args); err != nil {
+			return nil, err
 		}
 	}
 
-	// BASE CASE:
-	// Exhausted all arguments and found no matches to any sub commands, return the current command.
-	c.args = cmdArgs
-	return &CallChain{c}, nil
+	return positional, nil
 }
 
-// init checks if the command has all the provided fields set in order to run, it only runs on dialogue startup.
-func (c *Command) init() error {
+// initFlagSet provides an empty flag set to commands without one.
+func (c *Command) initFlagSet() {
+	if c.FlagSet == nil {
+		c.FlagSet = flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	}
+}
+
+// enabled reports whether the command is enabled in ctx, see Enabled.
+func (c *Command) enabled(ctx context.Context) bool {
+	return c.Enabled == nil || c.Enabled(ctx)
+}
+
+// subCommand returns the sub command identified by name or nil if there is none.
+func (c *Command) subCommand(name string) *Command {
+	if c.subIndex != nil {
+		return c.subIndex[strings.ToLower(name)]
+	}
+
+	for _, subCmd := range c.SubCommands {
+		if strings.EqualFold(name, subCmd.Name) {
+			return subCmd
+		}
+	}
+
+	for _, subCmd := range c.SubCommands {
+		for _, alias := range subCmd.Aliases {
+			if strings.EqualFold(name, alias) {
+				return subCmd
+			}
+		}
+	}
+
+	return nil
+}
+
+// init checks if the command has all the provided fields set in order to run, it only runs on dialogue startup. The help
+// formater provided by the dialogue is used as the default FormatHelp.
+func (c *Command) init(help commandHelpFormater) error {
 	if c.Name == "" {
 		return ErrNoName
 	}
 
-	if c.Exec == nil {
+	if c.Exec == nil && c.RedirectTo == "" && c.lazy == nil {
 		return ErrNoExec{c.Name}
 	}
 
-	if c.FlagSet == nil { // provide flagset for help flag.
-		c.FlagSet = flag.NewFlagSet(c.Name, flag.ExitOnError)
+	c.initFlagSet() // provide flagset for help flag.
+	if c.flagMu == nil {
+		c.flagMu = new(sync.Mutex)
+		c.flagUnlock = c.flagMu.Unlock
+	}
+	if c.serialMu == nil {
+		c.serialMu = new(sync.Mutex)
+	}
+	if c.Output != nil {
+		c.FlagSet.SetOutput(c.Output)
 	}
 
 	if c.FormatHelp == nil {
-		c.FormatHelp = defaultCommandHelpFormater
+		c.FormatHelp = help.format
 	}
 
-	c.FlagSet.Usage = func() { fmt.Fprintln(c.FlagSet.Output(), c.FormatHelp(c, true)) }
+	// usage is handeled by the dialogue after parsing according to the usage policy.
+	c.FlagSet.Usage = func() {}
+
+	if c.Confirm != "" {
+		for _, name := range [...]string{"y", "yes"} {
+			if c.FlagSet.Lookup(name) == nil {
+				c.FlagSet.Var(new(confirmFlag), name, "skips the confirmation prompt")
+			}
+		}
+	}
 
 	return nil
 }
 
-// defaultCommandHelpFormater is used as the default FormatHelp handler.
+// compile freezes the sub commands of c into a lookup map and precomputes its help output.
+func (c *Command) compile() {
+	c.subIndex = make(map[string]*Command, len(c.SubCommands))
+	for _, subCmd := range c.SubCommands {
+		// keep the first match like the linear search does.
+		if key := strings.ToLower(subCmd.Name); c.subIndex[key] == nil {
+			c.subIndex[key] = subCmd
+		}
+	}
+	for _, subCmd := range c.SubCommands {
+		for _, alias := range subCmd.Aliases {
+			if key := strings.ToLower(alias); c.subIndex[key] == nil {
+				c.subIndex[key] = subCmd
+			}
+		}
+	}
+
+	c.help = [2]string{c.FormatHelp(c, false), c.FormatHelp(c, true)}
+}
+
+// formatHelp returns the help output of the command, using the precomputed output if the command is compiled.
+func (c *Command) formatHelp(focus bool) string {
+	// lazy commands are formatted by name until they are constructed.
+	if c.lazy != nil && c.lazy.cmd != nil {
+		return c.lazy.cmd.formatHelp(focus)
+	}
+
+	if c.subIndex == nil {
+		return c.FormatHelp(c, focus)
+	}
+
+	if focus {
+		return c.help[1]
+	}
+
+	return c.help[0]
+}
+
+// UsagePolicy controls what gets written to w after the flag set of cmd reported err, a malformed invocation of cmd.
+type UsagePolicy func(w io.Writer, cmd *Command, err error)
+
+// UsageFull writes the focused help of cmd. This is the default usage policy.
+func UsageFull(w io.Writer, cmd *Command, _ error) {
+	fmt.Fprintln(w, cmd.formatHelp(true))
+}
+
+// UsageShort writes the short, out of focus, help of cmd.
+func UsageShort(w io.Writer, cmd *Command, _ error) {
+	fmt.Fprint(w, cmd.formatHelp(false))
+}
+
+// UsageErrorOnly writes nothing, leaving only the error reported by the flag set.
+func UsageErrorOnly(_ io.Writer, _ *Command, _ error) {}
+
+// HelpOutput selects where the usage written after a bad invocation and the help requested by the user go, the Output of
+// a command takes precedence over it.
+type HelpOutput int
+
+const (
+	// HelpOutputDefault writes the usage and the help requested with -h to the output of the flag set of the command and
+	// the output of HelpCmd to W. The flag sets of the builtins write to Werr.
+	HelpOutputDefault HelpOutput = iota
+
+	// HelpOutputPOSIX writes the usage, including the help written by the default CommandNotFound, to Werr and the help
+	// requested with -h or HelpCmd to W, like POSIX utilities do.
+	HelpOutputPOSIX
+
+	// HelpOutputW writes the usage and the help to W.
+	HelpOutputW
+
+	// HelpOutputWerr writes the usage and the help to Werr.
+	HelpOutputWerr
+)
+
+// defaultCommandHelpFormater formats the help of a command without any styling.
 func defaultCommandHelpFormater(c *Command, focus bool) string {
+	return commandHelpFormater{}.format(c, focus)
+}
+
+// commandHelpFormater backs the default Command.FormatHelp, it holds the formatting options provided by the dialogue.
+type commandHelpFormater struct {
+	theme  Theme
+	plain  bool      // plain disables tab alignment, every item is written on its own line.
+	width  int       // width wraps the output to the number of columns if positive, ignored in plain mode.
+	term   *termSize // term provides the width when width is 0 so the help follows the resizes of the terminal.
+	layout HelpLayout
+}
+
+func (h commandHelpFormater) format(c *Command, focus bool) string {
+	if h.plain {
+		h.theme = NoColorTheme
+	}
+	if h.width == 0 && h.term != nil {
+		h.width = h.term.get().Width
+	}
+
 	var b strings.Builder
 
 	// c out of focus, return the short help.
 	if !focus {
-		buildHelpShort(&b, c)
+		if h.plain {
+			h.buildHelpShort(plainWriter{&b}, c)
+		} else {
+			h.buildHelpShort(&b, c)
+		}
+
 		return b.String()
 	}
 
 	if c.Structure != "" {
-		b.WriteString(c.Structure)
+		b.WriteString(h.theme.style(h.theme.Command, c.Structure))
 	} else {
-		b.WriteString(c.Name)
+		b.WriteString(h.theme.style(h.theme.Command, c.Name))
 	}
 
 	b.WriteString("\n\n")
 
 	if c.HelpLong != "" {
-		b.WriteString(c.HelpLong)
+		if h.width > 0 && !h.plain {
+			b.WriteString(wrapLines(c.HelpLong, h.width))
+		} else {
+			b.WriteString(c.HelpLong)
+		}
 		b.WriteString("\n\n")
 	}
 
-	tw := tabwriter.NewWriter(&b, 0, 2, 2, ' ', 0)
+	if len(c.Aliases) > 0 {
+		fmt.Fprintf(&b, "Aliases: %s\n\n", strings.Join(c.Aliases, ", "))
+	}
+
+	if c.SupportsDryRun {
+		b.WriteString("This command supports dry-run.\n\n")
+	}
+
+	if c.RedirectTo != "" {
+		fmt.Fprintf(&b, "This command is deprecated, use %v instead.\n\n", c.RedirectTo)
+	}
+
+	var tw interface {
+		io.Writer
+		Flush() error
+	} = tabwriter.NewWriter(&b, 0, 2, 2, ' ', 0)
+	if h.plain {
+		tw = plainWriter{&b}
+	} else if h.width > 0 || h.layout != (HelpLayout{}) {
+		tw = &tableWriter{b: &b, width: h.width, layout: h.layout}
+	}
 
 	// format flags:
 	if nFlags(c.FlagSet) > 0 {
-		b.WriteString("FLAGS\n")
+		b.WriteString(h.theme.style(h.theme.Heading, "FLAGS"))
+		b.WriteByte('\n')
 		c.FlagSet.VisitAll(func(f *flag.Flag) {
 			defV := f.DefValue
 			var space string
-			if defV != "" {
+			if s, ok := f.Value.(syntaxer); ok {
+				defV, space = s.Syntax(), " "
+			} else if defV != "" {
 				space = "="
 			}
 
-			fmt.Fprintf(tw, "-%s%s%s\t%s\n", f.Name, space, defV, f.Usage)
+			usage := f.Usage
+			if c, ok := f.Value.(choicer); ok {
+				usage = fmt.Sprintf("%s (one of: %s)", usage, strings.Join(c.Choices(), ", "))
+			}
+
+			fmt.Fprintf(tw, "%s%s%s\t%s\n", h.theme.style(h.theme.Flag, "-"+f.Name), space, defV, usage)
 		})
 
 		tw.Flush()
@@ -249,16 +1329,42 @@ func defaultCommandHelpFormater(c *Command, focus bool) string {
 
 	// format sub commands:
 	if len(c.SubCommands) > 0 {
-		b.WriteString("SUBCOMMANDS\n")
+		b.WriteString(h.theme.style(h.theme.Heading, "SUBCOMMANDS"))
+		b.WriteByte('\n')
+
+		subs := append([]*Command(nil), c.SubCommands...)
+		sort.SliceStable(subs, func(i, j int) bool { return subs[i].SortOrder < subs[j].SortOrder })
+		for _, sCmd := range subs {
+			h.buildHelpShort(tw, sCmd)
+		}
+
+		tw.Flush()
+		b.WriteByte('\n')
+	}
 
-		for _, sCmd := range c.SubCommands {
-			buildHelpShort(tw, sCmd)
+	// format examples:
+	if len(c.Examples) > 0 {
+		b.WriteString(h.theme.style(h.theme.Heading, "EXAMPLES"))
+		b.WriteByte('\n')
+		for _, ex := range c.Examples {
+			fmt.Fprintf(tw, "%s\t%s\n", h.theme.style(h.theme.Command, ex.Cmd), ex.Description)
 		}
 
 		tw.Flush()
 		b.WriteByte('\n')
 	}
 
+	if len(c.SeeAlso) > 0 {
+		b.WriteString(h.theme.style(h.theme.Heading, "SEE ALSO"))
+		b.WriteByte('\n')
+		refs := make([]string, len(c.SeeAlso))
+		for i, ref := range c.SeeAlso {
+			refs[i] = h.theme.style(h.theme.Command, ref)
+		}
+		b.WriteString(strings.Join(refs, ", "))
+		b.WriteByte('\n')
+	}
+
 	return strings.TrimSpace(b.String()) + "\n"
 }
 
@@ -270,12 +1376,34 @@ func nFlags(fs *flag.FlagSet) (n int) {
 // buildHelpShort builds the out of focus / short version of the help text.
 //
 // It prefers the command structure over the command name.
-func buildHelpShort(w io.Writer, c *Command) {
+func (h commandHelpFormater) buildHelpShort(w io.Writer, c *Command) {
 	name := c.Name
 
 	if c.Structure != "" {
 		name = c.Structure
 	}
 
-	fmt.Fprintf(w, "%s\t%s\n", name, c.HelpShort)
+	short := c.HelpShort
+	if c.SupportsDryRun {
+		short = strings.TrimSpace(short + " (dry-run)")
+	}
+	if c.RedirectTo != "" {
+		short = strings.TrimSpace(short + fmt.Sprintf(" (deprecated, use %v)", c.RedirectTo))
+	}
+
+	fmt.Fprintf(w, "%s\t%s\n", h.theme.style(h.theme.Command, name), short)
+}
+
+// plainWriter replaces the tabwriter in plain mode, it separates the cells of a row with ": " instead of aligning them.
+type plainWriter struct {
+	b *strings.Builder
+}
+
+func (w plainWriter) Write(p []byte) (int, error) {
+	w.b.WriteString(strings.ReplaceAll(string(p), "\t", ": "))
+	return len(p), nil
+}
+
+func (w plainWriter) Flush() error {
+	return nil
 }
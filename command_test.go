@@ -1,10 +1,18 @@
 package dialogue
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var testCommand = &Command{
@@ -63,16 +71,16 @@ func TestParse(t *testing.T) {
 	type testCase struct {
 		rootCmd  *Command
 		args     []string
-		expected *CallChain
+		expected []*Command
 	}
 
 	testCases := []testCase{
-		{cmd1, []string{"not existing"}, &CallChain{cmd1}},
-		{cmd1, []string{"cmd2", "cmd3", "cmd5"}, &CallChain{cmd5, cmd3, cmd2, cmd1}},
-		{cmd2, []string{"cmd3", "cmd4"}, &CallChain{cmd4, cmd3, cmd2}},
-		{cmd2, []string{"cmd1"}, &CallChain{cmd2}},
-		{cmd3, []string{"cmd3"}, &CallChain{cmd3}},
-		{cmd4, []string{"cmd5", "cmd4", "cmd5", "cmd4"}, &CallChain{cmd4, cmd5, cmd4, cmd5, cmd4}},
+		{cmd1, []string{"not existing"}, []*Command{cmd1}},
+		{cmd1, []string{"cmd2", "cmd3", "cmd5"}, []*Command{cmd5, cmd3, cmd2, cmd1}},
+		{cmd2, []string{"cmd3", "cmd4"}, []*Command{cmd4, cmd3, cmd2}},
+		{cmd2, []string{"cmd1"}, []*Command{cmd2}},
+		{cmd3, []string{"cmd3"}, []*Command{cmd3}},
+		{cmd4, []string{"cmd5", "cmd4", "cmd5", "cmd4"}, []*Command{cmd4, cmd5, cmd4, cmd5, cmd4}},
 	}
 
 	for _, tc := range testCases {
@@ -81,10 +89,720 @@ func TestParse(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		if !reflect.DeepEqual(*cc, *tc.expected) {
-			t.Fatalf("mismatch for %v with args %v between expected call chain: %v but got %v", *tc.rootCmd, tc.args, *tc.expected, *cc)
+		if got := chainCommands(cc); !reflect.DeepEqual(got, tc.expected) {
+			t.Fatalf("mismatch for %v with args %v between expected call chain: %v but got %v", *tc.rootCmd, tc.args, tc.expected, got)
 		}
 	}
 }
 
 
+
+func TestParseInterleaved(t *testing.T) {
+	fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	force := fs.Bool("force", false, "")
+
+	subFs := flag.NewFlagSet("status", flag.ContinueOnError)
+	verbose := subFs.Bool("v", false, "")
+
+	status := &Command{Name: "status", FlagSet: subFs}
+	deploy := &Command{
+		Name:             "deploy",
+		FlagSet:          fs,
+		InterleavedFlags: true,
+		SubCommands:      []*Command{status},
+	}
+
+	cc, err := deploy.parse([]string{"app1", "-force", "app2", "status", "-v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !*force || !*verbose {
+		t.Fatalf("expected both flags to be set: force=%v v=%v", *force, *verbose)
+	}
+
+	if got := chainCommands(cc); !reflect.DeepEqual(got, []*Command{status, deploy}) {
+		t.Fatalf("unexpected call chain: %v", got)
+	}
+
+	if args := (*cc)[1].Args(); !reflect.DeepEqual(args, []string{"app1", "app2"}) {
+		t.Fatalf("unexpected args: %v", args)
+	}
+	cc.clean()
+
+	cc, err = deploy.parse([]string{"app1", "--", "-force"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if args := cc.GetCurrent().Args(); *force || !reflect.DeepEqual(args, []string{"app1", "-force"}) {
+		t.Fatalf("expected flags after -- to be positional: force=%v args=%v", *force, args)
+	}
+}
+
+func TestParseTerminator(t *testing.T) {
+	sub := &Command{Name: "sub", FlagSet: flag.NewFlagSet("sub", flag.ContinueOnError)}
+	root := &Command{
+		Name:        "root",
+		FlagSet:     flag.NewFlagSet("root", flag.ContinueOnError),
+		SubCommands: []*Command{sub},
+	}
+	root.FlagSet.Bool("f", false, "")
+
+	type testCase struct {
+		args        []string
+		expected    []*Command
+		passThrough []string
+	}
+
+	testCases := []testCase{
+		{[]string{"-f", "--", "sub", "-f"}, []*Command{root}, []string{"sub", "-f"}},
+		{[]string{"a", "--", "sub"}, []*Command{root}, []string{"sub"}},
+		{[]string{"a", "sub", "--", "sub"}, []*Command{sub, root}, []string{"sub"}},
+		{[]string{"a", "sub"}, []*Command{sub, root}, nil},
+	}
+
+	for _, tc := range testCases {
+		cc, err := root.parse(tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := chainCommands(cc); !reflect.DeepEqual(got, tc.expected) {
+			t.Fatalf("unexpected call chain for %v: %v", tc.args, got)
+		}
+
+		if pt := cc.PassThrough(); !reflect.DeepEqual(pt, tc.passThrough) {
+			t.Fatalf("unexpected pass-through for %v: %v", tc.args, pt)
+		}
+	}
+}
+
+func TestInvocationArgs(t *testing.T) {
+	sub := &Command{Name: "sub", FlagSet: flag.NewFlagSet("sub", flag.ContinueOnError)}
+	sub.FlagSet.Bool("v", false, "")
+	root := &Command{
+		Name:        "root",
+		FlagSet:     flag.NewFlagSet("root", flag.ContinueOnError),
+		SubCommands: []*Command{sub},
+	}
+	root.FlagSet.Bool("f", false, "")
+
+	type testCase struct {
+		args                        []string
+		rootArgs, subArgs, leafArgs []string
+	}
+
+	testCases := []testCase{
+		{[]string{"-f", "sub", "-v", "b"}, []string{}, []string{"-v", "b"}, []string{"b"}},
+		{[]string{"-f", "a", "sub", "b"}, []string{"a"}, []string{"b"}, []string{"b"}},
+		{[]string{"a", "sub"}, []string{"a"}, []string{}, nil},
+	}
+
+	for _, tc := range testCases {
+		cc, err := root.parse(tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rootInv, subInv := (*cc)[1], (*cc)[0]
+		if !reflect.DeepEqual(rootInv.Args(), tc.rootArgs) || !reflect.DeepEqual(rootInv.SubArgs(), tc.subArgs) {
+			t.Fatalf("unexpected root args for %v: %v %v", tc.args, rootInv.Args(), rootInv.SubArgs())
+		}
+
+		if !reflect.DeepEqual(subInv.Args(), tc.leafArgs) || subInv.SubArgs() != nil {
+			t.Fatalf("unexpected sub args for %v: %v %v", tc.args, subInv.Args(), subInv.SubArgs())
+		}
+
+		// appending to the args of the parent leaves the sub command args untouched.
+		_ = append(rootInv.Args(), "x", "y")
+		if !reflect.DeepEqual(rootInv.SubArgs(), tc.subArgs) {
+			t.Fatalf("sub args overwritten for %v: %v", tc.args, rootInv.SubArgs())
+		}
+		cc.clean()
+	}
+}
+
+func TestResolve(t *testing.T) {
+	// no flag sets and no running dialogue.
+	status := &Command{Name: "status", Aliases: []string{"st"}}
+	root := &Command{Name: "root", SubCommands: []*Command{status}}
+
+	cc, args, err := root.Resolve([]string{"a", "st", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := chainCommands(cc); !reflect.DeepEqual(got, []*Command{status, root}) {
+		t.Fatalf("unexpected call chain: %v", got)
+	}
+
+	if !reflect.DeepEqual(args, []string{"b", "c"}) {
+		t.Fatalf("unexpected args: %v", args)
+	}
+
+	root.FlagSet.SetOutput(io.Discard)
+	if _, _, err := root.Resolve([]string{"-x"}); err == nil {
+		t.Fatal("expected an error for an undefined flag")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	var trace []string
+	record := func(tag string) func(next StepFunc) StepFunc {
+		return func(next StepFunc) StepFunc {
+			return func(chain *CallChain, args []string) error {
+				trace = append(trace, tag+":"+chain.GetCurrent().Name)
+				return next(chain, args)
+			}
+		}
+	}
+
+	leaf := &Command{
+		Name: "leaf",
+		Exec: func(chain *CallChain, _ []string) error {
+			trace = append(trace, "exec:leaf")
+			return chain.AdvanceExec(1, nil)
+		},
+	}
+	root := &Command{
+		Name:        "root",
+		SubCommands: []*Command{leaf},
+		Exec: func(_ *CallChain, _ []string) error {
+			trace = append(trace, "exec:root")
+			return nil
+		},
+	}
+
+	cc, _, err := root.Resolve([]string{"leaf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the leaf starts the chain and advances to the root.
+	cc.Wrap(record("inner"))
+	cc.Wrap(record("outer"))
+	if err := cc.AdvanceExec(0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"outer:leaf", "inner:leaf", "exec:leaf", "outer:root", "inner:root", "exec:root"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Fatalf("unexpected trace: %v", trace)
+	}
+}
+
+func TestAdvanceExecResult(t *testing.T) {
+	var summary string
+	root := &Command{
+		Name: "root",
+		Exec: func(chain *CallChain, _ []string) error {
+			chain.SetResult(3)
+			return nil
+		},
+	}
+	leaf := &Command{
+		Name: "leaf",
+		Exec: func(chain *CallChain, _ []string) error {
+			res, err := chain.AdvanceExecResult(1, nil)
+			summary = fmt.Sprintf("%v updated", res)
+			return err
+		},
+	}
+	root.SubCommands = []*Command{leaf}
+
+	cc, _, err := root.Resolve([]string{"leaf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := cc.AdvanceExecResult(0, nil); err != nil || res != nil {
+		t.Fatalf("expected no result from leaf, got: %v %v", res, err)
+	}
+
+	if summary != "3 updated" {
+		t.Fatalf("unexpected summary: %v", summary)
+	}
+}
+
+func TestAbortSkip(t *testing.T) {
+	var executed []string
+	exec := func(name string, fn func(chain *CallChain) error) func(*CallChain, []string) error {
+		return func(chain *CallChain, _ []string) error {
+			executed = append(executed, name)
+			return fn(chain)
+		}
+	}
+
+	root := &Command{Name: "root", Exec: exec("root", func(_ *CallChain) error { return nil })}
+	mid := &Command{Name: "mid", Exec: exec("mid", func(chain *CallChain) error { return chain.AdvanceExec(1, nil) })}
+	leaf := &Command{Name: "leaf"}
+	root.SubCommands, mid.SubCommands = []*Command{mid}, []*Command{leaf}
+
+	t.Run("skip", func(t *testing.T) {
+		executed = nil
+		leaf.Exec = exec("leaf", func(chain *CallChain) error {
+			chain.Skip(1)
+			return chain.AdvanceExec(1, nil)
+		})
+
+		cc, _, err := root.Resolve([]string{"mid", "leaf"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := cc.AdvanceExec(0, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(executed, []string{"leaf", "root"}) {
+			t.Fatalf("expected mid to be skipped: %v", executed)
+		}
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		executed = nil
+		reason := errors.New("nothing to do")
+		leaf.Exec = exec("leaf", func(chain *CallChain) error {
+			chain.Abort(reason)
+			return chain.AdvanceExec(1, nil)
+		})
+
+		cc, _, err := root.Resolve([]string{"mid", "leaf"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var aborted ErrAborted
+		if err := cc.AdvanceExec(0, nil); !errors.As(err, &aborted) || aborted.Name != "leaf" || !errors.Is(err, reason) {
+			t.Fatalf("expected the chain to be aborted by leaf, got: %v", err)
+		}
+
+		if !reflect.DeepEqual(executed, []string{"leaf"}) {
+			t.Fatalf("expected only leaf to execute: %v", executed)
+		}
+	})
+}
+
+func TestCleanFlagReset(t *testing.T) {
+	type testCase struct {
+		reset    FlagReset
+		expected []string
+	}
+
+	testCases := []testCase{
+		{FlagResetVisited, []string{"default", "programmatic"}},
+		{FlagResetSticky, []string{"parsed", "programmatic"}},
+		{FlagResetAll, []string{"default", "default"}},
+	}
+
+	for _, tc := range testCases {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		parsed := fs.String("parsed", "default", "")
+		programmatic := fs.String("programmatic", "default", "")
+
+		cmd := &Command{Name: "test", FlagSet: fs, reset: tc.reset}
+		cc, err := cmd.parse([]string{"-parsed", "parsed"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		*programmatic = "programmatic"
+
+		cc.clean()
+		if got := []string{*parsed, *programmatic}; !reflect.DeepEqual(got, tc.expected) {
+			t.Fatalf("expected %v for policy %v but got %v", tc.expected, tc.reset, got)
+		}
+	}
+}
+
+func TestInvocationState(t *testing.T) {
+	var depth int
+	var recurse *Command
+	recurse = &Command{
+		Name:    "recurse",
+		FlagSet: flag.NewFlagSet("recurse", flag.ContinueOnError),
+		Exec: func(chain *CallChain, args []string) error {
+			// invoke the same command again while the outer invocation is still running.
+			if depth++; depth < 3 {
+				cc, err := recurse.parse([]string{"inner"})
+				if err != nil {
+					return err
+				}
+
+				if err := cc.AdvanceExec(0, nil); err != nil {
+					return err
+				}
+			}
+
+			if cur := chain.GetCurrent(); !reflect.DeepEqual(cur.Args(), args) {
+				t.Fatalf("invocation args were overwritten: %v != %v", cur.Args(), args)
+			}
+
+			return nil
+		},
+	}
+
+	cc, err := recurse.parse([]string{"outer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cc.AdvanceExec(0, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chainCommands returns the commands of the invocations in the call chain.
+func chainCommands(cc *CallChain) []*Command {
+	out := make([]*Command, len(*cc))
+	for i, inv := range *cc {
+		out[i] = inv.Command
+	}
+
+	return out
+}
+
+func TestCleanReleasesPooledChain(t *testing.T) {
+	sub := &Command{Name: "sub"}
+	root := &Command{Name: "root", SubCommands: []*Command{sub}}
+
+	chain, err := root.parseDepth([]string{"a", "sub", "b"}, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := chain.GetCurrent()
+	if leaf.Command != sub || leaf.block == nil {
+		t.Fatalf("expected the leaf of a pooled chain, got: %+v", leaf)
+	}
+
+	chain.clean()
+	if leaf.Command != nil || leaf.args != nil {
+		t.Fatal("expected clean to drop the references of the pooled chain")
+	}
+
+	chain, err = root.parse([]string{"sub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.clean()
+	if chain.GetCurrent().Command != sub {
+		t.Fatal("expected the chains handed out by parse not to be recycled")
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	leaf := &Command{Name: "leaf", FlagSet: flag.NewFlagSet("leaf", flag.ContinueOnError)}
+	mid := &Command{Name: "mid", FlagSet: flag.NewFlagSet("mid", flag.ContinueOnError), SubCommands: []*Command{leaf}}
+	root := &Command{Name: "root", FlagSet: flag.NewFlagSet("root", flag.ContinueOnError), SubCommands: []*Command{mid}}
+
+	args := []string{"a", "mid", "b", "leaf", "c"}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := root.parse(args); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPlainHelp(t *testing.T) {
+	fs := flag.NewFlagSet("plain", flag.ContinueOnError)
+	fs.Int("n", 1, "repetitions")
+
+	cmd := &Command{
+		Name:        "plain",
+		HelpLong:    "long help",
+		FlagSet:     fs,
+		SubCommands: []*Command{{Name: "sub", HelpShort: "sub help"}},
+	}
+
+	h := commandHelpFormater{theme: DefaultTheme, plain: true}
+	expected := "plain\n\nlong help\n\nFLAGS\n-n=1: repetitions\n\nSUBCOMMANDS\nsub: sub help\n"
+	if out := h.format(cmd, true); out != expected {
+		t.Fatalf("expected %q but got %q", expected, out)
+	}
+}
+
+func TestHelpWrap(t *testing.T) {
+	fs := flag.NewFlagSet("wrap", flag.ContinueOnError)
+	fs.Int("count", 1, "sets the number of times the command is repeated before giving up on the remote host")
+	fs.Bool("v", false, "verbose")
+
+	cmd := &Command{
+		Name:        "wrap",
+		HelpLong:    "wrap is a command with a long help text which doesnt fit in a narrow terminal pane.\nshort line",
+		FlagSet:     fs,
+		Exec:        func(_ *CallChain, _ []string) error { return nil },
+		SubCommands: []*Command{{Name: "sub", HelpShort: "a sub command with a description long enough to be wrapped"}},
+	}
+	if err := cmd.init(commandHelpFormater{width: 40}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `wrap
+
+wrap is a command with a long help text
+which doesnt fit in a narrow terminal
+pane.
+short line
+
+FLAGS
+-count=1  sets the number of times the
+          command is repeated before
+          giving up on the remote host
+-v=false  verbose
+
+SUBCOMMANDS
+sub  a sub command with a description
+     long enough to be wrapped
+`
+
+	if out := cmd.FormatHelp(cmd, true); out != expected {
+		t.Fatalf("unexpected wrapped help:\n%s", out)
+	}
+
+	// narrow widths arent wrapped.
+	if out := (commandHelpFormater{width: 10}).format(cmd, true); !strings.Contains(out, "-count=1  sets the number of times the command is repeated before giving up on the remote host\n") {
+		t.Fatalf("expected no wrapping, got:\n%s", out)
+	}
+}
+
+func TestHelpLayout(t *testing.T) {
+	cmd := &Command{
+		Name:    "layout",
+		FlagSet: flag.NewFlagSet("layout", flag.ContinueOnError),
+		SubCommands: []*Command{
+			{Name: "a", HelpShort: "a sub command with a description long enough to be truncated"},
+			{Name: "a-very-long-name", HelpShort: "short"},
+		},
+	}
+
+	h := commandHelpFormater{width: 40, layout: HelpLayout{Padding: 3, MinWidth: 4, MaxWidth: 8, Truncate: true}}
+	expected := "SUBCOMMANDS\n" +
+		"a      a sub command with a description…\n" +
+		"a-very-long-name\n" +
+		"       short\n"
+
+	if out := h.format(cmd, true); !strings.HasSuffix(out, expected) {
+		t.Fatalf("unexpected help layout:\n%s", out)
+	}
+}
+
+func TestHelpExamples(t *testing.T) {
+	cmd := &Command{
+		Name:      "deploy",
+		HelpShort: "deploys an app",
+		Examples: []Example{
+			{"deploy app1", "deploys app1"},
+			{"deploy -force app1", "deploys app1 even if it is up to date"},
+		},
+		Exec: func(_ *CallChain, _ []string) error { return nil },
+	}
+	if err := cmd.init(commandHelpFormater{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "deploy\n\nEXAMPLES\ndeploy app1         deploys app1\ndeploy -force app1  deploys app1 even if it is up to date\n"
+	if out := cmd.formatHelp(true); out != expected {
+		t.Fatalf("unexpected help: %q", out)
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	var running, peak int32
+	cmd := &Command{
+		Name: "mutate",
+		Exec: func(_ *CallChain, _ []string) error {
+			n := atomic.AddInt32(&running, 1)
+			for p := atomic.LoadInt32(&peak); n > p; p = atomic.LoadInt32(&peak) {
+				if atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		},
+	}
+	if err := cmd.init(commandHelpFormater{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// executes cmd from 3 concurrent call chains and returns the peak of concurrent executions.
+	execConcurrently := func() int32 {
+		atomic.StoreInt32(&peak, 0)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cc := CallChain{{Command: cmd}}
+				if err := cc.AdvanceExec(0, nil); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		return atomic.LoadInt32(&peak)
+	}
+
+	if peak := execConcurrently(); peak < 2 {
+		t.Fatalf("expected the executions to overlap without Serialize, got a peak of %d", peak)
+	}
+
+	cmd.Serialize = true
+	if peak := execConcurrently(); peak != 1 {
+		t.Fatalf("expected the executions to be serialized, got a peak of %d", peak)
+	}
+}
+
+func TestSerializeReentrant(t *testing.T) {
+	var nestedErr error
+	var self *Command
+	self = &Command{
+		Name:      "self",
+		Serialize: true,
+		Exec: func(chain *CallChain, args []string) error {
+			if len(args) > 0 {
+				return nil
+			}
+
+			cc, err := self.parse([]string{"again"})
+			if err != nil {
+				return err
+			}
+			nestedErr = cc.AdvanceExec(0, chain.GetCurrent().Context())
+			return nil
+		},
+	}
+	if err := self.init(commandHelpFormater{}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		cc := CallChain{{Command: self}}
+		done <- cc.AdvanceExec(0, context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the reentrant execution not to deadlock")
+	}
+
+	if !errors.As(nestedErr, &ErrReentrant{}) {
+		t.Fatalf("expected %T, got: %v", ErrReentrant{}, nestedErr)
+	}
+}
+
+func TestInvocationFlag(t *testing.T) {
+	fs := flag.NewFlagSet("count", flag.ContinueOnError)
+	n := fs.Int("n", 1, "")
+	tags := StringSliceFlag(fs, "tag", nil, "")
+
+	cmd := &Command{Name: "count", FlagSet: fs, Exec: func(_ *CallChain, _ []string) error { return nil }}
+	if err := cmd.init(commandHelpFormater{}); err != nil {
+		t.Fatal(err)
+	}
+
+	outer, err := cmd.parse([]string{"-n", "2", "-tag", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a nested invocation of the same command overwrites the shared variables but not the values of the outer one.
+	inner, err := cmd.parse([]string{"-n", "5", "-tag", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner.clean()
+
+	if v, ok := outer.GetCurrent().Flag("n"); !ok || v != 2 || *n == 2 {
+		t.Fatalf("expected the outer invocation to keep -n 2, got %v (shared %v)", v, *n)
+	}
+	if v, _ := outer.GetCurrent().Flag("tag"); !reflect.DeepEqual(v, []string{"a"}) || len(*tags) != 0 {
+		t.Fatalf("expected the outer invocation to keep -tag a, got %v (shared %v)", v, *tags)
+	}
+	if _, ok := outer.GetCurrent().Flag("missing"); ok {
+		t.Fatal("expected no value for an undefined flag")
+	}
+}
+
+func TestInvocationConfirm(t *testing.T) {
+	cmd := &Command{Name: "rm", Confirm: "remove?", Exec: func(_ *CallChain, _ []string) error { return nil }}
+	if err := cmd.init(commandHelpFormater{}); err != nil {
+		t.Fatal(err)
+	}
+
+	outer, err := cmd.parse([]string{"-y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner, err := cmd.parse(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !outer.GetCurrent().yes || inner.GetCurrent().yes {
+		t.Fatalf("expected only the invocation with -y to skip the prompt, got %v and %v", outer.GetCurrent().yes, inner.GetCurrent().yes)
+	}
+
+	// a -y flag defined by the command doesnt skip the prompt.
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	fs.Bool("y", false, "")
+	own := &Command{Name: "rm", Confirm: "remove?", FlagSet: fs, Exec: cmd.Exec}
+	if err := own.init(commandHelpFormater{}); err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := own.parse([]string{"-y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.GetCurrent().yes {
+		t.Fatal("expected the own -y flag of the command not to skip the prompt")
+	}
+}
+
+func TestParseErrorCleansFlags(t *testing.T) {
+	fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+	fs.SetOutput(nopReadWriter{})
+	tags := StringSliceFlag(fs, "tag", nil, "")
+	fs.Int("n", 0, "")
+
+	subFs := flag.NewFlagSet("sub", flag.ContinueOnError)
+	subFs.SetOutput(nopReadWriter{})
+	subFs.Int("n", 0, "")
+
+	var got []string
+	d := &Dialogue{W: nopReadWriter{}}
+	d.RegisterCommands(&Command{
+		Name:    "tag",
+		FlagSet: fs,
+		Exec: func(_ *CallChain, _ []string) error {
+			got = append(got, *tags...)
+			return nil
+		},
+		SubCommands: []*Command{{Name: "sub", FlagSet: subFs, Exec: func(_ *CallChain, _ []string) error { return nil }}},
+	})
+
+	// the bad lines set -tag before failing, in the command itself and in its sub command.
+	for _, line := range []string{"tag -tag a -n x", "tag", "tag -tag b sub -n x", "tag"} {
+		if err := d.Execute(context.Background(), line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(got) != 0 {
+		t.Fatalf("expected the flags of the bad lines to be cleaned, got: %v", got)
+	}
+}
@@ -0,0 +1,220 @@
+package dialogue
+
+import (
+	"context"
+	"flag"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Suggestion is a completion of the token being completed, Text replaces the whole token.
+type Suggestion struct {
+	Text        string
+	Description string // Description is an optional short description of the suggestion, such as the help of a command.
+}
+
+// Completer completes the token ending at pos in line. Implement it to layer domain specific sources (such as table names)
+// over the default completer of the dialogue or to replace it altogether, see Dialogue.Completer.
+type Completer interface {
+	Complete(ctx context.Context, line string, pos int) ([]Suggestion, error)
+}
+
+// CompleterFunc is an adapter to allow the use of ordinary functions as completers.
+type CompleterFunc func(ctx context.Context, line string, pos int) ([]Suggestion, error)
+
+func (f CompleterFunc) Complete(ctx context.Context, line string, pos int) ([]Suggestion, error) {
+	return f(ctx, line, pos)
+}
+
+// MultiCompleter layers completers, it returns the suggestions of every completer in order. The first error is returned.
+func MultiCompleter(completers ...Completer) Completer {
+	return CompleterFunc(func(ctx context.Context, line string, pos int) ([]Suggestion, error) {
+		var out []Suggestion
+		for _, c := range completers {
+			s, err := c.Complete(ctx, line, pos)
+			if err != nil {
+				return nil, err
+			}
+
+			out = append(out, s...)
+		}
+
+		return out, nil
+	})
+}
+
+// Complete completes the token ending at pos in line using Completer or the default completer if nil.
+func (d *Dialogue) Complete(ctx context.Context, line string, pos int) ([]Suggestion, error) {
+	if d.Completer != nil {
+		return d.Completer.Complete(ctx, line, pos)
+	}
+
+	return d.DefaultCompleter().Complete(ctx, line, pos)
+}
+
+// DefaultCompleter returns the default completer of the dialogue, wrap it to layer more suggestions over it.
+//
+// It completes command names for the first token, sub command names for the following ones and flag names for tokens
+// starting with "-". The values of flags are completed after "-flag=" or after a non boolean flag using
+// Command.CompleteFlag, or the choices of EnumFlag flags. The suggestions are sorted, the commands of the namespace selected
+// by UseCmd come first without their prefix.
+func (d *Dialogue) DefaultCompleter() Completer {
+	return commandCompleter{d}
+}
+
+// commandCompleter completes the commands of a dialogue and their flags.
+type commandCompleter struct {
+	d *Dialogue
+}
+
+func (c commandCompleter) Complete(ctx context.Context, line string, pos int) ([]Suggestion, error) {
+	c.d.mu.Lock()
+	commands := c.d.enabledCommands(ctx)
+	c.d.mu.Unlock()
+
+	if pos < 0 || pos > len(line) {
+		pos = len(line)
+	}
+	before := line[:pos]
+
+	// the token being completed is empty if the cursor follows a space.
+	fields := strings.Fields(before)
+	var cur string
+	if r, _ := utf8.DecodeLastRuneInString(before); len(fields) > 0 && !unicode.IsSpace(r) {
+		cur, fields = fields[len(fields)-1], fields[:len(fields)-1]
+	}
+
+	if len(fields) == 0 {
+		var out []Suggestion
+		// the commands of the current namespace are completed first and without the prefix.
+		var local []Suggestion
+		ns := c.d.namespace.get() + namespaceSep
+		for _, cmd := range sortCommands(commands) {
+			if name := strings.TrimPrefix(cmd.Name, ns); ns != namespaceSep && name != cmd.Name && strings.HasPrefix(name, cur) {
+				local = append(local, Suggestion{name, cmd.HelpShort})
+			}
+
+			// shadowed by a command of the namespace.
+			if _, ok := c.d.namespace.resolve(cmd.Name, commands); ok {
+				continue
+			}
+
+			if strings.HasPrefix(cmd.Name, cur) {
+				out = append(out, Suggestion{cmd.Name, cmd.HelpShort})
+			}
+		}
+
+		return append(local, out...), nil
+	}
+
+	cmdName := fields[0]
+	if resolved, ok := c.d.namespace.resolve(cmdName, commands); ok {
+		cmdName = resolved
+	}
+
+	cmd, ok := commands[cmdName]
+	if !ok {
+		return nil, nil
+	}
+
+	// walk the sub commands skipping the flags and their values.
+	var pending *flag.Flag
+	for _, tok := range fields[1:] {
+		switch {
+		case pending != nil:
+			pending = nil
+		case tok == "--":
+			return nil, nil // pass-through args are never completed.
+		case strings.HasPrefix(tok, "-"):
+			if name := strings.TrimLeft(tok, "-"); !strings.Contains(name, "=") {
+				if f := cmd.lookupFlag(name); f != nil && !isBoolFlag(f) {
+					pending = f
+				}
+			}
+		default:
+			if sub := cmd.subCommand(tok); sub != nil {
+				cmd = sub
+			}
+		}
+	}
+
+	if pending != nil {
+		return cmd.completeFlagValue(pending, "", cur), nil
+	}
+
+	if !strings.HasPrefix(cur, "-") {
+		var out []Suggestion
+		for _, sub := range cmd.SubCommands {
+			if strings.HasPrefix(sub.Name, cur) {
+				out = append(out, Suggestion{sub.Name, sub.HelpShort})
+			}
+		}
+		sort.Slice(out, func(i, j int) bool {
+			return out[i].Text < out[j].Text
+		})
+
+		return out, nil
+	}
+
+	name := strings.TrimLeft(cur, "-")
+	dashes := cur[:len(cur)-len(name)]
+	if name, value, ok := strings.Cut(name, "="); ok {
+		f := cmd.lookupFlag(name)
+		if f == nil {
+			return nil, nil
+		}
+
+		return cmd.completeFlagValue(f, dashes+name+"=", value), nil
+	}
+
+	var out []Suggestion
+	if cmd.FlagSet != nil {
+		cmd.FlagSet.VisitAll(func(f *flag.Flag) {
+			if strings.HasPrefix(f.Name, name) {
+				out = append(out, Suggestion{dashes + f.Name, f.Usage})
+			}
+		})
+	}
+
+	return out, nil
+}
+
+// lookupFlag looks up the flag of the command named name, it returns nil if the command has no such flag.
+func (c *Command) lookupFlag(name string) *flag.Flag {
+	if c.FlagSet == nil {
+		return nil
+	}
+
+	return c.FlagSet.Lookup(name)
+}
+
+// completeFlagValue completes the value of f starting with prefix, every completion is prefixed by lead.
+func (c *Command) completeFlagValue(f *flag.Flag, lead, prefix string) []Suggestion {
+	var values []string
+	if c.CompleteFlag != nil {
+		values = c.CompleteFlag(f.Name, prefix)
+	}
+	if ch, ok := f.Value.(choicer); ok && values == nil {
+		values = ch.Choices()
+	}
+
+	var out []Suggestion
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			out = append(out, Suggestion{Text: lead + v})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Text < out[j].Text
+	})
+
+	return out
+}
+
+// isBoolFlag reports if f doesnt take a value, like the flags defined by flag.Bool.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
@@ -0,0 +1,106 @@
+package dialogue
+
+import (
+	"context"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	fs.Bool("force", false, "")
+	fs.String("format", "", "")
+	fs.String("region", "", "")
+	EnumFlag(fs, "env", []string{"dev", "prod", "staging"}, "dev", "")
+
+	d := &Dialogue{}
+	d.RegisterCommands(
+		&Command{
+			Name:    "deploy",
+			FlagSet: fs,
+			CompleteFlag: func(name, _ string) []string {
+				if name == "region" {
+					return []string{"eu-west", "eu-north", "us-east"}
+				}
+				return nil
+			},
+			SubCommands: []*Command{{Name: "app"}, {Name: "apply"}, {Name: "db"}},
+		},
+		&Command{Name: "describe"},
+		&Command{Name: "quit"},
+	)
+
+	type testCase struct {
+		line string
+		want []string
+	}
+
+	testCases := []testCase{
+		{"", []string{"deploy", "describe", "quit"}},
+		{"de", []string{"deploy", "describe"}},
+		{"deploy ", []string{"app", "apply", "db"}},
+		{"deploy ap", []string{"app", "apply"}},
+		{"deploy -f", []string{"-force", "-format"}},
+		{"deploy --fo", []string{"--force", "--format"}},
+		{"deploy -region=eu", []string{"-region=eu-north", "-region=eu-west"}},
+		{"deploy -region ", []string{"eu-north", "eu-west", "us-east"}},
+		{"deploy -force ", []string{"app", "apply", "db"}},
+		{"deploy --env=p", []string{"--env=prod"}},
+		{"deploy -- ", nil},
+		{"unknown ", nil},
+	}
+
+	for _, tc := range testCases {
+		if got := completeTexts(t, d, tc.line, len(tc.line)); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("Complete(%q): expected %v, got %v", tc.line, tc.want, got)
+		}
+	}
+
+	// completes the token at the cursor.
+	if got := completeTexts(t, d, "deploy -fo app", 10); !reflect.DeepEqual(got, []string{"-force", "-format"}) {
+		t.Fatalf("unexpected completions at cursor: %v", got)
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	d := &Dialogue{}
+	d.RegisterCommands(&Command{Name: "select", HelpShort: "queries a table"})
+
+	tables := CompleterFunc(func(_ context.Context, line string, _ int) ([]Suggestion, error) {
+		if strings.HasPrefix(line, "select ") {
+			return []Suggestion{{Text: "users"}, {Text: "orders"}}, nil
+		}
+
+		return nil, nil
+	})
+	d.Completer = MultiCompleter(d.DefaultCompleter(), tables)
+
+	got, err := d.Complete(context.Background(), "sel", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []Suggestion{{"select", "queries a table"}}) {
+		t.Fatalf("unexpected suggestions: %v", got)
+	}
+
+	if got := completeTexts(t, d, "select ", 7); !reflect.DeepEqual(got, []string{"users", "orders"}) {
+		t.Fatalf("unexpected suggestions: %v", got)
+	}
+}
+
+// completeTexts returns the text of the suggestions of d.
+func completeTexts(t *testing.T, d *Dialogue, line string, pos int) []string {
+	suggestions, err := d.Complete(context.Background(), line, pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out []string
+	for _, s := range suggestions {
+		out = append(out, s.Text)
+	}
+
+	return out
+}
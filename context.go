@@ -2,12 +2,174 @@ package dialogue
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"time"
 )
 
 type outKey struct{}
 
+type lastOutputKey struct{}
+
+type previousOutputsKey struct{}
+
+type recentInputKey struct{}
+
+type shutdownKey struct{}
+
+type lineReaderKey struct{}
+
+// OutFromContext returns the writer of the dialogue which dispatched the current command. Unlike W, the output written to it
+// is captured and available to the next command via LastOutputFromContext.
 func OutFromContext(ctx context.Context) (io.Writer, bool) {
 	v, ok := ctx.Value(outKey{}).(io.Writer)
 	return v, ok
 }
+
+type lineKey struct{}
+
+type redactedLineKey struct{}
+
+type verbosityKey struct{}
+
+type dryRunKey struct{}
+
+// dispatchContext carries the values of a single dispatch. It avoids allocating (and boxing) every value on every dispatch
+// like chained context.WithValue calls would.
+type dispatchContext struct {
+	context.Context
+	line      string
+	verbosity Verbosity
+	dryRun    bool
+	out       io.Writer
+	last      string
+	outputs   *outputCapture // outputs holds the ring of the previous outputs, see PreviousOutputsFromContext.
+	term      TermSize
+	recent    *inputRing
+	shutdown  <-chan struct{}
+	redact    func(string) string // redact is Dialogue.Redact, applied to line on demand.
+}
+
+func (c *dispatchContext) Value(key any) any {
+	switch key {
+	case lineKey{}:
+		return c.line
+	case redactedLineKey{}:
+		if c.redact == nil {
+			return c.line
+		}
+		return c.redact(c.line)
+	case verbosityKey{}:
+		return c.verbosity
+	case dryRunKey{}:
+		return c.dryRun
+	case outKey{}:
+		return c.out
+	case lastOutputKey{}:
+		return c.last
+	case previousOutputsKey{}:
+		return c.outputs
+	case termSizeKey{}:
+		return c.term
+	case recentInputKey{}:
+		return c.recent
+	case shutdownKey{}:
+		return c.shutdown
+	}
+
+	return c.Context.Value(key)
+}
+
+// LineFromContext returns the raw line read from the dialogue reader which triggered the current command or CommandNotFound
+// call, before any tokenization.
+func LineFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(lineKey{}).(string)
+	return v, ok
+}
+
+// RedactedLineFromContext is like LineFromContext but the line is rewritten by Dialogue.Redact, use it to log or audit the
+// line from middleware and hooks such as OnError.
+func RedactedLineFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(redactedLineKey{}).(string)
+	return v, ok
+}
+
+// VerbosityFromContext returns the dialogue verbosity at the time the current command was dispatched. VerbosityNormal is
+// returned if the context doesnt carry a verbosity.
+func VerbosityFromContext(ctx context.Context) Verbosity {
+	v, _ := ctx.Value(verbosityKey{}).(Verbosity)
+	return v
+}
+
+// DryRunFromContext reports if the dialogue was in dry-run mode when the current command was dispatched. Commands which
+// support dry-run should only report what they would do when it returns true.
+func DryRunFromContext(ctx context.Context) bool {
+	v, _ := ctx.Value(dryRunKey{}).(bool)
+	return v
+}
+
+// LastOutputFromContext returns the output of the command dispatched before the current one, such as the output of a
+// query to filter in the current command. Only the output written by the dialogue and to OutFromContext is captured, up to
+// Dialogue.LastOutputLimit bytes.
+func LastOutputFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(lastOutputKey{}).(string)
+	return v, ok
+}
+
+// PreviousOutputsFromContext returns the outputs of the commands dispatched before the current one newest first, up to
+// Dialogue.LastOutputs of them. The first output is the one returned by LastOutputFromContext.
+func PreviousOutputsFromContext(ctx context.Context) []string {
+	c, ok := ctx.Value(previousOutputsKey{}).(*outputCapture)
+	if !ok || c == nil {
+		return nil
+	}
+
+	return c.previousOutputs()
+}
+
+// RecentInputFromContext returns the last raw lines read by the dialogue oldest first, up to Dialogue.RecentInputLimit
+// lines, including the line of the current command. Commands such as a bug report can attach the interaction leading up
+// to a failure without recording a transcript.
+func RecentInputFromContext(ctx context.Context) []string {
+	r, ok := ctx.Value(recentInputKey{}).(*inputRing)
+	if !ok {
+		return nil
+	}
+
+	return r.get()
+}
+
+// ShuttingDown reports whether Shutdown, or Close with CloseCooperative, was called on the dialogue which dispatched the
+// current command. Long running commands can poll it to checkpoint and return early instead of being cancelled once the
+// grace period of the shutdown expires.
+func ShuttingDown(ctx context.Context) bool {
+	shutdown, _ := ctx.Value(shutdownKey{}).(<-chan struct{})
+	select {
+	case <-shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// DeadlineBanner returns a short notice of the time left before the deadline of ctx such as "12s left", commands and
+// middleware can write it to warn the users of long running operations gated by a deadline (see CommandContext). An empty
+// string is returned if ctx has no deadline.
+func DeadlineBanner(ctx context.Context) string {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ""
+	}
+
+	left := time.Until(deadline)
+	switch {
+	case left <= 0:
+		return "deadline exceeded"
+	case left < time.Second:
+		left = left.Round(time.Millisecond)
+	default:
+		left = left.Round(time.Second)
+	}
+
+	return fmt.Sprintf("%v left", left)
+}
@@ -1,20 +1,99 @@
 package dialogue
 
 import (
-	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"os"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
 )
 
-// ErrDialogueClosed is returned by Open() indicating a closed dialogue.
+// ErrDialogueClosed is returned by Open() indicating a closed dialogue. Open wraps it to tell how the dialogue was closed,
+// use errors.Is to check for it.
 var ErrDialogueClosed = errors.New("dialogue: dialogue closed")
 
+var (
+	// ErrClosed is returned by Open after a call to Close, it wraps ErrDialogueClosed.
+	ErrClosed = fmt.Errorf("%w by Close", ErrDialogueClosed)
+
+	// ErrShutdown is returned by Open after a call to Shutdown, it wraps ErrDialogueClosed.
+	ErrShutdown = fmt.Errorf("%w by Shutdown", ErrDialogueClosed)
+
+	// ErrEOF is returned by Open when the reader is exhausted.
+	ErrEOF = errors.New("dialogue: reader reached EOF")
+
+	// ErrNoInput is returned when a command needs to read from R, to confirm it or to stop watching, but it wasnt
+	// dispatched by Open, for example by Execute. Use -y to bypass the confirmation.
+	ErrNoInput = errors.New("dialogue: cant read from R outside of Open")
+)
+
+// ErrTerminatedByCommand is returned by Open when a command returns an error, which includes the quit command returning
+// ErrDialogueClosed and commands returning Exit. Err is the error returned by the command named Name.
+type ErrTerminatedByCommand struct {
+	Name string
+	Err  error
+}
+
+func (e ErrTerminatedByCommand) Error() string {
+	return fmt.Sprintf("dialogue: terminated by %v: %v", e.Name, e.Err)
+}
+
+func (e ErrTerminatedByCommand) Unwrap() error {
+	return e.Err
+}
+
+// ExitError requests the termination of the dialogue, see Exit.
+type ExitError struct {
+	Code int
+	Msg  string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("dialogue: exit status %d: %v", e.Code, e.Msg)
+}
+
+// Is reports ExitError as ErrDialogueClosed.
+func (e *ExitError) Is(target error) bool {
+	return target == ErrDialogueClosed
+}
+
+// Exit returns an error which terminates the dialogue cleanly when returned from a command, like ErrDialogueClosed but with
+// a message and a status code. Open writes the message to W and returns the error wrapped in ErrTerminatedByCommand, the
+// status code can be retrieved with Dialogue.ExitStatus.
+func Exit(code int, msg string) error {
+	return &ExitError{code, msg}
+}
+
+// ClosePolicy controls what Close does with the command running when it is called, see Dialogue.ClosePolicy.
+type ClosePolicy int
+
+const (
+	// CloseWait cancels the base context, and so the context of the running command, and waits for the command to return.
+	// The read blocked on R is cancelled: the preamptive reader keeps what it reads for the next session. This is the
+	// default.
+	CloseWait ClosePolicy = iota
+
+	// CloseDetach is like CloseWait but waits at most CloseTimeout for the running command. Once the timeout expires Close
+	// and Open return while the command keeps running in the background with a cancelled context: it still holds the
+	// dispatching lock so the first dispatch of the next session waits for it, and its output is still written to W. The
+	// preamptive reader behaves like with CloseWait.
+	CloseDetach
+
+	// CloseCooperative doesnt cancel the running command, Close waits for it to return on its own and ShuttingDown reports
+	// true in its context. The base context is cancelled once the command returns, or right away when no command is
+	// running, so a read blocked on R is cancelled like with CloseWait.
+	CloseCooperative
+)
+
 // Dialogue describes a back and forth discussion between the provided reader and writer.
 type Dialogue struct {
 	// Prefix is an optional but recommended field which gets outputed before every read from R.
@@ -29,8 +108,104 @@ type Dialogue struct {
 	// which include: the default CommandNotFound and HelpCmd implementations.
 	W io.Writer
 
+	// Werr optionally recieves the diagnostics of the dialogue instead of W, so networked frontends and tests can tell them
+	// apart from the output: the errors reported for the commands, the parse errors of the builtins, the deprecation
+	// notices of RedirectTo and the notices of the dialogue. Custom renderers still render them with PrintError.
+	//
+	// If nil the diagnostics are written to W.
+	Werr io.Writer
+
+	// WriteTimeout optionally bounds every write to W if W supports write deadlines, as net.Conn does, so a stalled client
+	// cant hang the dialogue. The writes which time out are handled according to StallPolicy.
+	WriteTimeout time.Duration
+
+	// WriteBuffer optionally buffers up to WriteBuffer bytes of output which are written to W in the background, so the
+	// dispatches only wait for W once the buffer is full. The buffer is flushed when the session ends.
+	WriteBuffer int
+
+	// StallPolicy controls what happens to the output when W doesnt keep up with it, see StallPolicy. The stalls are
+	// reported to OnError as ErrWriteStalled.
+	StallPolicy StallPolicy
+
+	// Renderer optionally renders the output of the default handlers and builtin commands (errors, notices, help and
+	// prompts) instead of writing it to W, see Renderer.
+	Renderer Renderer
+
+	// Interactive optionally forces the interactive or the non interactive mode. By default the dialogue is only non
+	// interactive when R is a file or a pipe which isnt a terminal, such as a script piped to stdin: the other readers such
+	// as network connections are interactive, as is a dialogue with a LineReader. In non interactive mode the prompt isnt
+	// written, the default theme has no colors and ExitStatus reports whether any command failed once R is exhausted.
+	Interactive *bool
+
+	// Quiet suppresses the prompt and the notices of the dialogue (such as the interrupt notice of HandleSignals) while the
+	// output of the commands and the errors are still written, for expect-style automation driving the dialogue over a pipe.
+	// Unlike the non interactive mode it doesnt change the theme or the exit status.
+	Quiet bool
+
+	// EchoInput writes every line read from R, preceded by Prefix or "> " if Prefix is empty, before dispatching it. The
+	// logs of non interactive sessions then show which line produced which output.
+	EchoInput bool
+
+	// Transcript optionally recieves a timestamped copy of the session for compliance logging, independent of W: one line per
+	// prompt, input line read from R and line of output written to W by the dialogue or to OutFromContext:
+	//
+	//	2024-01-02T15:04:05.000Z input: echo hi
+	//	2024-01-02T15:04:05.001Z output: hi
+	//
+	// The write errors of Transcript are ignored.
+	Transcript io.Writer
+
+	// Redact optionally rewrites the lines read from R before they are recorded, so the secrets typed as arguments such as
+	// tokens and passwords dont persist in plain text. The redacted line is written to the history, the transcript, the
+	// echo of EchoInput, the recent input and the line passed to OnUnknownCommand, the lines of the trace and the
+	// scheduled lines are redacted as well. Middleware and hooks read the redacted line with RedactedLineFromContext.
+	//
+	// The commands are dispatched with the line as typed. The lines changed by Redact arent recorded into macros, which
+	// replay the lines as typed, the error is reported instead.
+	//
+	//	Redact: func(line string) string {
+	//		return tokenRegexp.ReplaceAllString(line, "--token ***")
+	//	}
+	Redact func(line string) string
+
+	// RedrawInterval is the minimum interval between the redraws of the prompt after the output written while the dialogue
+	// waits for a line, such as the output of the schedules, so bursts of output redraw the prompt once instead of after
+	// every write. It defaults to 50ms.
+	RedrawInterval time.Duration
+
+	// Encoding optionally converts the bytes read from R to UTF-8 before they are scanned, for example UTF16LE for the
+	// Windows pipes or Windows1252 for some telnet clients. R is expected to be UTF-8 by default.
+	Encoding Decoder
+
+	// ControlChars controls what happens to the control characters of the lines read by the dialogue, they are stripped
+	// by default. The lines of R end on "\n", "\r\n" or a lone "\r".
+	ControlChars ControlChars
+
+	// MaxLineLength, MaxTokens and MaxDepth optionally cap the length in bytes of the lines read by the dialogue, their
+	// number of tokens and the number of commands of their call chains, so a hostile remote client cant allocate unbounded
+	// memory. The lines which exceed a limit are reported as ErrInputLimit and dropped. The default line reader drops the
+	// long lines while reading them, without MaxLineLength it ends the dialogue on lines longer than 64KiB.
+	MaxLineLength int
+	MaxTokens     int
+	MaxDepth      int
+
+	// ValidateLine is an optional hook which validates the fields of every dispatched line before the command is resolved,
+	// use it to enforce global policies such as blocked words or a read only maintenance mode in one place. The returned
+	// error is reported like the argument validation errors and the line isnt dispatched. The lines expanded from aliases
+	// and redirected commands are validated again.
+	ValidateLine func(fields []string) error
+
+	// LineReader optionally replaces the default line reader, which writes the prompt to W and scans the lines of R, to plug
+	// in a line editing library. R is unused when LineReader is set.
+	LineReader LineReader
+
+	// Evaluator optionally evaluates the lines which dont match any command or alias, it takes precedence over
+	// OnUnknownCommand and CommandNotFound. The result is written with the renderer.
+	Evaluator Evaluator
+
 	// CommandNotFound handels commands which arent mapped to anything. The ctx is the base context and the args are the full
-	// fields read from R including the command name.
+	// fields read from R including the command name. The original unparsed line is available via LineFromContext(ctx).
+	// Like the args of Exec, the args are recycled once the line is dispatched.
 	//
 	// If nil the default CommandNotFound will be used which will call FormatHelp.
 	CommandNotFound func(ctx context.Context, args []string) error
@@ -56,6 +231,217 @@ type Dialogue struct {
 	// of a help command using your own *dialogue.Command.
 	HelpCmd string
 
+	// VerbosityCmd is an optional field, it creates a command which shows or sets the dialogue wide verbosity:
+	//
+	// <VerbosityCmd> [-v | -q | quiet | normal | verbose]
+	//
+	// Commands read the current verbosity via VerbosityFromContext and adjust their output accordingly.
+	VerbosityCmd string
+
+	// Verbosity is the initial verbosity of the dialogue, set every time the dialogue is opened.
+	Verbosity Verbosity
+
+	// TraceCmd is an optional field, it creates a command which shows or toggles the trace mode:
+	//
+	// <TraceCmd> [on | off]
+	TraceCmd string
+
+	// Trace is the initial trace mode of the dialogue, set every time the dialogue is opened. In trace mode the resolved
+	// path of every call chain, the parsed flag values and the remaining args of each command are written to W before the
+	// chain is executed, similar to the shell "set -x".
+	Trace bool
+
+	// DryRunCmd is an optional field, it creates a command which shows or toggles the dry-run mode:
+	//
+	// <DryRunCmd> [on | off]
+	DryRunCmd string
+
+	// DryRun is the initial dry-run mode of the dialogue, set every time the dialogue is opened. The dialogue doesnt enforce
+	// anything in dry-run mode, commands read the mode via DryRunFromContext and should only report what they would do. Mark
+	// the commands which honour it with Command.SupportsDryRun.
+	DryRun bool
+
+	// UndoCmd is an optional field, it creates a command which reverts the last command executed in the current session
+	// using the Undo functions of the commands (see Command.Undo):
+	//
+	// <UndoCmd>
+	//
+	// The undo stack is cleared every time the dialogue is opened.
+	UndoCmd string
+
+	// BeginCmd, CommitCmd and AbortCmd are optional fields, they create the commands which control transactions. Between
+	// begin and commit the dispatched commands are parsed, validated and confirmed immediately but queued instead of
+	// executed. Commit executes the queued commands in order and abort discards them:
+	//
+	// <BeginCmd>
+	//
+	// <CommitCmd>
+	//
+	// <AbortCmd>
+	//
+	// If a queued command fails at commit, the commands of the transaction executed before it are reverted with their Undo
+	// functions (see Command.Undo) and the error is reported. Only the commands which implement Undo can be rolled back. A
+	// queued command ending the session, for example with Exit, ends it without a rollback. The builtin commands and the
+	// lines dispatched by a running command, such as the lines of RepeatCmd, are never queued.
+	BeginCmd, CommitCmd, AbortCmd string
+
+	// RecordCmd and PlayCmd are optional fields, they create the commands which record and replay macros:
+	//
+	// <RecordCmd> start <macro-name> | <RecordCmd> stop
+	//
+	// <PlayCmd> [macro-name]
+	//
+	// The recorded lines are replayed through the normal dispatch path, the names of the macros are listed by PlayCmd and
+	// by the help command.
+	RecordCmd, PlayCmd string
+
+	// HistoryFile is an optional path to a file where the lines read by the dialogue are appended. The file uses the plain
+	// text format of GNU readline and bash so it can be shared with shell tooling, it is loaded when the dialogue is opened.
+	// Without a HistoryFile the history is persisted in Store, if any. See History.
+	HistoryFile string
+
+	// HistoryTimestamps precedes every line appended to HistoryFile with a "#<unix seconds>" timestamp comment, like bash
+	// does when HISTTIMEFORMAT is set. Timestamp comments are always understood when loading the file.
+	HistoryTimestamps bool
+
+	// HistorySize is the number of lines kept in the history, like HISTSIZE of bash. The older lines are dropped from the
+	// history as lines are read, from Store as well, and from HistoryFile when the dialogue is opened. Defaults to 500.
+	HistorySize int
+
+	// HandleSignals installs a signal policy while the dialogue is open, replacing the usual boilerplate:
+	//
+	// SIGINT cancels the context of the running command, a second SIGINT (before the next command starts) closes the
+	// dialogue.
+	//
+	// SIGTERM shuts the dialogue down gracefully, waiting at most ShutdownGrace.
+	//
+	// SIGQUIT writes a summary of the state of the dialogue to W instead of exiting.
+	HandleSignals bool
+
+	// ShutdownGrace is the grace period of the shutdown triggered by SIGTERM when HandleSignals is set. Defaults to 5 seconds.
+	ShutdownGrace time.Duration
+
+	// HandleCancelKey makes CancelKey cancel the context of the command dispatched from R, without closing the dialogue, so
+	// a hung command can be aborted. It is meant for terminals in raw mode and network clients which send the key as input
+	// instead of raising SIGINT. R is read ahead while the commands run to see the key, the key is removed from the input
+	// once it is decoded with Encoding. The read ahead stops with the session, like the reads of the dialogue the last read
+	// of R is left to return on its own and its bytes are kept for the next session.
+	HandleCancelKey bool
+
+	// CancelKey is the byte of R handled by HandleCancelKey. Defaults to KeyCtrlC.
+	CancelKey byte
+
+	// DrainOnShutdown makes Shutdown dispatch the complete lines which the default line reader already read from R after
+	// the current command, so the commands the user already submitted arent discarded. The lines are dispatched until
+	// the buffer is drained or the shutdown context expires, nothing more is read from R.
+	DrainOnShutdown bool
+
+	// ClosePolicy controls what Close does with the running command, see ClosePolicy. Shutdown isnt affected.
+	ClosePolicy ClosePolicy
+
+	// CloseTimeout is how long Close waits for the running command with CloseDetach. Defaults to 5 seconds.
+	CloseTimeout time.Duration
+
+	// Completer optionally replaces the default completer used by Complete, see DefaultCompleter to layer suggestions over
+	// the default ones.
+	Completer Completer
+
+	// Store optionally persists the user state of the dialogue across restarts: the recorded macros, the aliases, the
+	// variables set with EnvCmd and, unless HistoryFile is set, the history. The state is loaded when the dialogue is opened.
+	// Use NewMemoryStore, OpenFileStore or your own StateStore implementation.
+	Store StateStore
+
+	// EveryCmd, SchedulesCmd and UnscheduleCmd are optional fields, they create the commands which dispatch command lines
+	// periodically in the background, list the schedules and stop them:
+	//
+	// <EveryCmd> <interval> <command-line>
+	//
+	// <SchedulesCmd>
+	//
+	// <UnscheduleCmd> <schedule-id>
+	//
+	// The scheduled dispatches are serialized with the dispatches of the lines read from R and their output is preceded
+	// by the id of the schedule. Scheduled commands which require confirmation have to be bypassed with -y. The schedules
+	// can only be started while the dialogue is open, they are stopped by Close, Shutdown and Reset and when Open returns.
+	EveryCmd, SchedulesCmd, UnscheduleCmd string
+
+	// WatchCmd is an optional field, it creates a command which runs a command line repeatedly, redrawing its output until
+	// a key is pressed:
+	//
+	// <WatchCmd> [-n seconds] <command-line>
+	WatchCmd string
+
+	// ShowCmd is an optional field, it creates a command which shows the state kept by the dialogue:
+	//
+	// <ShowCmd> last
+	//
+	// show last writes the output of the previous command again, or the output of the command n dispatches ago, see
+	// LastOutputFromContext and LastOutputs. The field $LAST of a dispatched line is replaced by the output of the previous
+	// command without its trailing line ending, like a shell command substitution: grep err $LAST.
+	ShowCmd string
+
+	// UseCmd is an optional field, it creates a command which selects a namespace:
+	//
+	// <UseCmd> [<namespace> | -]
+	//
+	// Commands are namespaced by their name, net.ping is the ping command of the net namespace. The commands of the selected
+	// namespace can be called without the prefix and take precedence over the commands with the same name. The default help
+	// output groups the commands by namespace whether UseCmd is set or not.
+	UseCmd string
+
+	// ClearCmd is an optional field, it creates a command which clears the screen when W is a terminal, see ClearScreen:
+	//
+	// <ClearCmd>
+	ClearCmd string
+
+	// StatusCmd is an optional field, it creates a command which shows the name, exit status, duration and error of the
+	// previous command, handy when its error scrolled off screen:
+	//
+	// <StatusCmd>
+	//
+	// The exit status is 0 on success, the code passed to Exit or 1 for any other error, including the errors reported to
+	// the user without closing the dialogue.
+	StatusCmd string
+
+	// SleepCmd, WaitForCmd and RepeatCmd are optional fields, they create utility commands for scripted and interactive
+	// sessions:
+	//
+	// <SleepCmd> <duration>
+	//
+	// <WaitForCmd> [-timeout 30s] [-interval 1s] <command-line>
+	//
+	// <RepeatCmd> <count> <command-line>
+	//
+	// WaitForCmd runs the command line until it doesnt report an error (see StatusCmd), RepeatCmd runs it count times. The
+	// commands stop when the command is interrupted.
+	SleepCmd, WaitForCmd, RepeatCmd string
+
+	// HistoryCmd, AliasCmd and EnvCmd are optional fields, they create commands which list the lines read by the dialogue,
+	// define aliases of command lines for the session and show or set the environment variables of the session:
+	//
+	// <HistoryCmd> [count]
+	//
+	// <AliasCmd> [<alias> [<command-line> | -]]
+	//
+	// <EnvCmd> [<key>[=<value>]]...
+	//
+	// The aliases and the variables set with EnvCmd are cleared every time the dialogue is opened unless they are persisted
+	// in Store, the variables are seen by the flags bound with Command.EnvPrefix but dont change the environment of the
+	// process.
+	HistoryCmd, AliasCmd, EnvCmd string
+
+	// LastOutputLimit is the number of bytes kept from the output of the previous command, older output is dropped. Defaults
+	// to 64KiB.
+	LastOutputLimit int
+
+	// LastOutputs is the number of previous outputs kept in a ring for ShowCmd and PreviousOutputsFromContext, each output is
+	// limited by LastOutputLimit. Defaults to 10.
+	LastOutputs int
+
+	// RecentInputLimit is the number of raw lines read from R kept for RecentInputFromContext, empty lines included.
+	// Defaults to 50.
+	RecentInputLimit int
+
 	// QuitCmd is an optional field, it creates a quit command for you and registers it to the dialogue. It exits the dialogue with
 	// the ErrDialogueClosed error.
 	//
@@ -67,6 +453,9 @@ type Dialogue struct {
 	//
 	// There is no guarantee that the provided command name is in the commands map but its always guaranteed that the cmds map
 	// will consist of the current available commands in the dialogue.
+	//
+	// If nil the default formatter will be used, it caches its output until the command set changes (RegisterCommands,
+	// Compile or reopening the dialogue).
 	FormatHelp func(cmd string, cmds map[string]*Command) string
 
 	// CommandContext optinally specifies a function to set the context for a command. The provided context is derived from the
@@ -74,63 +463,395 @@ type Dialogue struct {
 	// but if not wrapped, no cancelation can be propagated to the command.
 	CommandContext func(context.Context, string) context.Context
 
-	mu       sync.Mutex          // protects the fields below.
-	ctx      context.Context     // ctx is the base context used for cancelation.
-	cancel   context.CancelFunc  // cancel cancels the base context.
-	pr       *PreamptiveReader   // pr is the wrapped preamptive reader. (it is wrapped around R)
-	commands map[string]*Command // commands is a mapping of the command name to command.
-	running  bool                // indicates if the current dialogue is running.
-	close    chan chan struct{}  // used to send acknowledgement signals between the close calls and the processing go routine.
+	// Middleware optionally wraps every hop of the dispatched call chains, see CallChain.Wrap. The first middleware is the
+	// outermost.
+	Middleware []func(next StepFunc) StepFunc
+
+	// OnError is an optional hook which gets notified of the non fatal errors which occur while dispatching a command, such
+	// as argument validation errors. The errors are reported after they are written to W and dont close the dialogue.
+	OnError func(ctx context.Context, cmd string, err error)
+
+	// OnRedirect is an optional hook which gets notified every time a deprecated command is redirected to the command which
+	// replaces it (see Command.RedirectTo), from is the name of the deprecated command.
+	OnRedirect func(ctx context.Context, from, to string)
+
+	// OnUnknownCommand is an optional hook which gets notified with the raw line of every command which isnt mapped to
+	// anything, before CommandNotFound is called.
+	OnUnknownCommand func(ctx context.Context, line string)
+
+	// ConfigFile is an optional path to a JSON file holding default flag values for the commands, keyed by command name and
+	// then flag name:
+	//
+	//	{"echo": {"n": 3}, "tag": {"labels": ["a", "b"]}}
+	//
+	// The file is read when the dialogue is opened and the values are applied before every invocation of a command, taking
+	// precedence over the flag defaults but not over Command.EnvPrefix environment variables or the command line. The
+	// values are strings, numbers or booleans, an array sets the flag once per element. The environment and the command
+	// line replace the values of the accumulating flags, such as StringSliceFlag, instead of adding to them. Opening the
+	// dialogue fails with an ErrUnknownConfigFlag if a value names a flag which the command doesnt define.
+	ConfigFile string
+
+	// FlagReset controls how the flags of the commands are restored after each invocation, it can be overriden per command
+	// by Command.FlagReset. Defaults to FlagResetVisited.
+	FlagReset FlagReset
+
+	// ExecOrder controls the order in which the commands of a call chain are executed, it can be overriden per command by
+	// Command.ExecOrder. Defaults to ExecLeafFirst.
+	ExecOrder ExecOrder
+
+	// Theme optionally styles the output of the default formatters and handlers (help, errors and the prefix).
+	//
+	// If nil DefaultTheme is used when W is a terminal and the NO_COLOR environment variable isnt set to a non empty value,
+	// NoColorTheme otherwise.
+	Theme *Theme
+
+	// Plain enables the accessible output mode for screen readers and scraped logs: no ANSI sequences (the theme is ignored),
+	// no tab alignment in the default help output and one logical item per line, including the prefix.
+	Plain bool
+
+	// ConfirmPolicy controls how the commands which require confirmation (see Command.Confirm) are handeled when they arent
+	// bypassed with -y. Defaults to ConfirmAuto.
+	ConfirmPolicy ConfirmPolicy
+
+	// LocalizeBuiltin is an optional hook called with every builtin command (see QuitCmd, HelpCmd and the other builtin
+	// fields) before it is registered. It can replace the help texts of the builtins and add aliases from a message
+	// catalog so the localized and the default names both work, the name of the command must be left as is:
+	//
+	//	LocalizeBuiltin: func(cmd *dialogue.Command) {
+	//		if cmd.Name == "help" {
+	//			cmd.HelpShort = "muestra la ayuda"
+	//			cmd.Aliases = []string{"ayuda"}
+	//		}
+	//	}
+	LocalizeBuiltin func(cmd *Command)
+
+	// HelpWidth wraps the default help output (the long help and the flag and sub command tables) to the number of columns.
+	// If 0 the width of the terminal W writes to is used, the output isnt wrapped if W isnt a terminal. A negative width
+	// disables wrapping.
+	HelpWidth int
+
+	// HelpLayout controls the column widths and padding of the flag and sub command tables of the default help output,
+	// ignored in plain mode.
+	HelpLayout HelpLayout
+
+	// UsageOnError controls what gets written after a command is invoked with malformed flags, it can be overriden per
+	// command by Command.UsageOnError. Use UsageFull, UsageShort, UsageErrorOnly or a custom UsagePolicy.
+	//
+	// If nil UsageFull will be used.
+	UsageOnError UsagePolicy
+
+	// HelpOutput controls whether the usage written after a bad invocation and the help go to W or Werr, see HelpOutput.
+	HelpOutput HelpOutput
+
+	help helpCache      // help caches the output of the default FormatHelp.
+	out  *outputCapture // out wraps W capturing the output of every dispatch, set on startup.
+	eout *outputCapture // eout wraps Werr, it wraps out if Werr is nil, set on startup.
+	flow *flowWriter    // flow applies WriteTimeout and WriteBuffer to W, nil if unused. Protected by mu.
+
+	theme     Theme          // theme is the resolved theme, set on startup.
+	verbosity verbosityLevel // verbosity is the current verbosity.
+	trace     atomic.Bool    // trace indicates if the trace mode is on.
+	dryRun    atomic.Bool    // dryRun indicates if the dry-run mode is on.
+
+	undo     undoStack    // undo holds the executed commands which can be undone.
+	macros   macros       // macros holds the recorded macros.
+	history  history      // history holds the lines read by the dialogue.
+	tx       *transaction // tx holds the queued commands of the current transaction, nil outside transactions.
+	renderer Renderer     // renderer renders the default handlers, Renderer or the writer renderer, set on startup.
+	reader   LineReader   // reader reads the lines, LineReader or the scanner over the preamptive reader, set by Open.
+
+	term        termSize   // term holds the size of the terminal W writes to.
+	fg          foreground // fg tracks the command dispatched from R.
+	dispatching sync.Mutex // dispatching serializes the dispatches of the reader loop and the scheduler.
+	schedules   scheduler  // schedules holds the commands scheduled by EveryCmd.
+	namespace   namespace  // namespace is the namespace selected by UseCmd.
+	last        lastResult // last tracks the outcome of the previous dispatch for StatusCmd.
+	userAlias   aliasTable // userAlias holds the aliases defined with AliasCmd.
+	userEnv     aliasTable // userEnv holds the variables set with EnvCmd, they map names to values like the aliases.
+	recent      inputRing  // recent holds the last lines read from R.
+
+	mu       sync.Mutex                     // protects the fields below.
+	ctx      context.Context                // ctx is the base context used for cancelation.
+	cancel   context.CancelFunc             // cancel cancels the base context.
+	pr       *PreamptiveReader              // pr is the wrapped preamptive reader. (it is wrapped around R)
+	keys     *keyReader                     // keys reads R ahead for the cancel key, between R and pr if it is handled.
+	swap     io.Reader                      // swap is the reader set by SwapReader during a session, nil if none is pending.
+	nextW    io.Writer                      // nextW is the writer set by SetWriter during a session, nil if none is pending.
+	commands map[string]*Command            // commands is a mapping of the command name to command.
+	removed  map[string]bool                // removed holds the names of the builtins removed by UnregisterCommands.
+	aliases  map[string]*Command            // aliases maps the aliases of the commands to the commands, set on startup.
+	config   map[string]map[string][]string // config holds the flag values read from ConfigFile keyed by command and flag name.
+	running  bool                           // indicates if the current dialogue is running.
+	prepared bool                           // prepared reports whether Execute can skip prepareLocked, see invalidateLocked.
+	reading  bool                           // reading reports whether the reader loop waits for a line, see setReading.
+	status   int                            // status is the exit status of the last session, see Exit.
+	closedBy error                          // closedBy is the cause sent with the close signal, ErrClosed or ErrShutdown.
+	done     chan struct{}                  // done is closed when the session ends, see Done.
+	shutdown chan struct{}                  // shutdown is closed by Shutdown, see ShuttingDown.
+	detach   chan struct{}                  // detach is closed by Close once CloseTimeout expires, see CloseDetach.
+	close    chan chan struct{}             // used to send acknowledgement signals between the close calls and the processing go routine.
 }
 
 // Open initialises the dialogue and listens for tokens (provided by the default bufio.Scanner) and maps them to commands.
 //
-// Open always returns non nil errors. After a call to Shutdown or Close the returned error is ErrDialogueClosed.
+// Open always returns non nil errors: ErrClosed or ErrShutdown after a call to Close or Shutdown, ErrEOF when R is exhausted
+// and ErrTerminatedByCommand when a command ends the dialogue. The errors of R and W are returned as is.
 //
 // IMPORTANT:
 //
 // You can open previously closed dialogues but be aware of the underlaying preamptive reader since it will always be binded to
-// the initiall reader and may read messages from the past transaction.
+// the initiall reader and may read messages from the past transaction, use Restart, Reset or SwapReader to start from a fresh
+// reader.
 func (d *Dialogue) Open() error {
+	return d.OpenContext(context.Background())
+}
+
+// OpenContext is like Open but bounded by ctx: once ctx is done the dialogue is shut down without waiting for the current
+// command, like a call to Shutdown with an expired context, and OpenContext returns ErrShutdown.
+func (d *Dialogue) OpenContext(ctx context.Context) error {
 	if err := d.init(); err != nil {
 		return err
 	}
+	defer d.closeDone()
+	defer d.flushOutput()
+	defer d.schedules.stop()
+
+	if ctx.Done() != nil {
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				d.Shutdown(ctx) // ctx is done so Shutdown falls back to Close right away.
+			case <-done:
+			}
+		}()
+	}
+	defer d.history.close()
 
-	scanner := bufio.NewScanner(d.pr)
+	if d.HandleSignals {
+		defer d.notifySignals()()
+	}
+
+	if IsTerminal(d.W) {
+		// the cached help is wrapped to the previous width.
+		defer d.term.watchResize(d.W, d.help.invalidate)()
+	}
+
+	d.reader = d.LineReader
+	if d.reader == nil {
+		d.reader = d.newScannerLineReader()
+	}
+	prefix := d.theme.style(d.theme.Prompt, d.Prefix) // style once instead of on every prompt.
+	if d.Plain && len(prefix) > 0 {
+		prefix += "\n"
+	}
+	if d.Quiet || d.nonInteractive() {
+		prefix = ""
+	}
+	var draining bool // draining reports whether the lines buffered before a shutdown are dispatched, see DrainOnShutdown.
 	for {
-		// acknowledge any close signals before commiting to a write call.
-		if err := d.exit(nil); err != nil {
-			return err
+		if !draining && d.startDrain() {
+			draining, prefix = true, ""
 		}
-
-		if _, err := d.W.Write([]byte(d.Prefix)); err != nil {
-			return d.exit(err)
+		if draining && d.ctx.Err() != nil { // the shutdown context expired.
+			return d.exit(ErrShutdown)
 		}
 
-		advance := scanner.Scan()
+		// acknowledge any close signals before commiting to a read call.
+		if !draining {
+			if err := d.exit(nil); err != nil {
+				return err
+			}
+		}
+		d.applySwap()
+		d.applyWriter()
 
-		if !advance {
-			return d.exit(scanner.Err())
+		if tee := d.out.tee; tee != nil && prefix != "" {
+			tee.recordPrompt(d.Prefix, prefix)
+		}
+		d.out.prompt(prefix)
+		d.setReading(true)
+		token, err := d.reader.ReadLine(d.ctx, prefix)
+		d.setReading(false)
+		d.out.prompt("")
+		token = d.sanitize(token)
+		redacted := d.redact(token) // the recorded form of the line.
+		if tee := d.out.tee; tee != nil && err == nil {
+			tee.record("input", redacted)
+		}
+		if errors.As(err, &ErrInputLimit{}) {
+			if err := d.reportError(d.ctx, "", err); err != nil {
+				return d.exit(err)
+			}
+			continue
+		}
+		if draining && err != nil {
+			return d.exit(ErrShutdown)
+		}
+		if err != nil && d.applySwap() {
+			continue // the source failed over to the reader set by SwapReader.
+		}
+		if err == io.EOF {
+			err = ErrEOF
+			d.aggregateStatus()
+		}
+		if err != nil {
+			return d.exit(err)
 		}
 
-		token := scanner.Text()
-		fields := strings.Fields(token)
+		d.recent.add(redacted)
+		pooled := splitFields(token)
+		fields := *pooled
 
 		if len(fields) == 0 {
+			putFields(pooled)
+			continue
+		}
+
+		if err := d.checkInput(token, fields); err != nil {
+			putFields(pooled)
+			if err := d.reportError(d.ctx, "", err); err != nil {
+				return d.exit(err)
+			}
 			continue
 		}
 
-		err := d.dispatchHandler(fields[0], fields[1:])
+		// failing to persist the history shouldnt end the dialogue.
+		if err := d.history.add(d.ctx, redacted); err != nil {
+			if err := d.reportError(d.ctx, fields[0], fmt.Errorf("dialogue: history: %w", err)); err != nil {
+				return d.exit(err)
+			}
+		}
+
+		if cmd, _ := d.command(fields[0]); cmd == nil || cmd.Name != d.RecordCmd {
+			if err := d.macros.capture(token, redacted); err != nil {
+				if err := d.reportError(d.ctx, fields[0], err); err != nil {
+					return d.exit(err)
+				}
+			}
+		}
+
+		var echoErr error
+		detached, err := d.detachable(func() error {
+			d.dispatching.Lock()
+			defer d.dispatching.Unlock()
+
+			if d.EchoInput {
+				if echoErr = d.echo(redacted); echoErr != nil {
+					return nil
+				}
+			}
+			d.out.begin()
+			d.beginResult(fields[0])
+			// only the lines read by the loop can read the lines following them, see ErrNoInput.
+			parent := context.WithValue(d.startForeground(token), lineReaderKey{}, d.reader)
+			err := d.dispatchHandler(parent, token, fields)
+			d.stopForeground()
+			d.endResult(err)
+			d.out.end()
+			return err
+		})
+		if detached {
+			return d.exit(nil) // Close is waiting for the acknowledgement.
+		}
+		if echoErr != nil {
+			return d.exit(echoErr)
+		}
 		if err != nil {
-			return d.exit(err)
+			name := fields[0]
+			if cmd, ok := d.command(name); ok {
+				name = cmd.Name
+			}
+			return d.exit(ErrTerminatedByCommand{name, d.exitStatus(err)})
 		}
+		putFields(pooled)
+	}
+}
+
+// exitStatus records the status of an ExitError and writes its message, err is returned unless writing fails.
+func (d *Dialogue) exitStatus(err error) error {
+	var exit *ExitError
+	if !errors.As(err, &exit) {
+		return err
+	}
+
+	d.mu.Lock()
+	d.status = exit.Code
+	d.mu.Unlock()
+
+	if exit.Msg != "" {
+		print := d.renderer.PrintLine
+		if exit.Code != 0 {
+			print = func(msg string) error { return d.renderer.PrintError(errors.New(msg)) }
+		}
+
+		if err := print(exit.Msg); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// echo writes the input line token for EchoInput.
+func (d *Dialogue) echo(token string) error {
+	prefix := d.Prefix
+	if prefix == "" {
+		prefix = "> "
+	}
+
+	return d.renderer.PrintLine(prefix + token)
+}
+
+// redact applies Redact to line.
+func (d *Dialogue) redact(line string) string {
+	if d.Redact == nil {
+		return line
+	}
+
+	return d.Redact(line)
+}
+
+// nonInteractive reports whether the dialogue reads from a script rather than a user, see Interactive. Dialogues without R
+// only dispatched by Execute arent considered non interactive.
+func (d *Dialogue) nonInteractive() bool {
+	if d.Interactive != nil {
+		return !*d.Interactive
+	}
+
+	f, ok := d.R.(*os.File)
+	return d.LineReader == nil && ok && !IsTerminal(f)
+}
+
+// aggregateStatus sets the exit status of a non interactive session which reached the end of R.
+func (d *Dialogue) aggregateStatus() {
+	if !d.nonInteractive() || d.last.failures() == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	if d.status == 0 {
+		d.status = 1
 	}
+	d.mu.Unlock()
+}
+
+// ExitStatus returns the status code passed to Exit by the command which terminated the last session of the dialogue. It is 1
+// if a non interactive session reached the end of R after a command failed (see StatusCmd for what counts as a failure)
+// and 0 otherwise.
+func (d *Dialogue) ExitStatus() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.status
 }
 
 // exit locks the dialogue in closing state, it first tries to acknowledge any closing signals before returning the provided
 // error.
 //
-// If it acknowledges any exit errors it returns ErrDialogueClosed.
+// If it acknowledges any exit errors it returns the cause of the closing, ErrClosed or ErrShutdown.
 func (d *Dialogue) exit(err error) error {
 	// acquire mutex to make sure there is no race condition between sending an acknowledgement and recieving it.
 	d.mu.Lock()
@@ -145,7 +866,7 @@ func (d *Dialogue) exit(err error) error {
 		// to be synchronised because any calls after Open or Shutdown / Close exit which access the underlaying preamptive reader
 		// have to access it via a cancelled context to provide expected behaviour.
 		<-d.ctx.Done()
-		return ErrDialogueClosed
+		return d.closedBy
 	default:
 	}
 
@@ -157,163 +878,833 @@ func (d *Dialogue) exit(err error) error {
 	return err
 }
 
-// dispatchHandler dispatches the handler for cmd if it exits or the not found handler.
-// finally it returns any error from the handlers.
-func (d *Dialogue) dispatchHandler(cmd string, args []string) error {
-	command, ok := d.commands[cmd]
-	if !ok {
-		// accomodate the cmd name in the args to the not found handler.
-		tmp := make([]string, 1, len(args)+1)
-		tmp[0] = cmd
-		copy(tmp[1:], args)
-
-		return d.CommandNotFound(d.ctx, tmp)
-	}
-
-	cmdCtx := d.ctx
-	if cc := d.CommandContext; cc != nil {
-		cmdCtx = cc(cmdCtx, cmd)
-		if cmdCtx == nil {
-			return errors.New("CommandContext returned nil context")
+// dispatchHandler dispatches the handler for the command named by the first field of line if it exits or the not found
+// handler. finally it returns any error from the handlers. The dispatch context is derived from parent.
+//
+// The callers must hold the dispatching lock unless they are called by a dispatch.
+func (d *Dialogue) dispatchHandler(parent context.Context, line string, fields []string) error {
+	if d.ValidateLine != nil {
+		if err := d.ValidateLine(fields); err != nil {
+			return d.reportError(parent, fields[0], err)
 		}
 	}
 
-	callChain, err := command.parse(args)
-	// error returned because flag set uses continue on error, dont report error back to the dispatcher to "continue on error".
-	if err != nil {
-		return nil
+	fields = d.expandLast(fields)
+	args := fields[1:]
+	command, ok, err := d.lookup(fields[0])
+	if err != nil { // the lazy commands which cant be constructed are reported like the invalid lines.
+		return d.reportError(parent, fields[0], err)
+	}
+	ctx := d.dispatchContext(parent, line, command)
+	if ok && !command.enabled(ctx) {
+		ok = false
 	}
+	if ok && command.RedirectTo != "" {
+		return d.redirect(parent, ctx, command, line, fields)
+	}
+	if !ok {
+		if ok, err := d.expandAlias(parent, line, fields); ok {
+			return err
+		}
 
-	defer callChain.clean()
-	return callChain.AdvanceExec(0, cmdCtx) // start call chain.
-}
+		if d.Evaluator != nil {
+			return d.evaluate(ctx, line, fields)
+		}
 
-func (d *Dialogue) init() error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
+		if d.OnUnknownCommand != nil {
+			d.OnUnknownCommand(ctx, d.redact(line))
+		}
 
-	if len(d.commands) == 0 {
-		return errors.New("dialogue: no commands")
+		// the not found handler recieves the cmd name in the args.
+		return d.CommandNotFound(ctx, fields)
 	}
 
-	// set the quit command.
-	if _, ok := d.commands[d.QuitCmd]; d.QuitCmd != "" && !ok {
-		d.commands[d.QuitCmd] = &Command{
-			Name:      d.QuitCmd,
-			HelpShort: "quits the dialogue abruptly",
-			Exec: func(_ *CallChain, _ []string) error {
-				// no point in setting running state to false in here to prevent other calls to Shutdown or Close since in the end
-				// they all play into the same side effects: ErrDialogueClosed returned from Open(), context cancelled and running
-				// state set to false safely.
-				return ErrDialogueClosed
-			},
-		}
-	}
-
-	// set the help command.
-	if _, ok := d.commands[d.HelpCmd]; d.HelpCmd != "" && !ok {
-		fs := flag.NewFlagSet(d.HelpCmd, flag.ExitOnError)
-		nParam := fs.String("n", "", "specifies the command name you want help on")
-
-		d.commands[d.HelpCmd] = &Command{
-			Name:      d.HelpCmd,
-			Structure: fmt.Sprintf("%v [-n <command-name>]", d.HelpCmd),
-			HelpShort: "outputs the help prompt for all commands or a specified command via the -n flag",
-			HelpLong: `help formats a short version of help prompts for all available commands when ran without the -n flag,
-optinally you can provide the -n flag to get a more thorough help prompt for a specific command indicated by the name passed after
-the -n flag.`,
-			FlagSet: fs,
-			Exec: func(_ *CallChain, _ []string) error {
-				_, err := fmt.Fprintf(d.W, d.FormatHelp(*nParam, d.commands))
-				return err
-			},
-		}
+	// the schedules run in the background, outside of the transaction of the user. Only the lines of the user are queued,
+	// the lines dispatched by a command (which already has a line) run with it.
+	scheduled := scheduledFromContext(ctx)
+	if _, nested := LineFromContext(parent); d.tx != nil && !command.immediate && !scheduled && !nested {
+		return d.tx.queue(d, ctx, command, line, fields)
 	}
 
-	if err := d.initCommandsLocked(); err != nil {
+	cmdCtx, err := d.commandContext(ctx, command.Name)
+	if err != nil {
 		return err
 	}
 
-	// check if context doesnt exist or previous context expired (this means the dialogue is being reused).
-	if d.ctx == nil || d.ctx.Err() != nil {
-		d.ctx, d.cancel = context.WithCancel(context.Background())
+	callChain, err := d.prepare(cmdCtx, command.Name, command, args, true)
+	if callChain == nil || err != nil {
+		return err
+	}
 
-		// if there is an existing preamptive reader, continue using it with the new context since it may still have
-		// state.
-		if d.pr != nil {
-			d.pr.ctx = d.ctx
+	// executing the chain advances it, keep the whole chain for the cleanup and the undo stack.
+	chain := *callChain
+	defer chain.clean()
+
+	if err := callChain.run(cmdCtx, d.execOrder(command)); err != nil { // start call chain.
+		// aborted call chains are reported like the other non fatal errors.
+		if !errors.As(err, &ErrAborted{}) {
+			return err
+		}
+
+		if err := d.reportError(cmdCtx, command.Name, err); err != nil {
+			return err
 		}
 	}
 
-	if d.pr == nil {
-		d.pr = NewPreamptiveReader(d.ctx, d.R)
+	if !scheduled { // undo reverts the commands of the user.
+		d.undo.push(newUndoGroup(chain))
 	}
+	return nil
+}
 
-	if d.FormatHelp == nil {
-		d.FormatHelp = defaultHelpFormater
+// execOrder returns the execution order of the call chains starting at cmd.
+func (d *Dialogue) execOrder(cmd *Command) ExecOrder {
+	if cmd.ExecOrder != ExecOrderDefault {
+		return cmd.ExecOrder
 	}
 
-	if d.CommandNotFound == nil {
-		d.CommandNotFound = d.defaultCmdNotFound
+	return d.ExecOrder
+}
+
+// dispatchContext builds the context of the dispatch of line, the output is the Output of cmd if it isnt nil and has one.
+func (d *Dialogue) dispatchContext(parent context.Context, line string, cmd *Command) context.Context {
+	var out io.Writer = d.out
+	if cmd != nil && cmd.Output != nil {
+		out = cmd.Output
 	}
 
-	d.running = true
-	return nil
+	d.mu.Lock()
+	shutdown := d.shutdown
+	d.mu.Unlock()
+
+	return &dispatchContext{
+		parent, line, d.verbosity.get(), d.dryRun.Load(), out, d.out.lastOutput(), d.out, d.term.get(), &d.recent,
+		shutdown, d.Redact,
+	}
 }
 
-func (d *Dialogue) initCommandsLocked() error {
-	for _, cmd := range d.commands {
-		if err := cmd.init(); err != nil {
+// redirect dispatches the command which command redirects to with the args of fields. The deprecation notice is only
+// written on the first redirect of command.
+func (d *Dialogue) redirect(parent, ctx context.Context, command *Command, line string, fields []string) error {
+	d.mu.Lock()
+	warn := !command.warnedRedirect
+	command.warnedRedirect = true
+	d.mu.Unlock()
+
+	if warn {
+		if err := d.renderer.PrintError(fmt.Errorf("%v is deprecated, use %v instead", command.Name, command.RedirectTo)); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	if d.OnRedirect != nil {
+		d.OnRedirect(ctx, command.Name, command.RedirectTo)
+	}
+
+	// rewrite the command name of the line preserving the args as typed.
+	line = command.RedirectTo + strings.TrimPrefix(strings.TrimLeftFunc(line, unicode.IsSpace), fields[0])
+	return d.dispatchHandler(parent, line, append([]string{command.RedirectTo}, fields[1:]...))
 }
 
-func (d *Dialogue) getCloseLocked() chan chan struct{} {
-	if d.close == nil {
-		d.close = make(chan chan struct{}, 1)
+// commandContext derives the context of the command from the dispatch context using CommandContext.
+func (d *Dialogue) commandContext(ctx context.Context, cmd string) (context.Context, error) {
+	if cc := d.CommandContext; cc != nil {
+		ctx = cc(ctx, cmd)
+		if ctx == nil {
+			return nil, errors.New("CommandContext returned nil context")
+		}
 	}
 
-	return d.close
+	return ctx, nil
 }
 
-func (d *Dialogue) signalClosingLocked() <-chan struct{} {
-	d.running = false
-	ackChan := make(chan struct{}) // unbuffered to provide acknowledgement synchronisation.
-
-	// signal close.
+// prepare parses the call chain of command and runs the checks which precede its execution: tracing, validation and
+// optionally confirmation. A nil call chain is returned if the command shouldnt be executed, the reason has already been
+// reported. The caller is responsible for cleaning the returned call chain.
+func (d *Dialogue) prepare(ctx context.Context, cmd string, command *Command, args []string, confirm bool) (*CallChain, error) {
+	callChain, err := command.parseDepth(args, d.MaxDepth, true)
+	// error returned because flag set uses continue on error, dont report error back to the dispatcher to "continue on error".
+	// the flag set already wrote the error to its output so only the usage and the error hook are left.
+	if err != nil {
+		d.usageOnError(ctx, cmd, err)
+		return nil, nil
+	}
+
+	if d.trace.Load() {
+		if err := callChain.trace(d.out, d.redact); err != nil {
+			callChain.clean()
+			return nil, err
+		}
+	}
+
+	if err := callChain.validate(); err != nil {
+		callChain.clean()
+		return nil, d.reportError(ctx, cmd, err)
+	}
+
+	if confirm {
+		if ok, err := d.confirm(ctx, cmd, callChain); !ok || err != nil {
+			callChain.clean()
+			return nil, err
+		}
+	}
+
+	callChain.wrapRetry()
+	for i := len(d.Middleware) - 1; i >= 0; i-- {
+		callChain.Wrap(d.Middleware[i])
+	}
+
+	return callChain, nil
+}
+
+// usageWriter returns the writer of the usage written after a bad invocation according to HelpOutput, nil by default.
+func (d *Dialogue) usageWriter() io.Writer {
+	switch d.HelpOutput {
+	case HelpOutputPOSIX, HelpOutputWerr:
+		return d.eout
+	case HelpOutputW:
+		return d.out
+	}
+
+	return nil
+}
+
+// helpWriter returns the writer of the help requested by the user according to HelpOutput, nil by default.
+func (d *Dialogue) helpWriter() io.Writer {
+	switch d.HelpOutput {
+	case HelpOutputPOSIX, HelpOutputW:
+		return d.out
+	case HelpOutputWerr:
+		return d.eout
+	}
+
+	return nil
+}
+
+// usageOnError writes the usage of the command which failed parsing according to the usage policy and notifies the
+// OnError hook. A request for help (-h) always writes the focused help of the command.
+func (d *Dialogue) usageOnError(ctx context.Context, cmd string, err error) {
+	// errors which didnt originate from the flag set havent been reported yet.
+	var pErr parseError
+	if !errors.As(err, &pErr) {
+		d.reportError(ctx, cmd, err)
+		return
+	}
+	c := pErr.cmd
+
+	if errors.Is(err, flag.ErrHelp) {
+		w := c.FlagSet.Output()
+		if hw := d.helpWriter(); hw != nil && c.Output == nil {
+			w = hw
+		}
+
+		UsageFull(w, c, err)
+		return
+	}
+
+	policy := c.UsageOnError
+	if policy == nil {
+		policy = d.UsageOnError
+	}
+	if policy == nil {
+		policy = UsageFull
+	}
+	w := c.FlagSet.Output()
+	if uw := d.usageWriter(); uw != nil && c.Output == nil {
+		w = uw
+	}
+	policy(w, c, pErr.err)
+
+	if d.OnError != nil {
+		d.OnError(ctx, cmd, err)
+	}
+}
+
+// reportError writes the non fatal err to W, or the Output of cmd, and notifies the OnError hook. It only returns errors
+// produced while writing the error.
+func (d *Dialogue) reportError(ctx context.Context, cmd string, err error) error {
+	d.last.fail(err)
+	if werr := d.commandRenderer(cmd).PrintError(err); werr != nil {
+		return werr
+	}
+
+	if d.OnError != nil {
+		d.OnError(ctx, cmd, err)
+	}
+
+	return nil
+}
+
+// ConfirmPolicy controls how the dialogue collects the answer for the commands which require confirmation.
+type ConfirmPolicy int
+
+const (
+	// ConfirmAuto prompts when R is a terminal and refuses to execute the command otherwise, non interactive input has to
+	// bypass the prompt with -y.
+	ConfirmAuto ConfirmPolicy = iota
+
+	// ConfirmPrompt always prompts and reads the answer from R, even when R isnt a terminal.
+	ConfirmPrompt
+
+	// ConfirmYes never prompts and executes the commands as if they were confirmed.
+	ConfirmYes
+
+	// ConfirmNo never prompts and refuses to execute the commands which arent bypassed with -y.
+	ConfirmNo
+)
+
+// confirm collects the confirmation of every command in the call chain which requires one, root first. It reports false
+// if any of them isnt confirmed.
+func (d *Dialogue) confirm(ctx context.Context, cmd string, c *CallChain) (bool, error) {
+	for i := len(*c) - 1; i >= 0; i-- {
+		inv := (*c)[i]
+		if inv.Confirm == "" || inv.yes {
+			continue
+		}
+
+		policy := d.ConfirmPolicy
+		if policy == ConfirmAuto {
+			policy = ConfirmNo
+			if IsTerminal(d.R) {
+				policy = ConfirmPrompt
+			}
+		}
+		// background dispatches cant read from R.
+		if policy == ConfirmPrompt && scheduledFromContext(ctx) {
+			policy = ConfirmNo
+		}
+
+		switch policy {
+		case ConfirmYes:
+			continue
+		case ConfirmNo:
+			return false, d.reportError(ctx, cmd, fmt.Errorf("%v: confirmation required, use -y to proceed", inv.Name))
+		}
+
+		prompt := inv.Confirm
+		if !strings.HasSuffix(prompt, " ") {
+			prompt += " "
+		}
+
+		reader, ok := ctx.Value(lineReaderKey{}).(LineReader)
+		if !ok {
+			return false, fmt.Errorf("%v: %w", inv.Name, ErrNoInput)
+		}
+
+		// a failed read is reported by the next read of Open.
+		answer, err := reader.ReadLine(ctx, prompt)
+		if err != nil {
+			return false, nil
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+		default:
+			return false, d.renderer.PrintLine("aborted")
+		}
+	}
+
+	return true, nil
+}
+
+func (d *Dialogue) init() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.verbosity.set(d.Verbosity)
+	d.trace.Store(d.Trace)
+	d.dryRun.Store(d.DryRun)
+	d.undo.reset()
+	d.last.reset()
+	d.tx = nil
+	d.namespace.set("")
+
+	recentLimit := d.RecentInputLimit
+	if recentLimit <= 0 {
+		recentLimit = defaultRecentInputLimit
+	}
+	d.recent.reset(recentLimit)
+
+	if err := d.macros.load(context.Background(), d.Store); err != nil {
+		return err
+	}
+	if err := d.userAlias.load(context.Background(), d.Store, aliasPrefix); err != nil {
+		return fmt.Errorf("dialogue: aliases: %w", err)
+	}
+	if err := d.userEnv.load(context.Background(), d.Store, variablePrefix); err != nil {
+		return fmt.Errorf("dialogue: variables: %w", err)
+	}
+
+	if err := d.prepareLocked(); err != nil {
+		return err
+	}
+
+	if d.nextW != nil { // set by SetWriter after the last dispatch of the previous session.
+		d.W, d.nextW = d.nextW, nil
+	}
+	if d.swap != nil { // set by SwapReader after the last read of the previous session.
+		d.swapLocked(d.swap)
+	}
+	if d.pr == nil {
+		d.pr = NewPreamptiveReader(d.ctx, d.sourceLocked())
+	}
+
+	if err := d.history.open(context.Background(), d.HistoryFile, d.HistoryTimestamps, d.HistorySize, d.Store); err != nil {
+		return err
+	}
+
+	d.status = 0
+	d.shutdown = make(chan struct{})
+	d.detach = make(chan struct{})
+	d.running = true
+	return nil
+}
+
+// prepareLocked initialises what a dispatch needs: the output capture, the builtins, the theme, the command trees and the
+// base context.
+func (d *Dialogue) prepareLocked() error {
+	if len(d.commands) == 0 {
+		return errors.New("dialogue: no commands")
+	}
+
+	d.initOutputLocked()
+	d.installBuiltinsLocked()
+	d.term.detect(d.W)
+	d.resolveThemeLocked()
+	d.resolveRendererLocked()
+
+	if err := d.loadConfigLocked(); err != nil {
+		return err
+	}
+
+	if err := d.initCommandsLocked(); err != nil {
+		return err
+	}
+
+	// check if context doesnt exist or previous context expired (this means the dialogue is being reused).
+	if d.ctx == nil || d.ctx.Err() != nil {
+		d.ctx, d.cancel = context.WithCancel(context.Background())
+
+		// if there is an existing preamptive reader, continue using it with the new context since it may still have
+		// state.
+		if d.pr != nil {
+			d.pr.ctx = d.ctx
+		}
+	}
+
+	if d.FormatHelp == nil {
+		d.FormatHelp = d.cachedHelpFormater
+	}
+	// the command set could have changed since the last run.
+	d.help.invalidate()
+
+	if d.CommandNotFound == nil {
+		d.CommandNotFound = d.defaultCmdNotFound
+	}
+
+	d.prepared = true
+	return nil
+}
+
+// invalidateLocked makes the next call to Execute prepare the dialogue again, the commands or the base context changed.
+func (d *Dialogue) invalidateLocked() {
+	d.prepared = false
+	d.help.invalidate()
+}
+
+// initOutputLocked wraps W with the output capture. The builtins keep refering to the same capture across reopens.
+func (d *Dialogue) initOutputLocked() {
+	if d.out == nil {
+		d.out = &outputCapture{}
+	}
+
+	d.out.w = d.writerLocked() // the schedules and the signals write concurrently with the prompt.
+	d.out.tee = nil
+	if d.Transcript != nil {
+		d.out.tee = &transcript{w: d.Transcript}
+	}
+	d.out.limit = d.LastOutputLimit
+	if d.out.limit <= 0 {
+		d.out.limit = defaultLastOutputLimit
+	}
+	d.out.keep = d.LastOutputs
+	if d.out.keep <= 0 {
+		d.out.keep = defaultLastOutputs
+	}
+
+	// the diagnostics written to Werr arent captured for the next dispatch.
+	if d.eout == nil {
+		d.eout = &outputCapture{}
+	}
+	d.eout.w, d.eout.tee = d.out, nil
+	if d.Werr != nil {
+		d.eout.w, d.eout.tee = SyncWriter(d.Werr), d.out.tee
+	}
+}
+
+// resolveThemeLocked sets the theme used by the default formatters and handlers.
+func (d *Dialogue) resolveThemeLocked() {
+	if d.Plain {
+		d.theme = NoColorTheme
+	} else if d.Theme != nil {
+		d.theme = *d.Theme
+	} else if d.nonInteractive() {
+		d.theme = NoColorTheme
+	} else {
+		d.theme = resolveTheme(d.W)
+	}
+}
+
+// loadConfigLocked reads the config file, if any, into d.config.
+func (d *Dialogue) loadConfigLocked() error {
+	d.config = nil
+	if d.ConfigFile == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(d.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("dialogue: config: %w", err)
+	}
+
+	var raw map[string]map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber() // keep the large integers and the formatting of the numbers as written.
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("dialogue: config: %w", err)
+	}
+
+	d.config = make(map[string]map[string][]string, len(raw))
+	for cmd, flags := range raw {
+		d.config[cmd] = make(map[string][]string, len(flags))
+		for name, v := range flags {
+			values, ok := configValues(v)
+			if !ok {
+				return fmt.Errorf("dialogue: config: %v: flag -%v: expected a string, number, boolean or an array of them", cmd, name)
+			}
+			d.config[cmd][name] = values
+		}
+	}
+
+	return nil
+}
+
+// configValues converts the value of a flag in the config file to the values passed to the flag, an array sets the flag
+// once per element. ok is false if the value isnt a string, number, boolean or an array of them.
+func configValues(v any) (values []string, ok bool) {
+	elems, isArray := v.([]any)
+	if !isArray {
+		elems = []any{v}
+	}
+
+	for _, elem := range elems {
+		switch elem.(type) {
+		case string, json.Number, bool:
+			values = append(values, fmt.Sprint(elem))
+		default:
+			return nil, false
+		}
+	}
+
+	return values, true
+}
+
+// initCommandsLocked initialises the whole command tree, warning about flag sets which use flag.ExitOnError.
+func (d *Dialogue) initCommandsLocked() error {
+	d.help.format = commandHelpFormater{theme: d.theme, plain: d.Plain, width: d.HelpWidth, layout: d.HelpLayout}
+	if d.help.format.width == 0 && IsTerminal(d.W) {
+		d.help.format.term = &d.term
+	}
+	d.indexAliasesLocked()
+
+	for _, cmd := range d.commands {
+		if err := d.checkRedirectLocked(cmd); err != nil {
+			return err
+		}
+	}
+
+	if err := walkCommands(d.commands, d.checkSeeAlsoLocked); err != nil {
+		return err
+	}
+
+	return walkCommands(d.commands, d.initCommand)
+}
+
+// initCommand initialises a single command with the help formater and the config of the dialogue.
+func (d *Dialogue) initCommand(cmd *Command) error {
+	if err := cmd.init(d.help.format); err != nil {
+		return err
+	}
+	cmd.config = d.config[cmd.Name]
+	if err := checkConfig(cmd); err != nil {
+		return err
+	}
+	cmd.lookupEnv = d.lookupEnv
+	cmd.reset = cmd.FlagReset
+	if cmd.reset == FlagResetDefault {
+		cmd.reset = d.FlagReset
+	}
+
+	// the parse errors go where the usage goes, the output of the flag set is left as is.
+	cmd.parseOutput = nil
+	if cmd.Output == nil {
+		cmd.parseOutput = d.usageWriter()
+	}
+
+	if cmd.FlagSet.ErrorHandling() == flag.ExitOnError && !cmd.warnedExitOnError {
+		cmd.warnedExitOnError = true
+		return d.reportError(context.Background(), cmd.Name, ErrExitOnError{cmd.Name})
+	}
+
+	return nil
+}
+
+// checkConfig returns an ErrUnknownConfigFlag if the config of cmd sets a flag which cmd doesnt define. The lazy commands
+// are checked once constructed.
+func checkConfig(cmd *Command) error {
+	if cmd.lazy != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(cmd.config))
+	for name := range cmd.config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if cmd.FlagSet.Lookup(name) == nil {
+			return ErrUnknownConfigFlag{cmd.Name, name}
+		}
+	}
+
+	return nil
+}
+
+// walkCommands calls fn once for every command in the command trees of cmds.
+func walkCommands(cmds map[string]*Command, fn func(*Command) error) error {
+	seen := make(map[*Command]bool)
+
+	var walk func(cmd *Command) error
+	walk = func(cmd *Command) error {
+		// sub commands can reference each other.
+		if seen[cmd] {
+			return nil
+		}
+		seen[cmd] = true
+
+		if err := fn(cmd); err != nil {
+			return err
+		}
+
+		for _, subCmd := range cmd.SubCommands {
+			if err := walk(subCmd); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, cmd := range cmds {
+		if err := walk(cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Compile freezes the registered command trees into an optimized structure: sub commands are resolved through lookup maps
+// instead of a linear search and the help output of every command is precomputed. Compiling gives predictable dispatch
+// latency for dialogues with hundreds of commands.
+//
+// Changes made to the compiled commands (sub commands or help fields) arent picked up until Compile is called again, the
+// precomputed help keeps the width of the terminal at the time of compiling.
+// Compile returns an error if the dialogue is running or if any command fails to initialise.
+func (d *Dialogue) Compile() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return errors.New("dialogue: cannot compile a running dialogue")
+	}
+
+	d.initOutputLocked()
+	d.term.detect(d.W)
+	d.resolveThemeLocked()
+	d.resolveRendererLocked()
+
+	if err := d.loadConfigLocked(); err != nil {
+		return err
+	}
+
+	if err := d.initCommandsLocked(); err != nil {
+		return err
+	}
+
+	d.help.invalidate()
+	return walkCommands(d.commands, func(cmd *Command) error {
+		cmd.compile()
+		return nil
+	})
+}
+
+// Running reports whether the dialogue is running. It reports false as soon as Close or Shutdown are called, use Done to
+// wait for Open to return.
+func (d *Dialogue) Running() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.running
+}
+
+// Done returns a channel which is closed when the current or the next session of the dialogue ends, that is once Open
+// returns after the dialogue was opened successfully.
+func (d *Dialogue) Done() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.getDoneLocked()
+}
+
+func (d *Dialogue) getDoneLocked() chan struct{} {
+	if d.done == nil {
+		d.done = make(chan struct{})
+	}
+
+	return d.done
+}
+
+// closeDone closes the done channel of the session, the next call to Done returns the channel of the next session.
+func (d *Dialogue) closeDone() {
+	d.mu.Lock()
+	close(d.getDoneLocked())
+	d.done = nil
+	d.prepared = false // the base context is cancelled.
+	d.pauseKeysLocked()
+	d.mu.Unlock()
+}
+
+func (d *Dialogue) getCloseLocked() chan chan struct{} {
+	if d.close == nil {
+		d.close = make(chan chan struct{}, 1)
+	}
+
+	return d.close
+}
+
+func (d *Dialogue) signalClosingLocked(cause error) <-chan struct{} {
+	d.running = false
+	d.closedBy = cause
+	ackChan := make(chan struct{}) // unbuffered to provide acknowledgement synchronisation.
+
+	// signal close.
 	d.getCloseLocked() <- ackChan
 	return ackChan
 }
 
-// Close imidiately cancels the base context and always returns nil.
-func (d *Dialogue) Close() error {
+// Close imidiately cancels the base context and always returns nil. What happens to the running command depends on
+// ClosePolicy: by default Close waits for it to return.
+func (d *Dialogue) Close() error {
+	// the schedules are stopped even if Open already returned.
+	d.schedules.cancel()
+
+	d.mu.Lock()
+	if !d.running {
+		d.mu.Unlock()
+		return nil
+	}
+	notify := d.signalClosingLocked(ErrClosed)
+	detach := d.detach
+	if d.ClosePolicy == CloseCooperative {
+		close(d.shutdown)
+		if d.reading { // the loop wont acknowledge before the line is read.
+			d.cancel()
+		}
+	}
+	d.mu.Unlock()
+
+	switch d.ClosePolicy {
+	case CloseCooperative:
+		// the loop acknowledges once the running command returns.
+		<-notify
+		d.cancel()
+	case CloseDetach:
+		d.cancel()
+
+		timeout := d.CloseTimeout
+		if timeout <= 0 {
+			timeout = defaultCloseTimeout
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			close(detach)
+			<-notify
+		}
+	default:
+		d.cancel()
+		<-notify
+	}
+
+	return nil
+}
+
+// setReading records whether the reader loop waits for a line. A Close signalled before the loop started waiting cancels
+// the read right away, CloseCooperative only cancels the reads which were already waiting.
+func (d *Dialogue) setReading(reading bool) {
 	d.mu.Lock()
-	if !d.running {
-		d.mu.Unlock()
-		return nil
+	defer d.mu.Unlock()
+
+	d.reading = reading
+	if reading && !d.running && d.closedBy == ErrClosed {
+		d.cancel()
+	}
+}
+
+// detachable runs dispatch, in its own go routine with CloseDetach so the loop can return while the dispatch keeps
+// running. It reports whether the dispatch was detached by Close.
+func (d *Dialogue) detachable(dispatch func() error) (bool, error) {
+	if d.ClosePolicy != CloseDetach {
+		return false, dispatch()
 	}
-	notify := d.signalClosingLocked()
+
+	d.mu.Lock()
+	detach := d.detach
 	d.mu.Unlock()
 
-	d.cancel()
-	<-notify
-	return nil
+	done := make(chan error, 1)
+	go func() {
+		done <- dispatch()
+	}()
+
+	select {
+	case err := <-done:
+		return false, err
+	case <-detach:
+		return true, nil
+	}
 }
 
 // Shutdown gracefully shuts down the dialogue waiting for the current Read() or Command.Exec() opperation
 // without any interuption. It waits indefenetly for the current transaction to finish or till the provided context
 // expires. When the context expires the underlaying context is cancelled and the rest of the opperation behaves like a normal
-// call to Close().
+// call to Close(). With DrainOnShutdown the lines already read from R are dispatched before the dialogue closes. The running
+// command can check ShuttingDown to finish early.
 func (d *Dialogue) Shutdown(ctx context.Context) error {
+	d.schedules.cancel()
+
 	d.mu.Lock()
 	if !d.running {
 		d.mu.Unlock()
 		return nil
 	}
-	notify := d.signalClosingLocked()
+	notify := d.signalClosingLocked(ErrShutdown)
+	close(d.shutdown)
 	d.mu.Unlock()
 
 	select {
@@ -327,6 +1718,298 @@ func (d *Dialogue) Shutdown(ctx context.Context) error {
 	}
 }
 
+// defaultCloseTimeout is the default time Close waits for the running command with CloseDetach.
+const defaultCloseTimeout = 5 * time.Second
+
+// startDrain switches the default line reader to the lines it already buffered once Shutdown is called, see
+// DrainOnShutdown. It reports whether the reader was switched.
+func (d *Dialogue) startDrain() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	r, ok := d.reader.(*scannerLineReader)
+	if !ok || !d.DrainOnShutdown || d.running || d.closedBy != ErrShutdown {
+		return false
+	}
+
+	r.src.drained = true
+	r.lines.dropPartial = true
+	return true
+}
+
+// Execute dispatches a single command line through the same path as the lines read by Open, without the interactive loop,
+// and returns the error of the command. The output of the command is written to W.
+//
+// Execute can be called on a running dialogue, in which case the line waits for the current dispatch, or before the
+// dialogue is opened for example to run a command on startup and then drop into Open. The dispatch context is derived
+// from ctx. Outside of Open the dialogue is prepared by the first call to Execute, again after the commands change.
+//
+// The line isnt read from R so the command cant read from it either: the commands which require confirmation need -y
+// unless ConfirmPolicy skips the prompt, ErrNoInput is returned otherwise.
+func (d *Dialogue) Execute(ctx context.Context, line string) error {
+	pooled := splitFields(line)
+	defer putFields(pooled)
+
+	fields := *pooled
+	if len(fields) == 0 {
+		return nil
+	}
+
+	d.mu.Lock()
+	if !d.running && !d.prepared {
+		if err := d.prepareLocked(); err != nil {
+			d.mu.Unlock()
+			return err
+		}
+	}
+	d.mu.Unlock()
+
+	d.dispatching.Lock()
+	defer d.dispatching.Unlock()
+
+	d.out.begin()
+	defer d.out.end()
+
+	d.beginResult(fields[0])
+	err := d.dispatchHandler(ctx, line, fields)
+	d.endResult(err)
+
+	return err
+}
+
+// ErrCommandNotFound is returned by ParseLine when the line doesnt name a registered command.
+type ErrCommandNotFound struct {
+	Name string
+}
+
+func (e ErrCommandNotFound) Error() string {
+	return fmt.Sprintf("dialogue: command %v not found", e.Name)
+}
+
+// ErrEmptyLine is returned by ParseLine for lines without any fields.
+var ErrEmptyLine = errors.New("dialogue: empty line")
+
+// ParseLine tokenizes line and resolves it to a call chain the way a dispatch would ($LAST, aliases, namespaces, sub commands
+// and flags) without executing it, use it to test or fuzz a command tree. The flag values are reset before ParseLine returns,
+// even on errors, so only the resolved commands, their positional args and the pass-through args are reported. Errors of
+// the flag sets are returned as is, the flag sets still write them to their output. The disabled commands (see
+// Command.Enabled) arent found.
+//
+// The lazy commands arent constructed by ParseLine, until they are constructed by a dispatch they resolve to a single
+// invocation holding all the args of the line.
+//
+// Like Execute, ParseLine can be called before the dialogue is opened.
+func (d *Dialogue) ParseLine(line string) (*CallChain, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, ErrEmptyLine
+	}
+
+	d.mu.Lock()
+	if !d.running && !d.prepared {
+		if err := d.prepareLocked(); err != nil {
+			d.mu.Unlock()
+			return nil, err
+		}
+	}
+	d.mu.Unlock()
+
+	// the flag sets are shared with the dispatches.
+	d.dispatching.Lock()
+	defer d.dispatching.Unlock()
+
+	fields = d.expandLast(fields)
+	cmd, ok := d.command(fields[0])
+	if ok && !cmd.enabled(d.dispatchContext(context.Background(), line, cmd)) {
+		ok = false
+	}
+	// the redirects were checked on startup.
+	for ok && cmd.RedirectTo != "" {
+		cmd, ok = d.command(cmd.RedirectTo)
+	}
+	if !ok {
+		return nil, ErrCommandNotFound{fields[0]}
+	}
+
+	if cmd.lazy != nil {
+		if cmd.lazy.cmd == nil {
+			return &CallChain{&Invocation{Command: cmd, args: fields[1:]}}, nil
+		}
+		cmd = cmd.lazy.cmd
+	}
+
+	chain, err := cmd.parse(fields[1:])
+	if err != nil {
+		return nil, err
+	}
+	chain.clean()
+
+	return chain, nil
+}
+
+// Restart swaps the reader of a closed dialogue for r and resets it like Reset, the next call to Open reads from r.
+func (d *Dialogue) Restart(r io.Reader) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return errors.New("dialogue: cannot restart a running dialogue")
+	}
+
+	d.R = r
+	d.resetLocked()
+	return nil
+}
+
+// decode wraps r with the decoder of Encoding, if any.
+func (d *Dialogue) decode(r io.Reader) io.Reader {
+	if d.Encoding == nil {
+		return r
+	}
+
+	return d.Encoding(r)
+}
+
+// SwapReader replaces R with r, for example to read the rest of a session from a file or to fail over from a closed
+// connection to stdin. The preamptive reader over the previous R is drained: the bytes it buffered and the lines scanned
+// ahead of the current one are dropped, the read stranded on the previous R, if any, is left to return on its own.
+//
+// During a session the swap happens between commands: the lines are read from r starting with the next prompt. If the
+// dialogue is waiting for a line when SwapReader is called, the swap happens once the read returns, the line is still
+// dispatched unless the read failed, in which case the dialogue continues with r instead of ending. Like R, r is unused
+// when LineReader is set.
+func (d *Dialogue) SwapReader(r io.Reader) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		d.swap = r
+		return
+	}
+
+	d.swapLocked(r)
+}
+
+// applySwap swaps the reader set by SwapReader during the session, it reports whether there was one.
+func (d *Dialogue) applySwap() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.swap == nil {
+		return false
+	}
+
+	d.swapLocked(d.swap)
+	d.pr = NewPreamptiveReader(d.ctx, d.sourceLocked())
+	if d.LineReader == nil {
+		d.reader = d.newScannerLineReader()
+	}
+
+	return true
+}
+
+// swapLocked sets R to r and drains the preamptive reader, a new one is created over r by applySwap or init.
+func (d *Dialogue) swapLocked(r io.Reader) {
+	if d.pr != nil {
+		d.pr.drain()
+	}
+	d.pauseKeysLocked()
+	d.R, d.pr, d.swap, d.keys = r, nil, nil, nil
+}
+
+// SetWriter replaces W with w, for example to redirect the output of the rest of a session to a file. During a session the
+// writer is replaced between dispatches: the output of the current command and of any scheduled command running with it
+// still goes to the previous W and the next prompt is written to w. The theme and the terminal size picked for the
+// previous W are kept until the dialogue is opened again.
+func (d *Dialogue) SetWriter(w io.Writer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		d.nextW = w
+		return
+	}
+
+	d.W = w
+	d.prepared = false // the output capture wraps W.
+}
+
+// applyWriter replaces W with the writer set by SetWriter during the session, if any.
+func (d *Dialogue) applyWriter() {
+	d.dispatching.Lock()
+	defer d.dispatching.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.nextW == nil {
+		return
+	}
+
+	if d.flow != nil {
+		d.flow.flush() // keep the output of the previous writer in order.
+	}
+
+	d.W, d.nextW = d.nextW, nil
+	d.out.setWriter(d.writerLocked())
+}
+
+// Reset prepares a closed dialogue to be opened again from a clean state. The preamptive reader is dropped along with any
+// bytes it buffered and a fresh one is created over R by the next call to Open, the base context is rebuilt and the runtime
+// state of the last run is cleared: the last output, the undo stack, any pending transaction, the exit status and the flag
+// values of the commands, sticky or not.
+//
+// The registered commands and the dialogue fields survive a reset, as do the state persisted in Store and the history which
+// are reloaded by Open. Note that a read stranded on R by the last run isnt cancelled, the bytes it reads are lost.
+func (d *Dialogue) Reset() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return errors.New("dialogue: cannot reset a running dialogue")
+	}
+
+	d.resetLocked()
+	return nil
+}
+
+func (d *Dialogue) resetLocked() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.pauseKeysLocked()
+	d.schedules.cancel()
+	d.ctx, d.cancel, d.pr, d.swap, d.keys = nil, nil, nil, nil, nil
+
+	if d.out != nil {
+		d.out.reset()
+	}
+	d.undo.reset()
+	d.last.reset()
+	d.userAlias.reset()
+	d.userEnv.reset()
+	d.tx = nil
+	d.status, d.closedBy = 0, nil
+	d.resetFlagsLocked()
+	d.invalidateLocked()
+}
+
+// resetFlagsLocked sets the flags of every command back to their default values, including the sticky flags and the lazy
+// commands already constructed.
+func (d *Dialogue) resetFlagsLocked() {
+	walkCommands(d.commands, func(cmd *Command) error {
+		if cmd.lazy != nil && cmd.lazy.cmd != nil {
+			return walkCommands(map[string]*Command{cmd.Name: cmd.lazy.cmd}, func(built *Command) error {
+				built.resetFlags()
+				return nil
+			})
+		}
+
+		cmd.resetFlags()
+		return nil
+	})
+}
+
 // RegisterCommands registers the provided commands to the dialogue. If the dialogue is running the call is no-op. RegisterCommands
 // can be called even after a call to Close() or Shutdown() as long as the dialogue isnt running.
 func (d *Dialogue) RegisterCommands(cmds ...*Command) {
@@ -344,6 +2027,98 @@ func (d *Dialogue) RegisterCommands(cmds ...*Command) {
 	for _, c := range cmds {
 		d.commands[c.Name] = c
 	}
+	d.invalidateLocked()
+}
+
+// ErrDuplicateCommand is returned by RegisterCommandsStrict when a command name or alias is already taken.
+type ErrDuplicateCommand struct {
+	name string
+}
+
+func (e ErrDuplicateCommand) Error() string {
+	return fmt.Sprintf("dialogue: a command named %v is already registered", e.name)
+}
+
+// RegisterCommandsStrict is like RegisterCommands but it returns an error instead of overwriting commands: the names and
+// aliases of cmds cant be taken by the registered commands, by the builtin commands enabled on the dialogue (such as
+// HelpCmd) or by each other. Either all the commands are registered or none, an error is returned if the dialogue is
+// running.
+func (d *Dialogue) RegisterCommandsStrict(cmds ...*Command) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return errors.New("dialogue: cannot register commands on a running dialogue")
+	}
+
+	taken := make(map[string]bool)
+	for _, name := range d.builtinNamesLocked() {
+		taken[name] = true
+	}
+	for name, cmd := range d.commands {
+		taken[name] = true
+		for _, alias := range cmd.Aliases {
+			taken[alias] = true
+		}
+	}
+
+	for _, c := range cmds {
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			if taken[name] {
+				return ErrDuplicateCommand{name}
+			}
+			taken[name] = true
+		}
+	}
+
+	if d.commands == nil {
+		d.commands = make(map[string]*Command)
+	}
+
+	for _, c := range cmds {
+		d.commands[c.Name] = c
+	}
+	d.invalidateLocked()
+	return nil
+}
+
+// UnregisterCommands removes the commands registered under names from the dialogue. An unregistered builtin command isnt
+// installed again when the dialogue is reopened, the dialogue field which enables it (such as QuitCmd) is left as is. If the
+// dialogue is running the call is no-op.
+func (d *Dialogue) UnregisterCommands(names ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return
+	}
+
+	for _, name := range names {
+		delete(d.commands, name)
+		for _, def := range d.builtins() {
+			if *def.field == name {
+				if d.removed == nil {
+					d.removed = make(map[string]bool)
+				}
+				d.removed[name] = true
+			}
+		}
+	}
+	d.invalidateLocked()
+}
+
+// ReplaceCommand registers cmd in place of the command registered under the same name, it is no-op if there is no such
+// command or if the dialogue is running. Replacing a builtin command keeps the replacement across reopens.
+func (d *Dialogue) ReplaceCommand(cmd *Command) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.commands[cmd.Name]; d.running || !ok {
+		return
+	}
+
+	d.commands[cmd.Name] = cmd
+	d.invalidateLocked()
 }
 
 // PreamptiveReader returns the underlaying preamptive reader used by the dialogue. The underlaying preamptive reader can be
@@ -366,7 +2141,7 @@ func (d *Dialogue) PreamptiveReader() *PreamptiveReader {
 	return d.pr
 }
 
-// Visit visits all the commands available in the dialogue at the time of calling in lexicographical order.
+// Visit visits all the commands available in the dialogue at the time of calling ordered by Command.SortOrder and name.
 func (d *Dialogue) Visit(fn func(*Command)) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -376,6 +2151,81 @@ func (d *Dialogue) Visit(fn func(*Command)) {
 	}
 }
 
+// command returns the command registered under name in the current namespace, under name or the command name is an alias
+// of.
+func (d *Dialogue) command(name string) (*Command, bool) {
+	if name, ok := d.namespace.resolve(name, d.commands); ok {
+		return d.commands[name], true
+	}
+
+	if cmd, ok := d.commands[name]; ok {
+		return cmd, true
+	}
+
+	cmd, ok := d.aliases[name]
+	return cmd, ok
+}
+
+// enabledCommands returns the commands of the dialogue which are enabled in ctx, see Command.Enabled.
+func (d *Dialogue) enabledCommands(ctx context.Context) map[string]*Command {
+	var disabled bool
+	for _, cmd := range d.commands {
+		if !cmd.enabled(ctx) {
+			disabled = true
+			break
+		}
+	}
+	if !disabled {
+		return d.commands
+	}
+
+	out := make(map[string]*Command, len(d.commands))
+	for name, cmd := range d.commands {
+		if cmd.enabled(ctx) {
+			out[name] = cmd
+		}
+	}
+
+	return out
+}
+
+// checkRedirectLocked checks that the redirects starting at cmd end at a registered command.
+func (d *Dialogue) checkRedirectLocked(cmd *Command) error {
+	for hops, next := 0, cmd; next.RedirectTo != ""; hops++ {
+		to, ok := d.commands[next.RedirectTo]
+		if !ok || hops == len(d.commands) {
+			return ErrBadRedirect{cmd.Name, cmd.RedirectTo}
+		}
+		next = to
+	}
+
+	return nil
+}
+
+// checkSeeAlsoLocked checks that the commands referenced by cmd are registered, under their name or an alias.
+func (d *Dialogue) checkSeeAlsoLocked(cmd *Command) error {
+	for _, ref := range cmd.SeeAlso {
+		if d.commands[ref] == nil && d.aliases[ref] == nil {
+			return ErrBadSeeAlso{cmd.Name, ref}
+		}
+	}
+
+	return nil
+}
+
+// indexAliasesLocked maps the aliases of the commands to the commands, the names of the commands take precedence over the
+// aliases and the first command in the help order wins if an alias is shared.
+func (d *Dialogue) indexAliasesLocked() {
+	d.aliases = make(map[string]*Command)
+	for _, cmd := range sortCommands(d.commands) {
+		for _, alias := range cmd.Aliases {
+			if _, ok := d.commands[alias]; !ok && d.aliases[alias] == nil {
+				d.aliases[alias] = cmd
+			}
+		}
+	}
+}
+
 func sortCommands(commands map[string]*Command) []*Command {
 	out := make([]*Command, len(commands))
 
@@ -386,24 +2236,93 @@ func sortCommands(commands map[string]*Command) []*Command {
 	}
 
 	sort.Slice(out, func(i, j int) bool {
+		if out[i].SortOrder != out[j].SortOrder {
+			return out[i].SortOrder < out[j].SortOrder
+		}
 		return out[i].Name < out[j].Name
 	})
 
 	return out
 }
 
-func (d *Dialogue) defaultCmdNotFound(_ context.Context, args []string) error {
-	fmt.Fprintf(d.W, "Command: %v not found\n", args[0])
-	fmt.Fprint(d.W, d.FormatHelp("", d.commands))
+func (d *Dialogue) defaultCmdNotFound(ctx context.Context, args []string) error {
+	d.last.fail(ErrCommandNotFound{args[0]})
+	d.renderer.PrintError(fmt.Errorf("Command: %v not found", args[0]))
+
+	r := d.renderer
+	if w := d.usageWriter(); w != nil {
+		r = d.rendererTo(r, w)
+	}
+	printText(r, d.FormatHelp("", d.enabledCommands(ctx)))
 
 	return nil
 }
 
-func defaultHelpFormater(cmd string, cmds map[string]*Command) (out string) {
-	if cmd == "" { // format all commands if no cmd name provided.
+// helpCache caches the output of the default help formatter for the current command set. It is invalidated whenever the
+// command set can change: on registration, compilation and on every dialogue startup.
+type helpCache struct {
+	mu     sync.Mutex
+	out    map[string]string   // out maps the command name (empty for all commands) to the formatted output.
+	format commandHelpFormater // format is the default Command.FormatHelp, set on startup.
+}
+
+func (c *helpCache) invalidate() {
+	c.mu.Lock()
+	c.out = nil
+	c.mu.Unlock()
+}
+
+// cachedHelpFormater is the default FormatHelp, it wraps defaultHelpFormater with the help cache. It assumes cmds is the
+// command set of the dialogue or a subset of it without the disabled commands which is the case for all the default
+// implementations.
+func (d *Dialogue) cachedHelpFormater(cmd string, cmds map[string]*Command) string {
+	d.help.mu.Lock()
+	defer d.help.mu.Unlock()
+
+	// the output differs with every set of disabled commands.
+	key := cmd
+	if len(cmds) != len(d.commands) {
+		var hidden []string
+		for name := range d.commands {
+			if _, ok := cmds[name]; !ok {
+				hidden = append(hidden, name)
+			}
+		}
+		sort.Strings(hidden)
+		key += "\x00" + strings.Join(hidden, "\x00")
+	}
+
+	if out, ok := d.help.out[key]; ok {
+		return out
+	}
+
+	if d.help.out == nil {
+		d.help.out = make(map[string]string)
+	}
+
+	out := defaultHelpFormater(d.theme, cmd, cmds)
+	d.help.out[key] = out
+	return out
+}
+
+func defaultHelpFormater(t Theme, cmd string, cmds map[string]*Command) (out string) {
+	if cmd == "" { // format all commands if no cmd name provided, the namespaced commands are grouped under headings.
 		var b strings.Builder
-		for _, cmd := range sortCommands(cmds) {
-			b.WriteString(cmd.FormatHelp(cmd, false))
+		root, names, groups := groupByNamespace(sortCommands(cmds))
+		for _, cmd := range root {
+			b.WriteString(cmd.formatHelp(false))
+		}
+
+		for _, ns := range names {
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(t.style(t.Heading, strings.ToUpper(ns)))
+			b.WriteByte('\n')
+
+			for _, cmd := range groups[ns] {
+				b.WriteString(cmd.formatHelp(false))
+			}
 		}
 
 		out = b.String()
@@ -413,7 +2332,7 @@ func defaultHelpFormater(cmd string, cmds map[string]*Command) (out string) {
 			return "command not found\n"
 		}
 
-		out = c.FormatHelp(c, true)
+		out = c.formatHelp(true)
 	}
 
 	return out
@@ -3,8 +3,13 @@ package dialogue
 import (
 	"bytes"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -41,8 +46,8 @@ func TestShutdownWaitCurrentTransaction(t *testing.T) {
 			t.Fatal("expected to close after 3 seconds")
 		}
 
-		if err != ErrDialogueClosed {
-			t.Fatalf("expected error to be %v but got %v", ErrDialogueClosed, err)
+		if err != ErrShutdown {
+			t.Fatalf("expected error to be %v but got %v", ErrShutdown, err)
 		}
 
 		// get the underlaying reader to check if there was only one call to read.
@@ -82,8 +87,8 @@ func TestShutdownDeadline(t *testing.T) {
 
 	select {
 	case err := <-closed:
-		if err != ErrDialogueClosed {
-			t.Fatalf("expected error to be %v but got %v", ErrDialogueClosed, err)
+		if err != ErrShutdown {
+			t.Fatalf("expected error to be %v but got %v", ErrShutdown, err)
 		}
 
 		// take over the failed read to confirm it happened.
@@ -119,7 +124,7 @@ func TestHelpCommand(t *testing.T) {
 		}
 		d.RegisterCommands(testCommand)
 
-		if err := d.Open(); err != ErrDialogueClosed {
+		if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
 			t.Fatalf("got unexpected error: %v", err)
 		}
 
@@ -142,7 +147,7 @@ func TestHelpCommand(t *testing.T) {
 		w := newWriteExpected(t, []byte(d.FormatHelp("", d.commands)))
 		d.W = w
 
-		if err := d.Open(); err != ErrDialogueClosed {
+		if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
 			t.Fatalf("recieved unexpected err: %v", err)
 		}
 
@@ -165,7 +170,7 @@ func TestDefaultCommandNotFound(t *testing.T) {
 	w := newWriteExpected(t, []byte(expected))
 	d.W = w
 
-	if err := d.Open(); err != ErrDialogueClosed {
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
 		t.Fatalf("recieved unexpected err: %v", err)
 	}
 
@@ -182,7 +187,7 @@ func TestDefaultCommandQuit(t *testing.T) {
     }
     d.RegisterCommands(testCommand)
 
-    if err := d.Open(); err != ErrDialogueClosed {
+    if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
         t.Fatalf("recieved unexpected err: %v", err)
     }
 
@@ -259,3 +264,2059 @@ func (w *writeExpected) Flush() error {
 
 	return nil
 }
+
+func TestValidateArgs(t *testing.T) {
+	var hookErr error
+	w := newWriteExpected(t, []byte("validated: expected 1 arguments but got 2\n"))
+
+	d := &Dialogue{
+		R:       strings.NewReader("validated a b\nquit\n"),
+		W:       w,
+		QuitCmd: "quit",
+		OnError: func(_ context.Context, _ string, err error) {
+			hookErr = err
+		},
+	}
+	d.RegisterCommands(&Command{
+		Name: "validated",
+		ValidateArgs: func(args []string) error {
+			return Validate(args, Range(1, 1))
+		},
+		Exec: func(_ *CallChain, _ []string) error {
+			t.Fatal("command not expected to run")
+			return nil
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if hookErr == nil {
+		t.Fatal("expected the error hook to be called")
+	}
+}
+
+func TestHelpCommandMalformed(t *testing.T) {
+	var hookErr error
+
+	d := &Dialogue{
+		R:       strings.NewReader("help -x\nquit\n"),
+		W:       nopReadWriter{},
+		HelpCmd: "help",
+		QuitCmd: "quit",
+		OnError: func(_ context.Context, _ string, err error) {
+			hookErr = err
+		},
+	}
+	d.RegisterCommands(testCommand)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if hookErr == nil {
+		t.Fatal("expected the parse error to be reported to the error hook")
+	}
+}
+
+func TestUsageOnError(t *testing.T) {
+	type testCase struct {
+		policy   UsagePolicy
+		expected string
+	}
+
+	testCases := []testCase{
+		{nil, "flag provided but not defined: -x\nfocused\n"},
+		{UsageShort, "flag provided but not defined: -x\nnot focused"},
+		{UsageErrorOnly, "flag provided but not defined: -x\n"},
+	}
+
+	for _, tc := range testCases {
+		w := newWriteExpected(t, []byte(tc.expected))
+		fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+		fs.SetOutput(w)
+
+		d := &Dialogue{
+			R:       strings.NewReader("usage -x\nquit\n"),
+			W:       nopReadWriter{},
+			QuitCmd: "quit",
+		}
+		d.RegisterCommands(&Command{
+			Name:         "usage",
+			FlagSet:      fs,
+			FormatHelp:   testCommand.FormatHelp,
+			UsageOnError: tc.policy,
+			Exec:         testCommand.Exec,
+		})
+
+		if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+			t.Fatalf("recieved unexpected err: %v", err)
+		}
+
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCommandNotFoundRawLine(t *testing.T) {
+	var hookLine, notFoundLine string
+	var notFoundArgs []string
+
+	d := &Dialogue{
+		R:       strings.NewReader("  unknown   a  'b c'\nquit\n"),
+		W:       nopReadWriter{},
+		QuitCmd: "quit",
+		OnUnknownCommand: func(_ context.Context, line string) {
+			hookLine = line
+		},
+		CommandNotFound: func(ctx context.Context, args []string) error {
+			notFoundLine, _ = LineFromContext(ctx)
+			notFoundArgs = append([]string(nil), args...)
+			return nil
+		},
+	}
+	d.RegisterCommands(testCommand)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	expected := "  unknown   a  'b c'"
+	if hookLine != expected || notFoundLine != expected {
+		t.Fatalf("expected raw line %q but got hook: %q not found: %q", expected, hookLine, notFoundLine)
+	}
+
+	if len(notFoundArgs) != 4 || notFoundArgs[0] != "unknown" {
+		t.Fatalf("unexpected args: %q", notFoundArgs)
+	}
+}
+
+func TestFlagDefaultsFromEnvAndConfig(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{"defaults": {"n": 2, "name": "config"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DEFAULTS_NAME", "env")
+
+	fs := flag.NewFlagSet("defaults", flag.ContinueOnError)
+	n := fs.Int("n", 1, "")
+	name := fs.String("name", "default", "")
+
+	var got []string
+	d := &Dialogue{
+		R:          strings.NewReader("defaults\ndefaults -n 3 -name cli\nquit\n"),
+		W:          nopReadWriter{},
+		QuitCmd:    "quit",
+		ConfigFile: config,
+	}
+	d.RegisterCommands(&Command{
+		Name:      "defaults",
+		FlagSet:   fs,
+		EnvPrefix: "DEFAULTS_",
+		Exec: func(_ *CallChain, _ []string) error {
+			got = append(got, fmt.Sprintf("%d %s", *n, *name))
+			return nil
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if expected := []string{"2 env", "3 cli"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v but got %v", expected, got)
+	}
+
+	if *n != 1 || *name != "default" {
+		t.Fatalf("expected flags to be reset after the invocation but got %d %s", *n, *name)
+	}
+}
+
+func TestUnknownConfigFlag(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{"deploy": {"n": 2}, "app": {"nope": "x"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	fs.Int("n", 1, "")
+
+	d := &Dialogue{R: strings.NewReader(""), W: nopReadWriter{}, ConfigFile: config}
+	d.RegisterCommands(&Command{
+		Name:        "deploy",
+		FlagSet:     fs,
+		SubCommands: []*Command{{Name: "app", Exec: testCommand.Exec}},
+		Exec:        testCommand.Exec,
+	})
+
+	expected := ErrUnknownConfigFlag{"app", "nope"}
+	if err := d.Compile(); err != expected {
+		t.Fatalf("expected %v, got: %v", expected, err)
+	}
+	if err := d.Open(); err != expected {
+		t.Fatalf("expected %v, got: %v", expected, err)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	var called bool
+	sub := &Command{
+		Name:      "Sub",
+		HelpShort: "compiled help",
+		Exec: func(_ *CallChain, _ []string) error {
+			called = true
+			return nil
+		},
+	}
+	root := &Command{
+		Name:        "root",
+		SubCommands: []*Command{sub},
+		Exec:        testCommand.Exec,
+	}
+
+	d := &Dialogue{
+		R:       strings.NewReader("root sub\nquit\n"),
+		W:       nopReadWriter{},
+		QuitCmd: "quit",
+	}
+	d.RegisterCommands(root)
+
+	if err := d.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	if root.subIndex["sub"] != sub {
+		t.Fatal("expected the sub command to be indexed")
+	}
+
+	// compiled help isnt affected by later changes.
+	sub.HelpShort = "changed"
+	if help := sub.formatHelp(false); !strings.Contains(help, "compiled help") {
+		t.Fatalf("expected precomputed help but got %q", help)
+	}
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if !called {
+		t.Fatal("expected the sub command to be called")
+	}
+}
+
+func BenchmarkDispatch(b *testing.B) {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.Int("n", 1, "")
+
+	sub := &Command{
+		Name: "sub",
+		Exec: func(chain *CallChain, _ []string) error {
+			return chain.AdvanceExec(1, chain.GetCurrent().Context())
+		},
+	}
+	d := &Dialogue{W: nopReadWriter{}, R: strings.NewReader("")}
+	d.RegisterCommands(&Command{
+		Name:        "bench",
+		FlagSet:     fs,
+		SubCommands: []*Command{sub},
+		Exec: func(_ *CallChain, _ []string) error {
+			return nil
+		},
+	})
+
+	if err := d.init(); err != nil {
+		b.Fatal(err)
+	}
+
+	line := "bench -n 3 a b sub c d"
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		fields := splitFields(line)
+		if err := d.dispatchHandler(d.ctx, line, *fields); err != nil {
+			b.Fatal(err)
+		}
+		putFields(fields)
+	}
+}
+
+// BenchmarkExecute measures the path of the machine driven sessions which hand every line to Execute.
+func BenchmarkExecute(b *testing.B) {
+	fs := flag.NewFlagSet("call", flag.ContinueOnError)
+	fs.String("id", "", "")
+
+	d := &Dialogue{W: nopReadWriter{}}
+	d.RegisterCommands(&Command{
+		Name:    "call",
+		FlagSet: fs,
+		Exec: func(_ *CallChain, _ []string) error {
+			return nil
+		},
+	})
+
+	ctx := context.Background()
+	lines := []string{"call -id 1 ping", "call -id 2 status a", "call -id 3 echo a b c"}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := d.Execute(ctx, lines[i%len(lines)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOpen(b *testing.B) {
+	d := &Dialogue{
+		R:       strings.NewReader(strings.Repeat("test a b c\n", b.N) + "quit\n"),
+		W:       nopReadWriter{},
+		QuitCmd: "quit",
+	}
+	d.RegisterCommands(&Command{
+		Name: "test",
+		Exec: func(_ *CallChain, _ []string) error {
+			return nil
+		},
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		b.Fatalf("recieved unexpected err: %v", err)
+	}
+}
+
+func TestHelpCache(t *testing.T) {
+	d := &Dialogue{}
+	d.RegisterCommands(testCommand)
+	if err := d.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &Command{Name: "cached", HelpShort: "before", Exec: testCommand.Exec}
+	d.commands["cached"] = cmd
+	cmd.init(commandHelpFormater{})
+
+	before := d.FormatHelp("", d.commands)
+	cmd.HelpShort = "after"
+	if d.FormatHelp("", d.commands) != before {
+		t.Fatal("expected the help output to be cached")
+	}
+
+	d.running = false
+	d.RegisterCommands(cmd)
+	if out := d.FormatHelp("", d.commands); !strings.Contains(out, "after") {
+		t.Fatalf("expected registration to invalidate the cache but got %q", out)
+	}
+}
+
+func TestTheme(t *testing.T) {
+	theme := &Theme{Error: "<e>", Prompt: "<p>"}
+	w := newWriteExpected(t, []byte("<p>> \x1b[0m<e>Command: unknown not found\x1b[0m\n<p>> \x1b[0m"))
+
+	d := &Dialogue{
+		Prefix:     "> ",
+		R:          strings.NewReader("unknown\nquit\n"),
+		W:          w,
+		QuitCmd:    "quit",
+		Theme:      theme,
+		FormatHelp: func(string, map[string]*Command) string { return "" },
+	}
+	d.RegisterCommands(testCommand)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if resolveTheme(os.Stdout) != NoColorTheme {
+		t.Fatal("expected NO_COLOR to select the no color theme")
+	}
+
+	// an empty NO_COLOR doesnt disable the colors.
+	t.Setenv("NO_COLOR", "")
+	if noColor() {
+		t.Fatal("expected an empty NO_COLOR to keep the colors")
+	}
+}
+
+func TestVerbosityCommand(t *testing.T) {
+	w := newWriteExpected(t, []byte("normal\nverbose\nquiet\nnormal\nquiet\n"))
+
+	d := &Dialogue{
+		R:            strings.NewReader("level\nverbosity -v\nlevel\nverbosity -q\nlevel\nverbosity normal\nlevel\nverbosity quiet\nverbosity\nquit\n"),
+		W:            w,
+		QuitCmd:      "quit",
+		VerbosityCmd: "verbosity",
+	}
+	d.RegisterCommands(&Command{
+		Name: "level",
+		Exec: func(chain *CallChain, _ []string) error {
+			_, err := fmt.Fprintln(w, VerbosityFromContext(chain.GetCurrent().Context()))
+			return err
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	w := newWriteExpected(t, []byte("off\n"+
+		"+ root > sub\n"+
+		"+ root -v=true [\"a\"]\n"+
+		"+ sub -n=3 [\"b\" \"c\"]\n"+
+		"+ trace\n"+
+		"+ trace []\n"+
+		"on\n"+
+		"+ trace\n"+
+		"+ trace [\"off\"]\n"))
+
+	rootFs := flag.NewFlagSet("root", flag.ContinueOnError)
+	rootFs.Bool("v", false, "")
+	subFs := flag.NewFlagSet("sub", flag.ContinueOnError)
+	subFs.Int("n", 1, "")
+
+	d := &Dialogue{
+		R:        strings.NewReader("trace\nroot -v a sub -n 3 b c\ntrace on\nroot -v a sub -n 3 b c\ntrace\ntrace off\nroot\nquit\n"),
+		W:        w,
+		QuitCmd:  "quit",
+		TraceCmd: "trace",
+	}
+	d.RegisterCommands(&Command{
+		Name:    "root",
+		FlagSet: rootFs,
+		Exec:    func(_ *CallChain, _ []string) error { return nil },
+		SubCommands: []*Command{
+			{
+				Name:    "sub",
+				FlagSet: subFs,
+				Exec:    func(_ *CallChain, _ []string) error { return nil },
+			},
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	w := newWriteExpected(t, []byte("deleted\noff\nwould delete\n"))
+
+	d := &Dialogue{
+		R:         strings.NewReader("delete\ndry-run\ndry-run on\ndelete\nquit\n"),
+		W:         w,
+		QuitCmd:   "quit",
+		DryRunCmd: "dry-run",
+	}
+	d.RegisterCommands(&Command{
+		Name:           "delete",
+		SupportsDryRun: true,
+		Exec: func(chain *CallChain, _ []string) error {
+			msg := "deleted"
+			if DryRunFromContext(chain.GetCurrent().Context()) {
+				msg = "would delete"
+			}
+
+			_, err := fmt.Fprintln(w, msg)
+			return err
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := defaultCommandHelpFormater(d.commands["delete"], false); out != "delete\t(dry-run)\n" {
+		t.Fatalf("expected dry-run annotation, got: %q", out)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	newDialogue := func(input string, w io.Writer, policy ConfirmPolicy) *Dialogue {
+		d := &Dialogue{
+			R:             strings.NewReader(input),
+			W:             w,
+			QuitCmd:       "quit",
+			ConfirmPolicy: policy,
+		}
+		d.RegisterCommands(&Command{
+			Name:    "delete",
+			Confirm: "delete everything? [y/N]",
+			Exec: func(_ *CallChain, _ []string) error {
+				_, err := fmt.Fprintln(w, "deleted")
+				return err
+			},
+		})
+
+		return d
+	}
+
+	t.Run("Prompt", func(t *testing.T) {
+		w := newWriteExpected(t, []byte("delete everything? [y/N] aborted\ndelete everything? [y/N] deleted\ndeleted\ndeleted\n"))
+		d := newDialogue("delete\nn\ndelete\nYes\ndelete -y\ndelete --yes\nquit\n", w, ConfirmPrompt)
+
+		if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+			t.Fatalf("recieved unexpected err: %v", err)
+		}
+
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("NonInteractive", func(t *testing.T) {
+		w := newWriteExpected(t, []byte("delete: confirmation required, use -y to proceed\ndeleted\n"))
+		d := newDialogue("delete\ndelete -y\nquit\n", w, ConfirmAuto)
+
+		if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+			t.Fatalf("recieved unexpected err: %v", err)
+		}
+
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Yes", func(t *testing.T) {
+		w := newWriteExpected(t, []byte("deleted\n"))
+		d := newDialogue("delete\nquit\n", w, ConfirmYes)
+
+		if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+			t.Fatalf("recieved unexpected err: %v", err)
+		}
+
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSortOrder(t *testing.T) {
+	d := &Dialogue{}
+	d.RegisterCommands(
+		&Command{Name: "a", SortOrder: 1},
+		&Command{Name: "b"},
+		&Command{Name: "c", SortOrder: -1},
+		&Command{Name: "d"},
+	)
+
+	var names []string
+	d.Visit(func(cmd *Command) { names = append(names, cmd.Name) })
+	if expected := []string{"c", "b", "d", "a"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected order %v but got %v", expected, names)
+	}
+
+	root := &Command{
+		Name:        "root",
+		FlagSet:     flag.NewFlagSet("root", flag.ContinueOnError),
+		SubCommands: []*Command{{Name: "z"}, {Name: "y", SortOrder: 1}, {Name: "x"}},
+	}
+	expected := "SUBCOMMANDS\nz: \nx: \ny:\n"
+	if out := (commandHelpFormater{plain: true}).format(root, true); !strings.HasSuffix(out, expected) {
+		t.Fatalf("unexpected sub command order:\n%s", out)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	w := newWriteExpected(t, []byte("Command: nope not found\nsub called\nsub called\n"))
+
+	sub := &Command{
+		Name:    "sub",
+		Aliases: []string{"sous"},
+		Exec: func(_ *CallChain, _ []string) error {
+			_, err := fmt.Fprintln(w, "sub called")
+			return err
+		},
+	}
+
+	d := &Dialogue{
+		R:       strings.NewReader("nope\nroot sous\nracine sub\nsalir\n"),
+		W:       w,
+		QuitCmd: "quit",
+		LocalizeBuiltin: func(cmd *Command) {
+			if cmd.Name == "quit" {
+				cmd.Aliases = []string{"salir"}
+			}
+		},
+		CommandNotFound: func(_ context.Context, args []string) error {
+			_, err := fmt.Fprintf(w, "Command: %v not found\n", args[0])
+			return err
+		},
+	}
+	d.RegisterCommands(&Command{
+		Name:        "root",
+		Aliases:     []string{"racine"},
+		SubCommands: []*Command{sub},
+		Exec: func(chain *CallChain, _ []string) error {
+			return chain.AdvanceExec(0, chain.GetCurrent().Context())
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	var enabled bool
+	w := newWriteExpected(t, []byte(""+
+		"help [-n <command-name>]: outputs the help prompt for all commands or a specified command via the -n flag\nquit: \n"+
+		"beta: beta feature\n"+
+		"help [-n <command-name>]: outputs the help prompt for all commands or a specified command via the -n flag\nquit: \n"+
+		"beta called\n",
+	))
+
+	d := &Dialogue{
+		R:       strings.NewReader("help\nbeta\nhelp\nbeta\nquit\n"),
+		W:       w,
+		HelpCmd: "help",
+		Plain:   true,
+		CommandNotFound: func(_ context.Context, args []string) error {
+			// enable the command after the first failed attempt.
+			enabled = true
+			return nil
+		},
+	}
+	d.RegisterCommands(
+		&Command{
+			Name:      "beta",
+			HelpShort: "beta feature",
+			Enabled:   func(context.Context) bool { return enabled },
+			Exec: func(_ *CallChain, _ []string) error {
+				_, err := fmt.Fprintln(w, "beta called")
+				return err
+			},
+		},
+		&Command{Name: "quit", Exec: func(_ *CallChain, _ []string) error { return ErrDialogueClosed }},
+	)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExitOnErrorWarning(t *testing.T) {
+	var werr bytes.Buffer
+	d := &Dialogue{W: nopReadWriter{}, Werr: &werr}
+	d.RegisterCommands(&Command{
+		Name:    "exit",
+		FlagSet: flag.NewFlagSet("exit", flag.ExitOnError),
+		Exec:    testCommand.Exec,
+	})
+
+	for _, cmd := range []string{"a", "b"} {
+		if err := d.Execute(context.Background(), "exit"); err != nil {
+			t.Fatal(err)
+		}
+		// registering a command compiles the commands again on the next Execute.
+		d.RegisterCommands(&Command{Name: cmd, Exec: testCommand.Exec})
+	}
+
+	if n := strings.Count(werr.String(), "uses flag.ExitOnError"); n != 1 {
+		t.Fatalf("expected the warning to be written once, got: %q", werr.String())
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	w := newWriteExpected(t, []byte("rm is deprecated, use delete instead\ndelete a -f [a -f=true]\ndelete b [b -f=false]\n"))
+
+	var redirects []string
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	force := fs.Bool("f", false, "")
+
+	d := &Dialogue{
+		R:       strings.NewReader("rm a -f\nrm b\nquit\n"),
+		W:       w,
+		QuitCmd: "quit",
+		OnRedirect: func(_ context.Context, from, to string) {
+			redirects = append(redirects, from+"->"+to)
+		},
+	}
+	d.RegisterCommands(
+		&Command{Name: "rm", RedirectTo: "delete"},
+		&Command{
+			Name:             "delete",
+			FlagSet:          fs,
+			InterleavedFlags: true,
+			Exec: func(chain *CallChain, args []string) error {
+				line, _ := LineFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprintf(w, "%v %v\n", line, append(args, fmt.Sprintf("-f=%v", *force)))
+				return err
+			},
+		},
+	)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(redirects, []string{"rm->delete", "rm->delete"}) {
+		t.Fatalf("unexpected redirects: %v", redirects)
+	}
+
+	d = &Dialogue{R: strings.NewReader(""), W: nopReadWriter{}}
+	d.RegisterCommands(&Command{Name: "a", RedirectTo: "b"}, &Command{Name: "b", RedirectTo: "a"})
+	if err := d.Open(); !errors.As(err, &ErrBadRedirect{}) {
+		t.Fatalf("expected a bad redirect error, got: %v", err)
+	}
+}
+
+func TestExit(t *testing.T) {
+	w := newWriteExpected(t, []byte("> > deployment failed\n"))
+
+	d := &Dialogue{
+		Prefix: "> ",
+		R:      strings.NewReader("noop\ndeploy\nnoop\n"),
+		W:      w,
+	}
+	d.RegisterCommands(
+		&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }},
+		&Command{
+			Name: "deploy",
+			Exec: func(_ *CallChain, _ []string) error {
+				return fmt.Errorf("deploy: %w", Exit(3, "deployment failed"))
+			},
+		},
+	)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := d.ExitStatus(); status != 3 {
+		t.Fatalf("expected exit status 3 but got %v", status)
+	}
+
+	if !errors.Is(Exit(1, ""), ErrDialogueClosed) {
+		t.Fatal("expected exit errors to match ErrDialogueClosed")
+	}
+}
+
+func TestTerminationErrors(t *testing.T) {
+	d := &Dialogue{R: strings.NewReader("noop\n"), W: nopReadWriter{}}
+	d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v but got %v", ErrEOF, err)
+	}
+
+	errFatal := errors.New("fatal")
+	d = &Dialogue{R: strings.NewReader("fail\n"), W: nopReadWriter{}}
+	d.RegisterCommands(&Command{Name: "fail", Exec: func(_ *CallChain, _ []string) error { return errFatal }})
+
+	var terminated ErrTerminatedByCommand
+	if err := d.Open(); !errors.As(err, &terminated) || terminated.Name != "fail" || !errors.Is(err, errFatal) {
+		t.Fatalf("expected the dialogue to be terminated by fail, got: %v", err)
+	}
+
+	d = &Dialogue{R: strings.NewReader("quit\n"), W: nopReadWriter{}, QuitCmd: "quit"}
+	d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+	if err := d.Open(); !errors.As(err, &terminated) || terminated.Name != "quit" || !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("expected the dialogue to be terminated by quit, got: %v", err)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	var lines []string
+	d := &Dialogue{R: strings.NewReader("say a\nquit\nsay b\n"), W: nopReadWriter{}, QuitCmd: "quit"}
+	d.RegisterCommands(&Command{
+		Name: "say",
+		Exec: func(_ *CallChain, args []string) error {
+			lines = append(lines, args...)
+			return nil
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	// the bytes left in the old reader are dropped.
+	if err := d.Restart(strings.NewReader("say c\nquit\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if !reflect.DeepEqual(lines, []string{"a", "c"}) {
+		t.Fatalf("expected the lines of both readers but got %v", lines)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	w := newWriteExpected(t, []byte("startup [a]\nCommand: nope not found\ntyped [b]\n"))
+
+	d := &Dialogue{
+		R:       strings.NewReader("echo typed b\nquit\n"),
+		W:       w,
+		QuitCmd: "quit",
+		CommandNotFound: func(_ context.Context, args []string) error {
+			_, err := fmt.Fprintf(w, "Command: %v not found\n", args[0])
+			return err
+		},
+	}
+	d.RegisterCommands(&Command{
+		Name: "echo",
+		Exec: func(_ *CallChain, args []string) error {
+			_, err := fmt.Fprintf(w, "%v %v\n", args[0], args[1:])
+			return err
+		},
+	})
+
+	if err := d.Execute(context.Background(), "echo startup a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Execute(context.Background(), "nope"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenContext(t *testing.T) {
+	r, pw := io.Pipe()
+	defer pw.Close()
+
+	started := make(chan struct{})
+	d := &Dialogue{R: r, W: nopReadWriter{}}
+	d.RegisterCommands(&Command{
+		Name: "block",
+		Exec: func(chain *CallChain, _ []string) error {
+			close(started)
+			<-chain.GetCurrent().Context().Done()
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- d.OpenContext(ctx) }()
+
+	io.WriteString(pw, "block\n")
+	<-started
+
+	// the running command is cancelled right away.
+	cancel()
+	select {
+	case err := <-errs:
+		if err != ErrShutdown {
+			t.Fatalf("expected %v but got %v", ErrShutdown, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("dialogue wasnt closed by the context")
+	}
+}
+
+func TestDone(t *testing.T) {
+	r, pw := io.Pipe()
+	d := &Dialogue{R: r, W: nopReadWriter{}, QuitCmd: "quit"}
+	d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+
+	done := d.Done()
+	if d.Running() {
+		t.Fatal("expected the dialogue not to be running before Open")
+	}
+
+	go d.Open()
+	io.WriteString(pw, "noop\n")
+	if !d.Running() {
+		t.Fatal("expected the dialogue to be running")
+	}
+
+	select {
+	case <-done:
+		t.Fatal("done closed before the dialogue was closed")
+	default:
+	}
+
+	io.WriteString(pw, "quit\n")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("done wasnt closed after the dialogue was closed")
+	}
+
+	if d.Running() {
+		t.Fatal("expected the dialogue to have stopped")
+	}
+
+	// the next session gets a new channel.
+	select {
+	case <-d.Done():
+		t.Fatal("expected a new done channel")
+	default:
+	}
+}
+
+func TestUnregisterAndReplace(t *testing.T) {
+	var calls []string
+	noop := func(name string) *Command {
+		return &Command{Name: name, Exec: func(_ *CallChain, _ []string) error {
+			calls = append(calls, name)
+			return nil
+		}}
+	}
+
+	d := &Dialogue{R: strings.NewReader("a\nquit\n"), W: nopReadWriter{}, QuitCmd: "quit"}
+	d.RegisterCommands(noop("a"), noop("b"))
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	// the quit builtin isnt installed again.
+	d.UnregisterCommands("quit", "b")
+	d.ReplaceCommand(noop("missing"))
+	if err := d.Restart(strings.NewReader("quit\nb\nmissing\na\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if !reflect.DeepEqual(calls, []string{"a", "a"}) || d.QuitCmd != "quit" {
+		t.Fatalf("unexpected calls %v with quit command %q", calls, d.QuitCmd)
+	}
+
+	replaced := noop("a")
+	replaced.HelpShort = "replaced"
+	d.ReplaceCommand(replaced)
+	d.Visit(func(cmd *Command) {
+		if cmd.HelpShort != "replaced" {
+			t.Fatalf("expected the command to be replaced, got: %v", cmd.Name)
+		}
+	})
+
+	// the name of the unregistered builtin is free.
+	if err := d.RegisterCommandsStrict(noop("quit")); err != nil {
+		t.Fatalf("expected the unregistered builtin name to be free, got: %v", err)
+	}
+}
+
+func TestRegisterCommandsStrict(t *testing.T) {
+	d := &Dialogue{HelpCmd: "help"}
+
+	if err := d.RegisterCommandsStrict(&Command{Name: "a", Aliases: []string{"b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmds := range [][]*Command{
+		{{Name: "help"}},
+		{{Name: "b"}},
+		{{Name: "c", Aliases: []string{"a"}}},
+		{{Name: "d"}, {Name: "d"}},
+	} {
+		if err := d.RegisterCommandsStrict(cmds...); !errors.As(err, &ErrDuplicateCommand{}) {
+			t.Fatalf("expected a duplicate command error for %v, got: %v", cmds[len(cmds)-1].Name, err)
+		}
+	}
+
+	if _, ok := d.commands["d"]; ok || len(d.commands) != 1 {
+		t.Fatalf("expected no commands to be registered after a conflict, got: %v", d.commands)
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	d := newParseLineDialogue()
+
+	chain, err := d.ParseLine("old -v app sub x -- y")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := []string{(*chain)[1].Name, (*chain)[0].Name}; !reflect.DeepEqual(names, []string{"deploy", "sub"}) {
+		t.Fatalf("unexpected resolution: %v", names)
+	}
+
+	if args, pt := (*chain)[1].Args(), chain.PassThrough(); !reflect.DeepEqual(args, []string{"app"}) || !reflect.DeepEqual(pt, []string{"y"}) {
+		t.Fatalf("unexpected args %v and pass-through %v", args, pt)
+	}
+
+	if _, err := d.ParseLine("nope"); !errors.As(err, &ErrCommandNotFound{}) {
+		t.Fatalf("expected a command not found error, got: %v", err)
+	}
+
+	if _, err := d.ParseLine("  "); err != ErrEmptyLine {
+		t.Fatalf("expected %v, got: %v", ErrEmptyLine, err)
+	}
+}
+
+func TestParseLineDispatchRules(t *testing.T) {
+	fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	tags := StringSliceFlag(fs, "tag", nil, "")
+	fs.Int("n", 0, "")
+
+	var builds int
+	noop := func(_ *CallChain, _ []string) error { return nil }
+	d := &Dialogue{W: nopReadWriter{}}
+	d.RegisterCommands(
+		&Command{Name: "tag", FlagSet: fs, Exec: noop},
+		&Command{Name: "hidden", Exec: noop, Enabled: func(context.Context) bool { return false }},
+	)
+	d.RegisterLazy("heavy", func() *Command {
+		builds++
+		return &Command{Exec: noop}
+	})
+
+	if _, err := d.ParseLine("hidden"); !errors.As(err, &ErrCommandNotFound{}) {
+		t.Fatalf("expected the disabled command not to be found, got: %v", err)
+	}
+
+	chain, err := d.ParseLine("heavy -x a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if builds != 0 || !reflect.DeepEqual(chain.GetCurrent().Args(), []string{"-x", "a"}) {
+		t.Fatalf("expected the lazy command not to be built, got %v builds and args %v", builds, chain.GetCurrent().Args())
+	}
+
+	if _, err := d.ParseLine("tag -tag a -n x"); err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if len(*tags) != 0 {
+		t.Fatalf("expected the flags to be cleaned after the parse error, got: %v", *tags)
+	}
+}
+
+func FuzzParseLine(f *testing.F) {
+	d := newParseLineDialogue()
+	for _, seed := range []string{"deploy app", "old -v sub", "deploy -v=false -- sub", "deploy -x", "sub", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, line string) {
+		chain, err := d.ParseLine(line)
+		if err != nil {
+			return
+		}
+
+		// the root of the chain is always the resolved command.
+		if root := (*chain)[len(*chain)-1]; root.Name != "deploy" && root.Name != "noop" {
+			t.Fatalf("unexpected root %v for %q", root.Name, line)
+		}
+	})
+}
+
+func newParseLineDialogue() *Dialogue {
+	fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Bool("v", false, "")
+
+	noop := func(_ *CallChain, _ []string) error { return nil }
+	d := &Dialogue{W: nopReadWriter{}}
+	d.RegisterCommands(
+		&Command{Name: "deploy", FlagSet: fs, Exec: noop, SubCommands: []*Command{{Name: "sub", Exec: noop}}},
+		&Command{Name: "old", RedirectTo: "deploy"},
+		&Command{Name: "noop", Exec: noop},
+	)
+
+	return d
+}
+
+func TestMiddleware(t *testing.T) {
+	var trace []string
+	record := func(tag string) func(next StepFunc) StepFunc {
+		return func(next StepFunc) StepFunc {
+			return func(chain *CallChain, args []string) error {
+				trace = append(trace, tag)
+				return next(chain, args)
+			}
+		}
+	}
+
+	d := &Dialogue{W: nopReadWriter{}, Middleware: []func(StepFunc) StepFunc{record("first"), record("second")}}
+	d.RegisterCommands(&Command{
+		Name: "noop",
+		Exec: func(_ *CallChain, _ []string) error {
+			trace = append(trace, "exec")
+			return nil
+		},
+	})
+
+	if err := d.Execute(context.Background(), "noop"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(trace, []string{"first", "second", "exec"}) {
+		t.Fatalf("unexpected trace: %v", trace)
+	}
+}
+
+func TestAbortReported(t *testing.T) {
+	var hookErr error
+	w := newWriteExpected(t, []byte("deploy: aborted: nothing to deploy\n"))
+
+	d := &Dialogue{
+		W: w,
+		OnError: func(_ context.Context, _ string, err error) {
+			hookErr = err
+		},
+	}
+	d.RegisterCommands(&Command{
+		Name: "deploy",
+		Exec: func(chain *CallChain, _ []string) error {
+			return chain.Abort(errors.New("nothing to deploy"))
+		},
+	})
+
+	if err := d.Execute(context.Background(), "deploy"); err != nil {
+		t.Fatalf("expected the abort to be reported, got: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !errors.As(hookErr, &ErrAborted{}) {
+		t.Fatalf("expected the error hook to recieve the abort, got: %v", hookErr)
+	}
+}
+
+func TestExecOrder(t *testing.T) {
+	var executed []string
+	stage := func(name string) func(*CallChain, []string) error {
+		return func(chain *CallChain, _ []string) error {
+			executed = append(executed, name+":"+chain.GetCurrent().Name)
+			return nil
+		}
+	}
+
+	newDialogue := func(order ExecOrder) *Dialogue {
+		set := &Command{Name: "set", Exec: stage("set")}
+		config := &Command{Name: "config", Exec: stage("config"), SubCommands: []*Command{set}}
+		d := &Dialogue{W: nopReadWriter{}, ExecOrder: order}
+		d.RegisterCommands(&Command{Name: "net", Exec: stage("net"), SubCommands: []*Command{config}})
+
+		return d
+	}
+
+	type testCase struct {
+		order    ExecOrder
+		expected []string
+	}
+
+	testCases := []testCase{
+		{ExecOrderDefault, []string{"set:set"}},
+		{ExecRootFirst, []string{"net:net", "config:config", "set:set"}},
+	}
+
+	for _, tc := range testCases {
+		executed = nil
+		if err := newDialogue(tc.order).Execute(context.Background(), "net config set"); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(executed, tc.expected) {
+			t.Fatalf("unexpected execution for order %v: %v", tc.order, executed)
+		}
+	}
+
+	// a stage aborting stops the following ones, the root command overrides the dialogue order.
+	executed = nil
+	d := newDialogue(ExecLeafFirst)
+	d.commands["net"].ExecOrder = ExecRootFirst
+	d.commands["net"].SubCommands[0].Exec = func(chain *CallChain, _ []string) error {
+		executed = append(executed, "config:abort")
+		return chain.Abort(nil)
+	}
+
+	if err := d.Execute(context.Background(), "net config set"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(executed, []string{"net:net", "config:abort"}) {
+		t.Fatalf("expected the abort to stop the stages: %v", executed)
+	}
+}
+
+func TestDeadlineBanner(t *testing.T) {
+	if banner := DeadlineBanner(context.Background()); banner != "" {
+		t.Fatalf("expected no banner without a deadline, got: %v", banner)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if banner := DeadlineBanner(ctx); banner != "1m0s left" {
+		t.Fatalf("unexpected banner: %v", banner)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if banner := DeadlineBanner(ctx); banner != "deadline exceeded" {
+		t.Fatalf("unexpected banner: %v", banner)
+	}
+}
+
+func TestEnableBuiltins(t *testing.T) {
+	d := &Dialogue{W: nopReadWriter{}, HelpCmd: "ayuda"}
+	d.EnableBuiltins(BuiltinHelp | BuiltinTransaction | BuiltinEnv)
+
+	if d.HelpCmd != "ayuda" || d.BeginCmd != "begin" || d.CommitCmd != "commit" || d.AbortCmd != "abort" {
+		t.Fatalf("unexpected builtin names: %q %q %q %q", d.HelpCmd, d.BeginCmd, d.CommitCmd, d.AbortCmd)
+	}
+
+	if d.QuitCmd != "" || d.HistoryCmd != "" {
+		t.Fatal("expected the other builtins to stay disabled")
+	}
+
+	d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+	if err := d.Execute(context.Background(), "env DIALOGUE_TEST_ENV=on"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := d.lookupEnv("DIALOGUE_TEST_ENV"); v != "on" {
+		t.Fatalf("expected env to set the variable, got: %q", v)
+	}
+
+	all := &Dialogue{}
+	all.EnableBuiltins(BuiltinAll)
+	for _, def := range all.builtins() {
+		if *def.field == "" {
+			t.Fatal("expected BuiltinAll to enable every builtin")
+		}
+	}
+}
+
+func TestSeeAlso(t *testing.T) {
+	var buf bytes.Buffer
+	noop := func(_ *CallChain, _ []string) error { return nil }
+	d := &Dialogue{W: &buf, HelpCmd: "help"}
+	d.RegisterCommands(
+		&Command{Name: "deploy", SeeAlso: []string{"rollback", "st"}, Exec: noop},
+		&Command{Name: "rollback", Exec: noop},
+		&Command{Name: "status", Aliases: []string{"st"}, Exec: noop},
+	)
+
+	if err := d.Execute(context.Background(), "help -n deploy"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "deploy\n\nSEE ALSO\nrollback, st\n\nRun \"help -n rollback\" for the help of a referenced command.\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected help: %q", buf.String())
+	}
+
+	bad := &Dialogue{W: nopReadWriter{}}
+	bad.RegisterCommands(&Command{Name: "deploy", SeeAlso: []string{"nope"}, Exec: noop})
+	if err := bad.Execute(context.Background(), "deploy"); !errors.As(err, &ErrBadSeeAlso{}) {
+		t.Fatalf("expected a bad reference error, got: %v", err)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	var audited []string
+	audit := func(next StepFunc) StepFunc {
+		return func(chain *CallChain, args []string) error {
+			if inv := chain.GetCurrent(); inv.Annotations["audit"] == "true" {
+				audited = append(audited, inv.Name)
+			}
+			return next(chain, args)
+		}
+	}
+
+	noop := func(_ *CallChain, _ []string) error { return nil }
+	d := &Dialogue{W: nopReadWriter{}, Middleware: []func(StepFunc) StepFunc{audit}}
+	d.RegisterCommands(
+		&Command{Name: "delete", Annotations: map[string]string{"audit": "true"}, Exec: noop},
+		&Command{Name: "list", Exec: noop},
+	)
+
+	for _, line := range []string{"list", "delete", "list"} {
+		if err := d.Execute(context.Background(), line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !reflect.DeepEqual(audited, []string{"delete"}) {
+		t.Fatalf("unexpected audited commands: %v", audited)
+	}
+}
+
+func TestNonInteractive(t *testing.T) {
+	// a script piped to the process is a file which isnt a terminal.
+	path := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(path, []byte("noop\nnope\nnoop\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer script.Close()
+
+	w := newWriteExpected(t, []byte("Command: nope not found\n"))
+
+	d := &Dialogue{
+		Prefix:     "> ",
+		R:          script,
+		W:          w,
+		FormatHelp: func(string, map[string]*Command) string { return "" },
+	}
+	d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := d.ExitStatus(); status != 1 {
+		t.Fatalf("expected the failure to set the exit status, got %v", status)
+	}
+
+	// the other readers, such as network connections, are interactive: they write the prompt and keep the status.
+	if err := d.Restart(strings.NewReader("noop\n")); err != nil {
+		t.Fatal(err)
+	}
+	d.W = newWriteExpected(t, []byte("> > "))
+	if err := d.Open(); err != ErrEOF || d.ExitStatus() != 0 {
+		t.Fatalf("unexpected result of the interactive session: %v %v", err, d.ExitStatus())
+	}
+
+	// so is a forced interactive session.
+	interactive := true
+	d.Interactive = &interactive
+	if err := d.Restart(strings.NewReader("noop\n")); err != nil {
+		t.Fatal(err)
+	}
+	d.W = newWriteExpected(t, []byte("> > "))
+	if err := d.Open(); err != ErrEOF || d.ExitStatus() != 0 {
+		t.Fatalf("unexpected result of the interactive session: %v %v", err, d.ExitStatus())
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	w := newWriteExpected(t, []byte("a\nCommand: nope not found\n"))
+
+	interactive := true
+	d := &Dialogue{
+		Prefix:      "> ",
+		R:           strings.NewReader("echo a\nnope\n"),
+		W:           w,
+		Quiet:       true,
+		Interactive: &interactive,
+		FormatHelp:  func(string, map[string]*Command) string { return "" },
+	}
+	d.RegisterCommands(&Command{
+		Name: "echo",
+		Exec: func(_ *CallChain, args []string) error {
+			_, err := fmt.Fprintln(w, strings.Join(args, " "))
+			return err
+		},
+	})
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEchoInput(t *testing.T) {
+	w := newWriteExpected(t, []byte("$ echo hi\nhi\n$ nope\nCommand: nope not found\n"))
+
+	interactive := false // a script, the prompt isnt written.
+	d := &Dialogue{
+		Prefix:      "$ ",
+		R:           strings.NewReader("echo hi\n\nnope\n"),
+		W:           w,
+		EchoInput:   true,
+		Interactive: &interactive,
+		FormatHelp:  func(string, map[string]*Command) string { return "" },
+	}
+	d.RegisterCommands(&Command{
+		Name: "echo",
+		Exec: func(_ *CallChain, args []string) error {
+			_, err := fmt.Fprintln(w, strings.Join(args, " "))
+			return err
+		},
+	})
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSwapReader(t *testing.T) {
+	var lines []string
+	pr, pw := io.Pipe()
+	d := &Dialogue{R: strings.NewReader("say a\nsource\nsay b\n"), W: nopReadWriter{}}
+	d.RegisterCommands(
+		&Command{
+			Name: "say",
+			Exec: func(_ *CallChain, args []string) error {
+				lines = append(lines, args...)
+				return nil
+			},
+		},
+		&Command{
+			Name: "source",
+			Exec: func(_ *CallChain, _ []string) error {
+				// the line scanned ahead from the old reader is dropped.
+				d.SwapReader(pr)
+				return nil
+			},
+		},
+	)
+
+	go func() {
+		io.WriteString(pw, "say c\n")
+
+		// fail over to another reader once the pipe is closed.
+		d.SwapReader(strings.NewReader("say d\n"))
+		pw.Close()
+	}()
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if !reflect.DeepEqual(lines, []string{"a", "c", "d"}) {
+		t.Fatalf("expected the lines of every reader but got %v", lines)
+	}
+
+	// swapping a closed dialogue replaces the reader of the next session.
+	d.SwapReader(strings.NewReader("say e\n"))
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if lines[len(lines)-1] != "e" {
+		t.Fatalf("expected the line of the swapped reader but got %v", lines)
+	}
+}
+
+func TestSetWriter(t *testing.T) {
+	var a, b bytes.Buffer
+	d := &Dialogue{R: strings.NewReader("say a\nredirect\nsay b\n"), W: &a}
+	d.RegisterCommands(
+		&Command{
+			Name: "say",
+			Exec: func(chain *CallChain, args []string) error {
+				out, _ := OutFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprintln(out, strings.Join(args, " "))
+				return err
+			},
+		},
+		&Command{
+			Name: "redirect",
+			Exec: func(chain *CallChain, _ []string) error {
+				d.SetWriter(&b)
+
+				// the output of the current command still goes to the previous writer.
+				out, _ := OutFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprintln(out, "redirecting")
+				return err
+			},
+		},
+	)
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if a.String() != "a\nredirecting\n" || b.String() != "b\n" {
+		t.Fatalf("expected the output to be redirected but got %q and %q", a.String(), b.String())
+	}
+
+	if d.W != &b {
+		t.Fatalf("expected W to be replaced")
+	}
+}
+
+func TestCommandOutput(t *testing.T) {
+	var w, log bytes.Buffer
+	d := &Dialogue{R: strings.NewReader("diag hi\ndiag a b\ndiag -x\nhelp -n diag\nsay hi\n"), W: &w, HelpCmd: "help"}
+	d.RegisterCommands(
+		&Command{
+			Name:         "diag",
+			HelpLong:     "writes diagnostics",
+			ValidateArgs: Range(0, 1),
+			Output:       &log,
+			Exec: func(chain *CallChain, args []string) error {
+				out, _ := OutFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprintln(out, args)
+				return err
+			},
+		},
+		&Command{
+			Name: "say",
+			Exec: func(chain *CallChain, args []string) error {
+				out, _ := OutFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprintln(out, args)
+				return err
+			},
+		},
+	)
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if w.String() != "[hi]\n" {
+		t.Fatalf("expected only the output of say on W but got %q", w.String())
+	}
+
+	for _, s := range []string{"[hi]\n", "expected between 0 and 1 arguments", "flag provided but not defined: -x", "writes diagnostics"} {
+		if !strings.Contains(log.String(), s) {
+			t.Fatalf("expected %q in the output of diag but got %q", s, log.String())
+		}
+	}
+}
+
+func TestWerr(t *testing.T) {
+	var w, werr bytes.Buffer
+	d := &Dialogue{
+		R:          strings.NewReader("say hi\nnope\nold there\nsay a b\nhelp -x\n"),
+		W:          &w,
+		Werr:       &werr,
+		HelpCmd:    "help",
+		FormatHelp: func(string, map[string]*Command) string { return "" },
+	}
+	d.RegisterCommands(
+		&Command{
+			Name:         "say",
+			ValidateArgs: Range(0, 1),
+			Exec: func(chain *CallChain, args []string) error {
+				out, _ := OutFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprintln(out, args)
+				return err
+			},
+		},
+		&Command{Name: "old", RedirectTo: "say"},
+	)
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if w.String() != "[hi]\n[there]\n" {
+		t.Fatalf("expected only the output of say on W but got %q", w.String())
+	}
+
+	for _, s := range []string{"nope not found", "old is deprecated", "expected between 0 and 1 arguments", "flag provided but not defined: -x"} {
+		if !strings.Contains(werr.String(), s) {
+			t.Fatalf("expected %q on Werr but got %q", s, werr.String())
+		}
+	}
+}
+
+func TestHelpOutput(t *testing.T) {
+	tests := []struct {
+		policy    HelpOutput
+		w, werr   int  // w and werr are the number of focused helps written to W and Werr.
+		usageWerr bool // usageWerr reports whether the parse error and the help of the unknown command go to Werr.
+	}{
+		{HelpOutputPOSIX, 2, 1, true},
+		{HelpOutputW, 3, 0, false},
+		{HelpOutputWerr, 0, 3, true},
+	}
+
+	for _, tt := range tests {
+		var w, werr bytes.Buffer
+		d := &Dialogue{
+			R:          strings.NewReader("say -x\nsay -h\nhelp -n say\nnope\n"),
+			W:          &w,
+			Werr:       &werr,
+			HelpCmd:    "help",
+			HelpOutput: tt.policy,
+		}
+		d.RegisterCommands(&Command{
+			Name:      "say",
+			HelpShort: "short say",
+			HelpLong:  "long say",
+			Exec:      func(_ *CallChain, _ []string) error { return nil },
+		})
+
+		if err := d.Open(); err != ErrEOF {
+			t.Fatalf("expected %v, got: %v", ErrEOF, err)
+		}
+
+		if n := strings.Count(w.String(), "long say"); n != tt.w {
+			t.Fatalf("policy %v: expected %v helps on W, got: %q", tt.policy, tt.w, w.String())
+		}
+		if n := strings.Count(werr.String(), "long say"); n != tt.werr {
+			t.Fatalf("policy %v: expected %v helps on Werr, got: %q", tt.policy, tt.werr, werr.String())
+		}
+		if strings.Contains(werr.String(), "flag provided but not defined: -x") != tt.usageWerr {
+			t.Fatalf("policy %v: unexpected parse error on Werr: %q", tt.policy, werr.String())
+		}
+		if strings.Contains(werr.String(), "short say") != tt.usageWerr {
+			t.Fatalf("policy %v: unexpected command not found help on Werr: %q", tt.policy, werr.String())
+		}
+	}
+}
+
+func TestHelpOutputKeepsFlagSetOutput(t *testing.T) {
+	var w, own bytes.Buffer
+	fs := flag.NewFlagSet("say", flag.ContinueOnError)
+	fs.SetOutput(&own)
+
+	d := &Dialogue{R: strings.NewReader("say -x\n"), W: &w, HelpOutput: HelpOutputW}
+	d.RegisterCommands(&Command{Name: "say", FlagSet: fs, Exec: func(_ *CallChain, _ []string) error { return nil }})
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if !strings.Contains(w.String(), "flag provided but not defined: -x") || own.Len() != 0 {
+		t.Fatalf("expected the parse error on W, got: %q and %q", w.String(), own.String())
+	}
+	if fs.Output() != &own {
+		t.Fatal("expected the output of the flag set to be left as is")
+	}
+}
+
+func TestDrainOnShutdown(t *testing.T) {
+	for _, drain := range []bool{false, true} {
+		var said []string
+		d := &Dialogue{
+			R:               strings.NewReader("stop\nsay a\nsay b\nsay partial"),
+			W:               nopReadWriter{},
+			DrainOnShutdown: drain,
+		}
+		d.RegisterCommands(
+			&Command{
+				Name: "stop",
+				Exec: func(_ *CallChain, _ []string) error {
+					go d.Shutdown(context.Background())
+					for d.Running() {
+						time.Sleep(time.Millisecond)
+					}
+					return nil
+				},
+			},
+			&Command{
+				Name: "say",
+				Exec: func(_ *CallChain, args []string) error {
+					said = append(said, args...)
+					return nil
+				},
+			},
+		)
+
+		if err := d.Open(); err != ErrShutdown {
+			t.Fatalf("expected %v, got: %v", ErrShutdown, err)
+		}
+
+		// the last line isnt terminated, it could be incomplete.
+		var expected []string
+		if drain {
+			expected = []string{"a", "b"}
+		}
+		if !reflect.DeepEqual(said, expected) {
+			t.Fatalf("drain %v: expected %v, got: %v", drain, expected, said)
+		}
+	}
+}
+
+func TestShuttingDown(t *testing.T) {
+	var before, after bool
+	d := &Dialogue{R: strings.NewReader("long\n"), W: nopReadWriter{}}
+	d.RegisterCommands(&Command{
+		Name: "long",
+		Exec: func(chain *CallChain, _ []string) error {
+			ctx := chain.GetCurrent().Context()
+			before = ShuttingDown(ctx)
+
+			go d.Shutdown(context.Background())
+			for !ShuttingDown(ctx) {
+				time.Sleep(time.Millisecond)
+			}
+			after = true
+
+			// the shutdown waits for the command, its context isnt cancelled.
+			return ctx.Err()
+		},
+	})
+
+	if err := d.Open(); err != ErrShutdown {
+		t.Fatalf("expected %v, got: %v", ErrShutdown, err)
+	}
+
+	if before || !after {
+		t.Fatalf("expected the shutdown to be visible once called, before: %v, after: %v", before, after)
+	}
+
+	if ShuttingDown(context.Background()) {
+		t.Fatal("expected a context without a dialogue not to be shutting down")
+	}
+}
+
+func TestClosePolicyDetach(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	d := &Dialogue{
+		R:            strings.NewReader("hang\n"),
+		W:            nopReadWriter{},
+		ClosePolicy:  CloseDetach,
+		CloseTimeout: 10 * time.Millisecond,
+	}
+	d.RegisterCommands(&Command{
+		Name: "hang",
+		Exec: func(_ *CallChain, _ []string) error {
+			close(started)
+			<-release // ignores the cancelation of its context.
+			return nil
+		},
+	})
+
+	errC := make(chan error, 1)
+	go func() { errC <- d.Open() }()
+
+	<-started
+	d.Close()
+
+	select {
+	case err := <-errC:
+		if err != ErrClosed {
+			t.Fatalf("expected %v, got: %v", ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Open to return once the command is detached")
+	}
+
+	close(release)
+	d.dispatching.Lock() // the detached command releases the dispatching lock once it returns.
+	d.dispatching.Unlock()
+}
+
+func TestClosePolicyCooperative(t *testing.T) {
+	var ctxErr error
+	started := make(chan struct{})
+	d := &Dialogue{R: strings.NewReader("long\n"), W: nopReadWriter{}, ClosePolicy: CloseCooperative}
+	d.RegisterCommands(&Command{
+		Name: "long",
+		Exec: func(chain *CallChain, _ []string) error {
+			ctx := chain.GetCurrent().Context()
+			close(started)
+			for !ShuttingDown(ctx) {
+				time.Sleep(time.Millisecond)
+			}
+
+			ctxErr = ctx.Err()
+			return nil
+		},
+	})
+
+	errC := make(chan error, 1)
+	go func() { errC <- d.Open() }()
+
+	<-started
+	d.Close()
+	if err := <-errC; err != ErrClosed {
+		t.Fatalf("expected %v, got: %v", ErrClosed, err)
+	}
+
+	if ctxErr != nil {
+		t.Fatalf("expected the context of the command not to be cancelled, got: %v", ctxErr)
+	}
+
+	// without a running command the blocked read is cancelled.
+	r, pw := io.Pipe()
+	defer pw.Close()
+	d.R = r
+	d.Reset()
+
+	go func() { errC <- d.Open() }()
+	for !d.Running() {
+		time.Sleep(time.Millisecond)
+	}
+	d.Close()
+	if err := <-errC; err != ErrClosed {
+		t.Fatalf("expected %v, got: %v", ErrClosed, err)
+	}
+}
+
+func TestValidateLine(t *testing.T) {
+	var dispatched, reported []string
+	errReadOnly := errors.New("read only: maintenance in progress")
+	d := &Dialogue{
+		R: strings.NewReader("ls a\nrm a\nls b\n"),
+		W: nopReadWriter{},
+		ValidateLine: func(fields []string) error {
+			if fields[0] == "rm" {
+				return errReadOnly
+			}
+			return nil
+		},
+		OnError: func(_ context.Context, cmd string, err error) {
+			reported = append(reported, cmd+": "+err.Error())
+		},
+	}
+	exec := func(chain *CallChain, args []string) error {
+		dispatched = append(dispatched, chain.GetCurrent().Name+" "+strings.Join(args, " "))
+		return nil
+	}
+	d.RegisterCommands(&Command{Name: "ls", Exec: exec}, &Command{Name: "rm", Exec: exec})
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if !reflect.DeepEqual(dispatched, []string{"ls a", "ls b"}) {
+		t.Fatalf("expected the rejected line not to be dispatched, got: %v", dispatched)
+	}
+
+	if !reflect.DeepEqual(reported, []string{"rm: " + errReadOnly.Error()}) {
+		t.Fatalf("expected the rejected line to be reported, got: %v", reported)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	var out, transcript bytes.Buffer
+	var got, audited string
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	fs.String("token", "", "")
+
+	store := NewMemoryStore()
+	d := &Dialogue{
+		R: strings.NewReader("trace on\nrecord start m\nlogin -token s3cret\nrecord stop\n" +
+			"every 1h login -token s3cret\nschedules\nbad s3cret\n"),
+		W:            &out,
+		Plain:        true,
+		EchoInput:    true,
+		Transcript:   &transcript,
+		TraceCmd:     "trace",
+		RecordCmd:    "record",
+		EveryCmd:     "every",
+		SchedulesCmd: "schedules",
+		Store:        store,
+		Redact: func(line string) string {
+			return strings.ReplaceAll(line, "s3cret", "***")
+		},
+		OnError: func(ctx context.Context, _ string, _ error) {
+			if line, ok := RedactedLineFromContext(ctx); ok {
+				audited = line
+			}
+		},
+	}
+	d.RegisterCommands(
+		&Command{
+			Name:    "login",
+			FlagSet: fs,
+			Exec: func(_ *CallChain, _ []string) error {
+				got = fs.Lookup("token").Value.String()
+				return nil
+			},
+		},
+		&Command{
+			Name:         "bad",
+			ValidateArgs: Range(0, 0),
+			Exec:         func(_ *CallChain, _ []string) error { return nil },
+		},
+	)
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	// the command recieves the line as typed.
+	if got != "s3cret" {
+		t.Fatalf("expected the command to recieve the secret, got: %q", got)
+	}
+
+	if audited != "bad ***" {
+		t.Fatalf("expected the hooks to read the redacted line, got: %q", audited)
+	}
+
+	macro, _, err := store.Get(context.Background(), "macro/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := d.History()
+	for name, recorded := range map[string]string{
+		"output":     out.String(),
+		"transcript": transcript.String(),
+		"history":    history[2].Line,
+		"schedules":  out.String()[strings.LastIndex(out.String(), "> schedules"):],
+	} {
+		if strings.Contains(recorded, "s3cret") || !strings.Contains(recorded, "***") {
+			t.Fatalf("expected the %v to be redacted, got: %q", name, recorded)
+		}
+	}
+
+	if strings.Contains(macro, "s3cret") || !strings.Contains(out.String(), "not recorded into macro m") {
+		t.Fatalf("expected the redacted line not to be recorded, got macro %q and output %q", macro, out.String())
+	}
+}
+
+func TestExecuteInput(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var removed int
+	d := &Dialogue{
+		R:             strings.NewReader("rm\ny\n"),
+		W:             nopReadWriter{},
+		ConfirmPolicy: ConfirmPrompt,
+		ConfigFile:    config,
+		WatchCmd:      "watch",
+	}
+	d.RegisterCommands(&Command{
+		Name:    "rm",
+		Confirm: "remove?",
+		Exec: func(_ *CallChain, _ []string) error {
+			removed++
+			return nil
+		},
+	})
+
+	// Execute doesnt read R, the answer is left to Open.
+	if err := d.Execute(context.Background(), "rm"); !errors.Is(err, ErrNoInput) {
+		t.Fatalf("expected %v, got: %v", ErrNoInput, err)
+	}
+	if err := d.Execute(context.Background(), "watch rm -y"); !errors.Is(err, ErrNoInput) {
+		t.Fatalf("expected %v, got: %v", ErrNoInput, err)
+	}
+
+	// the dialogue is prepared once, the config file isnt read again.
+	if err := os.Remove(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Execute(context.Background(), "rm -y"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(config, []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if removed != 2 {
+		t.Fatalf("expected rm to be executed by Execute with -y and by Open once confirmed, got %d executions", removed)
+	}
+}
+
+func TestClosePolicyCooperativeSchedule(t *testing.T) {
+	r, pw := io.Pipe()
+	defer pw.Close()
+
+	started := make(chan struct{}, 1)
+	d := &Dialogue{R: r, W: nopReadWriter{}, EveryCmd: "every", ClosePolicy: CloseCooperative}
+	d.RegisterCommands(&Command{
+		Name: "slow",
+		Exec: func(_ *CallChain, _ []string) error {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		},
+	})
+
+	errC := make(chan error, 1)
+	go func() { errC <- d.Open() }()
+	io.WriteString(pw, "every 5ms slow\n")
+
+	// the schedule holds the dispatching lock while the loop waits for a line.
+	<-started
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected Close to cancel the read of the loop")
+	}
+
+	if err := <-errC; err != ErrClosed {
+		t.Fatalf("expected %v, got: %v", ErrClosed, err)
+	}
+}
+
+func TestResetFlags(t *testing.T) {
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	verbose := fs.Bool("verbose", false, "")
+	tags := StringSliceFlag(fs, "tag", []string{"default"}, "")
+
+	d := &Dialogue{R: strings.NewReader("set -verbose -tag a -tag b\n"), W: nopReadWriter{}}
+	d.RegisterCommands(&Command{
+		Name:      "set",
+		FlagSet:   fs,
+		FlagReset: FlagResetSticky,
+		Exec:      func(_ *CallChain, _ []string) error { return nil },
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrEOF) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+	if !*verbose || !reflect.DeepEqual(*tags, []string{"a", "b"}) {
+		t.Fatalf("expected the sticky flags to be kept, got: %v %v", *verbose, *tags)
+	}
+
+	if err := d.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if *verbose || !reflect.DeepEqual(*tags, []string{"default"}) {
+		t.Fatalf("expected the flags to be reset, got: %v %v", *verbose, *tags)
+	}
+}
@@ -0,0 +1,131 @@
+package dialogue
+
+import (
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Decoder wraps the reader of the bytes read from R with a reader which converts them to UTF-8, see Dialogue.Encoding.
+// The decoders of golang.org/x/text can be adapted with transform.NewReader:
+//
+//	d.Encoding = func(r io.Reader) io.Reader {
+//		return transform.NewReader(r, charmap.ISO8859_1.NewDecoder())
+//	}
+type Decoder func(r io.Reader) io.Reader
+
+var (
+	// UTF16LE decodes little endian UTF-16, as written by the Windows pipes. A leading byte order mark is dropped.
+	UTF16LE Decoder = func(r io.Reader) io.Reader {
+		return &decodeReader{r: r, decode: decodeUTF16(binary.LittleEndian)}
+	}
+
+	// UTF16BE decodes big endian UTF-16. A leading byte order mark is dropped.
+	UTF16BE Decoder = func(r io.Reader) io.Reader {
+		return &decodeReader{r: r, decode: decodeUTF16(binary.BigEndian)}
+	}
+
+	// Windows1252 decodes the Windows-1252 (CP-1252) code page, a superset of Latin-1 used by some telnet clients.
+	Windows1252 Decoder = func(r io.Reader) io.Reader {
+		return &decodeReader{r: r, decode: decodeWindows1252}
+	}
+)
+
+// decodeFunc appends the UTF-8 encoding of src to dst and returns the number of bytes of src it consumed. The bytes
+// which dont form a complete character are left for the next call unless eof is set, in which case they are decoded as
+// utf8.RuneError.
+type decodeFunc func(dst, src []byte, eof bool) ([]byte, int)
+
+// decodeReader converts the bytes read from r to UTF-8 with decode.
+type decodeReader struct {
+	r      io.Reader
+	decode decodeFunc
+	raw    []byte // raw holds the bytes read from r which arent decoded yet.
+	out    []byte // out holds the decoded bytes which arent read yet.
+	err    error  // sticky error of r.
+}
+
+func (d *decodeReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		var buf [512]byte
+		n, err := d.r.Read(buf[:])
+		d.raw = append(d.raw, buf[:n]...)
+		d.err = err
+
+		var consumed int
+		d.out, consumed = d.decode(d.out, d.raw, err != nil)
+		d.raw = d.raw[:copy(d.raw, d.raw[consumed:])]
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[:copy(d.out, d.out[n:])]
+	return n, nil
+}
+
+func decodeUTF16(order binary.ByteOrder) decodeFunc {
+	start := true
+	return func(dst, src []byte, eof bool) ([]byte, int) {
+		i := 0
+		for len(src)-i >= 2 {
+			r, size := rune(order.Uint16(src[i:])), 2
+			if utf16.IsSurrogate(r) {
+				switch {
+				case len(src)-i >= 4:
+					// an unpaired surrogate is decoded alone, the next unit is decoded on its own.
+					if pair := utf16.DecodeRune(r, rune(order.Uint16(src[i+2:]))); pair != utf8.RuneError {
+						r, size = pair, 4
+					} else {
+						r = utf8.RuneError
+					}
+				case eof:
+					r, size = utf8.RuneError, len(src)-i
+				default:
+					return dst, i
+				}
+			}
+			i += size
+
+			if start && r == '\uFEFF' {
+				start = false
+				continue
+			}
+			start = false
+
+			dst = utf8.AppendRune(dst, r)
+		}
+
+		if eof && i < len(src) {
+			dst = utf8.AppendRune(dst, utf8.RuneError)
+			i = len(src)
+		}
+
+		return dst, i
+	}
+}
+
+// windows1252 maps the bytes 0x80 to 0x9f of Windows-1252, the other bytes map to the same code points as Latin-1. The
+// unassigned bytes map to the C1 control characters.
+var windows1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+func decodeWindows1252(dst, src []byte, _ bool) ([]byte, int) {
+	for _, b := range src {
+		r := rune(b)
+		if b >= 0x80 && b < 0xa0 {
+			r = windows1252[b-0x80]
+		}
+
+		dst = utf8.AppendRune(dst, r)
+	}
+
+	return dst, len(src)
+}
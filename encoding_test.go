@@ -0,0 +1,74 @@
+package dialogue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+func encodeUTF16(s string, order binary.ByteOrder) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		order.PutUint16(b[2*i:], u)
+	}
+
+	return b
+}
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		name     string
+		decoder  Decoder
+		in       []byte
+		expected string
+	}{
+		{"utf16le", UTF16LE, encodeUTF16("\uFEFFsay héllo 😀\n", binary.LittleEndian), "say héllo 😀\n"},
+		{"utf16be", UTF16BE, encodeUTF16("say héllo 😀\n", binary.BigEndian), "say héllo 😀\n"},
+		{"utf16 truncated", UTF16LE, append(encodeUTF16("a", binary.LittleEndian), 'b'), "a\uFFFD"},
+		{"utf16 unpaired", UTF16LE, []byte{0x00, 0xd8, 'a', 0x00}, "\uFFFDa"},
+		{"windows1252", Windows1252, []byte("caf\xe9 \x80\x96\n"), "café €–\n"},
+	}
+
+	for _, tt := range tests {
+		// read a byte at a time to split the characters across reads.
+		out, err := io.ReadAll(tt.decoder(iotest.OneByteReader(bytes.NewReader(tt.in))))
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+
+		if string(out) != tt.expected {
+			t.Fatalf("%v: expected %q, got: %q", tt.name, tt.expected, out)
+		}
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	var w bytes.Buffer
+	d := &Dialogue{
+		R:        bytes.NewReader(encodeUTF16("say héllo\n", binary.LittleEndian)),
+		W:        &w,
+		Encoding: UTF16LE,
+	}
+	d.RegisterCommands(&Command{
+		Name: "say",
+		Exec: func(chain *CallChain, args []string) error {
+			out, _ := OutFromContext(chain.GetCurrent().Context())
+			_, err := fmt.Fprintln(out, strings.Join(args, " "))
+			return err
+		},
+	})
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	if w.String() != "héllo\n" {
+		t.Fatalf("expected the decoded args, got: %q", w.String())
+	}
+}
@@ -0,0 +1,31 @@
+package dialogue
+
+import "context"
+
+// Evaluator evaluates the lines which dont match any command, implement it for calculators and query languages mixing free
+// form expressions with commands. Eval returns the result written to the user, an error is reported to the user without
+// closing the dialogue.
+type Evaluator interface {
+	Eval(ctx context.Context, line string) (string, error)
+}
+
+// EvaluatorFunc adapts a function to the Evaluator interface.
+type EvaluatorFunc func(ctx context.Context, line string) (string, error)
+
+func (f EvaluatorFunc) Eval(ctx context.Context, line string) (string, error) {
+	return f(ctx, line)
+}
+
+// evaluate evaluates line with the evaluator of the dialogue and renders the result.
+func (d *Dialogue) evaluate(ctx context.Context, line string, fields []string) error {
+	res, err := d.Evaluator.Eval(ctx, line)
+	if err != nil {
+		return d.reportError(ctx, fields[0], err)
+	}
+
+	if res == "" {
+		return nil
+	}
+
+	return d.renderer.PrintLine(res)
+}
@@ -0,0 +1,52 @@
+package dialogue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEvaluator(t *testing.T) {
+	var buf bytes.Buffer
+	sum := EvaluatorFunc(func(_ context.Context, line string) (string, error) {
+		var total int
+		for _, term := range strings.Split(line, "+") {
+			n, err := strconv.Atoi(strings.TrimSpace(term))
+			if err != nil {
+				return "", errors.New("invalid expression")
+			}
+			total += n
+		}
+
+		return strconv.Itoa(total), nil
+	})
+
+	d := &Dialogue{
+		W:         &buf,
+		Evaluator: sum,
+		CommandNotFound: func(_ context.Context, _ []string) error {
+			t.Fatal("expected the evaluator to take precedence")
+			return nil
+		},
+	}
+	d.RegisterCommands(&Command{
+		Name: "clear",
+		Exec: func(_ *CallChain, _ []string) error {
+			buf.WriteString("cleared\n")
+			return nil
+		},
+	})
+
+	for _, line := range []string{"1 + 2", "clear", "1 + x"} {
+		if err := d.Execute(context.Background(), line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if out := buf.String(); out != "3\ncleared\ninvalid expression\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
@@ -0,0 +1,164 @@
+package dialogue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrFanOut aggregates the errors of the commands executed by CallChain.FanOut, every error is prefixed with the name of
+// the command which returned it.
+type ErrFanOut struct {
+	Errs []error
+}
+
+func (e ErrFanOut) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the aggregated errors.
+func (e ErrFanOut) Unwrap() []error {
+	return e.Errs
+}
+
+// FanOut executes cmds concurrently with args as if each was invoked as a sub command of the current invocation, for
+// example "check all" running every registered check. It waits for all of them and returns an ErrFanOut if any failed.
+//
+// The output each command writes to OutFromContext is labeled with its name line by line ("[disk] ok") so the interleaved
+// output stays readable. The call chains of the fanned out commands start at the command, they cant advance to the
+// current invocation.
+func (c *CallChain) FanOut(ctx context.Context, args []string, cmds ...*Command) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	out, ok := OutFromContext(ctx)
+	if !ok {
+		out = io.Discard
+	}
+
+	var mu sync.Mutex // serializes the labeled lines.
+	var wg sync.WaitGroup
+	errs := make([]error, len(cmds))
+	for i, cmd := range cmds {
+		wg.Add(1)
+		go func(i int, cmd *Command) {
+			defer wg.Done()
+
+			w := &labelWriter{mu: &mu, w: out, label: "[" + cmd.Name + "] "}
+			err := fanOutExec(context.WithValue(ctx, outKey{}, w), cmd, args)
+			if ferr := w.flush(); err == nil {
+				err = ferr
+			}
+
+			if err != nil {
+				errs[i] = fmt.Errorf("%v: %w", cmd.Name, err)
+			}
+		}(i, cmd)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return ErrFanOut{failed}
+	}
+
+	return nil
+}
+
+// fanOutExec resolves and executes the call chain of cmd with args.
+func fanOutExec(ctx context.Context, cmd *Command, args []string) error {
+	// the args are shared by the commands and Exec can modify them in place.
+	chain, err := cmd.parse(append([]string(nil), args...))
+	if err != nil {
+		return err
+	}
+	defer chain.clean()
+
+	if err := chain.validate(); err != nil {
+		return err
+	}
+
+	return chain.AdvanceExec(0, ctx)
+}
+
+// FanOutAll returns a sub command named name which executes every other sub command of its parent with FanOut, add it to
+// the sub commands of the parent:
+//
+//	check.SubCommands = append(check.SubCommands, dialogue.FanOutAll("all"))
+func FanOutAll(name string) *Command {
+	return &Command{
+		Name:      name,
+		Structure: name + " [args]",
+		HelpShort: "executes every sub command concurrently",
+		Exec: func(chain *CallChain, args []string) error {
+			if len(*chain) < 2 {
+				return errors.New("dialogue: fan out: no parent command")
+			}
+
+			var cmds []*Command
+			for _, subCmd := range (*chain)[1].SubCommands {
+				if subCmd.Name != name {
+					cmds = append(cmds, subCmd)
+				}
+			}
+
+			return chain.FanOut(chain.GetCurrent().Context(), args, cmds...)
+		},
+	}
+}
+
+// labelWriter prefixes every line written to w with label, the lines of the writers sharing mu dont interleave.
+type labelWriter struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	label string
+	buf   []byte
+}
+
+func (l *labelWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+
+		if err := l.writeLine(l.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		l.buf = l.buf[i+1:]
+	}
+}
+
+// flush writes the last line if it wasnt terminated.
+func (l *labelWriter) flush() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+
+	return l.writeLine(append(l.buf, '\n'))
+}
+
+func (l *labelWriter) writeLine(line []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := l.w.Write(append([]byte(l.label), line...))
+	return err
+}
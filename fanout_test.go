@@ -0,0 +1,49 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFanOut(t *testing.T) {
+	check := func(name string, err error) *Command {
+		return &Command{
+			Name: name,
+			Exec: func(chain *CallChain, args []string) error {
+				w, _ := OutFromContext(chain.GetCurrent().Context())
+				fmt.Fprintf(w, "checking %v\n", strings.Join(args, " "))
+				fmt.Fprint(w, "done")
+				return err
+			},
+		}
+	}
+
+	failure := errors.New("full")
+	w := &syncBuffer{}
+	d := &Dialogue{W: w}
+	d.RegisterCommands(&Command{
+		Name:        "check",
+		Exec:        func(_ *CallChain, _ []string) error { return nil },
+		SubCommands: []*Command{check("disk", failure), check("net", nil), FanOutAll("all")},
+	})
+
+	var fanErr ErrFanOut
+	if err := d.Execute(context.Background(), "check all now"); !errors.As(err, &fanErr) {
+		t.Fatalf("expected a fan out error, got: %v", err)
+	}
+
+	if len(fanErr.Errs) != 1 || !errors.Is(fanErr.Errs[0], failure) || fanErr.Error() != "disk: full" {
+		t.Fatalf("unexpected errors: %v", fanErr.Errs)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n")
+	sort.Strings(lines)
+	expected := []string{"[disk] checking now", "[disk] done", "[net] checking now", "[net] done"}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Fatalf("unexpected output: %q", lines)
+	}
+}
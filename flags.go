@@ -0,0 +1,402 @@
+package dialogue
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnumValue is a flag.Value which only accepts one of a fixed set of choices.
+type EnumValue struct {
+	value   string
+	choices []string
+}
+
+// EnumFlag defines a flag with the specified name, default value and usage string on fs which only accepts one of the values
+// in choices. The allowed values are documented automatically by the default help formatter.
+//
+// EnumFlag panics if the default value isnt one of the choices.
+func EnumFlag(fs *flag.FlagSet, name string, choices []string, value string, usage string) *EnumValue {
+	e := &EnumValue{choices: choices}
+	if err := e.Set(value); err != nil {
+		panic(err)
+	}
+
+	fs.Var(e, name, usage)
+	return e
+}
+
+// String returns the current value.
+func (e *EnumValue) String() string {
+	if e == nil {
+		return ""
+	}
+
+	return e.value
+}
+
+// Set sets the value if it is one of the allowed choices.
+func (e *EnumValue) Set(s string) error {
+	for _, c := range e.choices {
+		if s == c {
+			e.value = s
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%q isnt one of: %v", s, strings.Join(e.choices, ", "))
+}
+
+// Get returns the current value, it implements flag.Getter.
+func (e *EnumValue) Get() any {
+	return e.value
+}
+
+// Choices returns the allowed values of the flag.
+func (e *EnumValue) Choices() []string {
+	return e.choices
+}
+
+// choicer is implemented by flag values which only accept a fixed set of values.
+type choicer interface {
+	Choices() []string
+}
+
+type durationValue time.Duration
+
+// DurationFlag defines a time.Duration flag with the specified name, default value and usage string on fs. Unlike
+// flag.Duration it reports friendly errors describing the expected format.
+func DurationFlag(fs *flag.FlagSet, name string, value time.Duration, usage string) *time.Duration {
+	p := new(time.Duration)
+	*p = value
+	fs.Var((*durationValue)(p), name, usage)
+	return p
+}
+
+func (d *durationValue) String() string {
+	return (*time.Duration)(d).String()
+}
+
+func (d *durationValue) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected a number followed by a unit such as 300ms, 1.5h or 2h45m", s)
+	}
+
+	*d = durationValue(v)
+	return nil
+}
+
+func (d *durationValue) Get() any {
+	return time.Duration(*d)
+}
+
+// byteUnits maps the accepted byte size suffixes (lower cased) to their multiplier.
+var byteUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"tib": 1 << 40,
+}
+
+type byteSizeValue int64
+
+// ByteSizeFlag defines a byte size flag with the specified name, default value (in bytes) and usage string on fs. The flag
+// accepts human readable sizes such as 512, 10KB (decimal units) or 1.5MiB (binary units).
+func ByteSizeFlag(fs *flag.FlagSet, name string, value int64, usage string) *int64 {
+	p := new(int64)
+	*p = value
+	fs.Var((*byteSizeValue)(p), name, usage)
+	return p
+}
+
+func (b *byteSizeValue) String() string {
+	if b == nil {
+		return "0"
+	}
+
+	n := int64(*b)
+	for _, u := range []string{"TiB", "GiB", "MiB", "KiB"} {
+		if m := byteUnits[strings.ToLower(u)]; n != 0 && n%m == 0 {
+			return strconv.FormatInt(n/m, 10) + u
+		}
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+func (b *byteSizeValue) Set(s string) error {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+
+	num, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	m, ok := byteUnits[unit]
+	if !ok {
+		return fmt.Errorf("invalid byte size %q, unknown unit %q (use B, KB, MB, GB, TB or KiB, MiB, GiB, TiB)", s, s[i:])
+	}
+
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return fmt.Errorf("invalid byte size %q, expected a number followed by an optional unit such as 10MiB", s)
+	}
+
+	// float64(math.MaxInt64) rounds up to 1<<63 which doesnt fit in an int64.
+	size := v * float64(m)
+	if math.IsNaN(size) || size < 0 || size >= math.MaxInt64 {
+		return fmt.Errorf("invalid byte size %q, value out of range", s)
+	}
+
+	*b = byteSizeValue(size)
+	return nil
+}
+
+func (b *byteSizeValue) Get() any {
+	return int64(*b)
+}
+
+type timestampValue time.Time
+
+// TimestampFlag defines a time.Time flag with the specified name, default value and usage string on fs. The flag accepts
+// RFC3339 timestamps, "now" or durations relative to the time of parsing such as -1h or +30m.
+func TimestampFlag(fs *flag.FlagSet, name string, value time.Time, usage string) *time.Time {
+	p := new(time.Time)
+	*p = value
+	fs.Var((*timestampValue)(p), name, usage)
+	return p
+}
+
+func (t *timestampValue) String() string {
+	if t == nil || time.Time(*t).IsZero() {
+		return ""
+	}
+
+	return time.Time(*t).Format(time.RFC3339)
+}
+
+func (t *timestampValue) Set(s string) error {
+	switch {
+	case s == "":
+		*t = timestampValue(time.Time{})
+		return nil
+	case s == "now":
+		*t = timestampValue(time.Now())
+		return nil
+	case s[0] == '-' || s[0] == '+':
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid relative timestamp %q, expected a signed duration such as -1h or +30m", s)
+		}
+
+		*t = timestampValue(time.Now().Add(d))
+		return nil
+	}
+
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q, expected an RFC3339 timestamp such as 2006-01-02T15:04:05Z07:00 or a relative time such as -1h", s)
+	}
+
+	*t = timestampValue(v)
+	return nil
+}
+
+func (t *timestampValue) Get() any {
+	return time.Time(*t)
+}
+
+// resetter is implemented by flag values which cant be restored by calling Set(DefValue), such as accumulating values. Reset
+// restores the value to its default.
+type resetter interface {
+	Reset()
+}
+
+type stringSliceValue struct {
+	p       *[]string
+	def     []string
+	changed bool
+}
+
+// StringSliceFlag defines a repeatable string flag with the specified name, default value and usage string on fs. Each
+// occurrence of the flag (-tag a -tag b) appends to the returned slice, the default value is replaced by the first occurrence.
+func StringSliceFlag(fs *flag.FlagSet, name string, value []string, usage string) *[]string {
+	v := &stringSliceValue{p: new([]string), def: value}
+	v.Reset()
+	fs.Var(v, name, usage)
+	return v.p
+}
+
+func (s *stringSliceValue) String() string {
+	if s == nil || s.p == nil {
+		return ""
+	}
+
+	return strings.Join(*s.p, ",")
+}
+
+func (s *stringSliceValue) Set(v string) error {
+	if !s.changed {
+		*s.p = nil
+		s.changed = true
+	}
+
+	*s.p = append(*s.p, v)
+	return nil
+}
+
+// Get returns a copy of the slice so the values of an invocation arent changed by the next one, see Invocation.Flag.
+func (s *stringSliceValue) Get() any {
+	return append([]string(nil), *s.p...)
+}
+
+func (s *stringSliceValue) Reset() {
+	*s.p = append([]string(nil), s.def...)
+	s.changed = false
+}
+
+type intSliceValue struct {
+	p       *[]int
+	def     []int
+	changed bool
+}
+
+// IntSliceFlag defines a repeatable int flag with the specified name, default value and usage string on fs. Each occurrence
+// of the flag (-id 1 -id 2) appends to the returned slice, the default value is replaced by the first occurrence.
+func IntSliceFlag(fs *flag.FlagSet, name string, value []int, usage string) *[]int {
+	v := &intSliceValue{p: new([]int), def: value}
+	v.Reset()
+	fs.Var(v, name, usage)
+	return v.p
+}
+
+func (s *intSliceValue) String() string {
+	if s == nil || s.p == nil {
+		return ""
+	}
+
+	out := make([]string, len(*s.p))
+	for i, n := range *s.p {
+		out[i] = strconv.Itoa(n)
+	}
+
+	return strings.Join(out, ",")
+}
+
+func (s *intSliceValue) Set(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", v)
+	}
+
+	if !s.changed {
+		*s.p = nil
+		s.changed = true
+	}
+
+	*s.p = append(*s.p, n)
+	return nil
+}
+
+func (s *intSliceValue) Get() any {
+	return append([]int(nil), *s.p...)
+}
+
+func (s *intSliceValue) Reset() {
+	*s.p = append([]int(nil), s.def...)
+	s.changed = false
+}
+
+// syntaxer is implemented by flag values which want to document the syntax of their value in the help output instead of
+// their default value.
+type syntaxer interface {
+	Syntax() string
+}
+
+type mapValue struct {
+	p       *map[string]string
+	def     map[string]string
+	changed bool
+}
+
+// MapFlag defines a repeatable key=value flag with the specified name, default value and usage string on fs. Each occurrence
+// of the flag (-label env=prod -label team=core) adds an entry to the returned map, the default value is replaced by the
+// first occurrence.
+func MapFlag(fs *flag.FlagSet, name string, value map[string]string, usage string) *map[string]string {
+	v := &mapValue{p: new(map[string]string), def: value}
+	v.Reset()
+	fs.Var(v, name, usage)
+	return v.p
+}
+
+func (m *mapValue) String() string {
+	if m == nil || m.p == nil {
+		return ""
+	}
+
+	keys := make([]string, 0, len(*m.p))
+	for k := range *m.p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + (*m.p)[k]
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (m *mapValue) Set(v string) error {
+	k, val, ok := strings.Cut(v, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("invalid entry %q, expected key=value", v)
+	}
+
+	if !m.changed {
+		*m.p = make(map[string]string)
+		m.changed = true
+	}
+
+	(*m.p)[k] = val
+	return nil
+}
+
+func (m *mapValue) Get() any {
+	out := make(map[string]string, len(*m.p))
+	for k, v := range *m.p {
+		out[k] = v
+	}
+
+	return out
+}
+
+func (m *mapValue) Reset() {
+	*m.p = make(map[string]string, len(m.def))
+	for k, v := range m.def {
+		(*m.p)[k] = v
+	}
+	m.changed = false
+}
+
+func (m *mapValue) Syntax() string {
+	return "key=value"
+}
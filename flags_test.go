@@ -0,0 +1,189 @@
+package dialogue
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnumFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(nopReadWriter{})
+	format := EnumFlag(fs, "format", []string{"json", "table", "yaml"}, "table", "output format")
+
+	if err := fs.Parse([]string{"-format", "json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if format.String() != "json" {
+		t.Fatalf("expected json but got %v", format)
+	}
+
+	if err := fs.Parse([]string{"-format", "xml"}); err == nil {
+		t.Fatal("expected error for value outside of choices")
+	}
+
+	cmd := &Command{Name: "test", FlagSet: fs}
+	if help := defaultCommandHelpFormater(cmd, true); !strings.Contains(help, "one of: json, table, yaml") {
+		t.Fatalf("expected help to document the choices but got: %q", help)
+	}
+}
+
+func TestByteSizeFlag(t *testing.T) {
+	type testCase struct {
+		in       string
+		expected int64
+		ok       bool
+	}
+
+	testCases := []testCase{
+		{"512", 512, true},
+		{"10KB", 10000, true},
+		{"10MiB", 10 << 20, true},
+		{"1.5kib", 1536, true},
+		{"10XB", 0, false},
+		{"MiB", 0, false},
+		{"8388607TiB", 8388607 << 40, true},
+		{"8388608TiB", 0, false}, // 1<<63 bytes overflows int64.
+	}
+
+	for _, tc := range testCases {
+		var v byteSizeValue
+		err := v.Set(tc.in)
+		if tc.ok != (err == nil) {
+			t.Fatalf("unexpected result for %q: %v", tc.in, err)
+		}
+
+		if tc.ok && int64(v) != tc.expected {
+			t.Fatalf("expected %q to parse to %d but got %d", tc.in, tc.expected, v)
+		}
+	}
+
+	v := byteSizeValue(10 << 20)
+	if v.String() != "10MiB" {
+		t.Fatalf("expected 10MiB but got %v", v.String())
+	}
+}
+
+func TestTimestampFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(nopReadWriter{})
+	since := TimestampFlag(fs, "since", time.Time{}, "start time")
+
+	if err := fs.Parse([]string{"-since", "-1h"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := time.Since(*since); d < 59*time.Minute || d > 61*time.Minute {
+		t.Fatalf("expected relative timestamp to be an hour ago but got %v", *since)
+	}
+
+	if err := fs.Parse([]string{"-since", "2023-01-02T15:04:05Z"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if since.Year() != 2023 {
+		t.Fatalf("unexpected timestamp: %v", *since)
+	}
+
+	if err := fs.Parse([]string{"-since", "yesterday"}); err == nil {
+		t.Fatal("expected error for invalid timestamp")
+	}
+}
+
+func TestSliceFlagClean(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	tags := StringSliceFlag(fs, "tag", []string{"default"}, "tags")
+	ids := IntSliceFlag(fs, "id", nil, "ids")
+
+	cmd := &Command{Name: "test", FlagSet: fs}
+	for i := 0; i < 2; i++ {
+		cc, err := cmd.parse([]string{"-tag", "a", "-tag", "b", "-id", "1", "-id", "2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(*tags, []string{"a", "b"}) || !reflect.DeepEqual(*ids, []int{1, 2}) {
+			t.Fatalf("unexpected values after parse: %v %v", *tags, *ids)
+		}
+
+		cc.clean()
+
+		if !reflect.DeepEqual(*tags, []string{"default"}) || len(*ids) != 0 {
+			t.Fatalf("expected clean to reset the values but got: %v %v", *tags, *ids)
+		}
+	}
+}
+
+func TestMapFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(nopReadWriter{})
+	labels := MapFlag(fs, "label", nil, "labels to attach")
+
+	cmd := &Command{Name: "test", FlagSet: fs}
+	cc, err := cmd.parse([]string{"-label", "env=prod", "-label", "team=core"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(*labels, map[string]string{"env": "prod", "team": "core"}) {
+		t.Fatalf("unexpected labels: %v", *labels)
+	}
+
+	cc.clean()
+	if len(*labels) != 0 {
+		t.Fatalf("expected clean to empty the labels but got: %v", *labels)
+	}
+
+	if err := fs.Parse([]string{"-label", "novalue"}); err == nil {
+		t.Fatal("expected error for entry without =")
+	}
+
+	if help := defaultCommandHelpFormater(cmd, true); !strings.Contains(help, "-label key=value") {
+		t.Fatalf("expected help to show the key=value syntax but got: %q", help)
+	}
+}
+
+func TestAccumulatingFlagDefaults(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{"tag": {"labels": ["a", "b"], "id": 12345678901234567890}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+	labels := StringSliceFlag(fs, "labels", nil, "")
+	id := fs.String("id", "", "")
+
+	var got []string
+	d := &Dialogue{W: nopReadWriter{}, ConfigFile: config}
+	d.RegisterCommands(&Command{
+		Name:      "tag",
+		FlagSet:   fs,
+		EnvPrefix: "TAG_",
+		Exec: func(_ *CallChain, _ []string) error {
+			got = append(got, fmt.Sprintf("%v %v", *labels, *id))
+			return nil
+		},
+	})
+
+	if err := d.Execute(context.Background(), "tag"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Execute(context.Background(), "tag -labels c"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TAG_LABELS", "env")
+	if err := d.Execute(context.Background(), "tag"); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"[a b] 12345678901234567890", "[c] 12345678901234567890", "[env] 12345678901234567890"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v but got %v", expected, got)
+	}
+}
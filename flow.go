@@ -0,0 +1,219 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// StallPolicy controls what happens to the output when W cant keep up with it, see Dialogue.WriteTimeout and
+// Dialogue.WriteBuffer. The stalls are reported to OnError as ErrWriteStalled whatever the policy.
+type StallPolicy int
+
+const (
+	// StallBlock waits for W: the writes wait for room in the write buffer and a write which times out fails, which
+	// usually ends the session. This is the default.
+	StallBlock StallPolicy = iota
+
+	// StallDrop drops the output which doesnt fit in the write buffer or times out, the session goes on.
+	StallDrop
+
+	// StallDisconnect closes the dialogue and W if it is an io.Closer, such as a net.Conn, so one slow client cant hang a
+	// session server.
+	StallDisconnect
+)
+
+// ErrWriteStalled is reported to OnError when W doesnt keep up with the output.
+type ErrWriteStalled struct {
+	Dropped int   // Dropped is the number of bytes of output which were dropped.
+	Err     error // Err is the error of the write which timed out, nil if the write buffer was full.
+}
+
+func (e ErrWriteStalled) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("dialogue: write stalled, dropped %d bytes: %v", e.Dropped, e.Err)
+	}
+
+	return fmt.Sprintf("dialogue: write stalled, dropped %d bytes: write buffer full", e.Dropped)
+}
+
+func (e ErrWriteStalled) Unwrap() error {
+	return e.Err
+}
+
+// writeDeadliner is implemented by the writers which support write deadlines, such as net.Conn.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// flowWriter applies the write deadline and the write buffer of the dialogue to w. The buffered output is written by a
+// go routine which is started by the first write to the empty buffer and returns once the buffer is drained.
+type flowWriter struct {
+	w       io.Writer
+	timeout time.Duration
+	limit   int
+	policy  StallPolicy
+	stall   func(ErrWriteStalled) // stall reports the stalls and applies StallDisconnect.
+
+	mu       sync.Mutex
+	cond     *sync.Cond // cond signals the changes to buf and draining.
+	buf      []byte
+	draining bool
+	err      error // sticky error of w.
+}
+
+// writerLocked returns the writer of the output capture: W wrapped with a flowWriter, if it needs one, and a syncWriter.
+func (d *Dialogue) writerLocked() io.Writer {
+	d.flow = nil
+
+	w, raw := d.W, d.W
+	if _, deadlines := raw.(writeDeadliner); d.WriteBuffer > 0 || (d.WriteTimeout > 0 && deadlines) {
+		d.flow = &flowWriter{
+			w:       raw,
+			timeout: d.WriteTimeout,
+			limit:   d.WriteBuffer,
+			policy:  d.StallPolicy,
+			stall:   func(err ErrWriteStalled) { d.writeStalled(raw, err) },
+		}
+		d.flow.cond = sync.NewCond(&d.flow.mu)
+
+		w = d.flow
+	}
+
+	interval := d.RedrawInterval
+	if interval <= 0 {
+		interval = defaultRedrawInterval
+	}
+
+	return &syncWriter{w: w, interval: interval}
+}
+
+// flushOutput waits for the output buffered by WriteBuffer to be written.
+func (d *Dialogue) flushOutput() {
+	d.mu.Lock()
+	f := d.flow
+	d.mu.Unlock()
+
+	if f != nil {
+		f.flush()
+	}
+}
+
+// writeStalled reports the stall of w to OnError and disconnects according to StallPolicy.
+func (d *Dialogue) writeStalled(w io.Writer, err ErrWriteStalled) {
+	if d.OnError != nil {
+		d.OnError(context.Background(), "", err)
+	}
+
+	if d.StallPolicy == StallDisconnect {
+		if c, ok := w.(io.Closer); ok {
+			c.Close() // unblock the stalled writes.
+		}
+		go d.Close()
+	}
+}
+
+func (f *flowWriter) Write(p []byte) (int, error) {
+	if f.limit <= 0 {
+		return f.write(p)
+	}
+
+	f.mu.Lock()
+	if f.err != nil {
+		f.mu.Unlock()
+		return 0, f.err
+	}
+
+	// a write larger than the buffer is accepted once the buffer is empty.
+	for len(f.buf) > 0 && len(f.buf)+len(p) > f.limit {
+		if f.policy != StallBlock {
+			f.mu.Unlock()
+			f.stall(ErrWriteStalled{Dropped: len(p)})
+			if f.policy == StallDisconnect {
+				return 0, ErrWriteStalled{Dropped: len(p)}
+			}
+
+			return len(p), nil
+		}
+
+		f.cond.Wait()
+		if f.err != nil {
+			f.mu.Unlock()
+			return 0, f.err
+		}
+	}
+
+	f.buf = append(f.buf, p...)
+	if !f.draining {
+		f.draining = true
+		go f.drain()
+	}
+	f.mu.Unlock()
+
+	return len(p), nil
+}
+
+// drain writes the buffer to w until it is empty.
+func (f *flowWriter) drain() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.buf) > 0 && f.err == nil {
+		chunk := f.buf
+		f.buf = nil
+		f.cond.Broadcast()
+
+		f.mu.Unlock()
+		_, err := f.write(chunk)
+		f.mu.Lock()
+
+		if err != nil {
+			f.err = err
+		}
+	}
+
+	f.draining = false
+	f.cond.Broadcast()
+}
+
+// write writes p to w within the write deadline. The writes which time out are reported, they are dropped unless the
+// policy is StallBlock.
+func (f *flowWriter) write(p []byte) (int, error) {
+	d, ok := f.w.(writeDeadliner)
+	if !ok || f.timeout <= 0 {
+		return f.w.Write(p)
+	}
+
+	if err := d.SetWriteDeadline(time.Now().Add(f.timeout)); err != nil {
+		return 0, err
+	}
+
+	n, err := f.w.Write(p)
+	if err == nil || !isTimeout(err) {
+		return n, err
+	}
+
+	f.stall(ErrWriteStalled{Dropped: len(p) - n, Err: err})
+	if f.policy == StallDrop {
+		return len(p), nil
+	}
+
+	return n, err
+}
+
+// flush waits for the buffered output to be written.
+func (f *flowWriter) flush() {
+	f.mu.Lock()
+	for f.draining {
+		f.cond.Wait()
+	}
+	f.mu.Unlock()
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
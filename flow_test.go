@@ -0,0 +1,116 @@
+package dialogue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gateWriter blocks the writes until open is closed.
+type gateWriter struct {
+	open chan struct{}
+	buf  bytes.Buffer
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	<-w.open
+	return w.buf.Write(p)
+}
+
+func TestWriteBuffer(t *testing.T) {
+	w := &gateWriter{open: make(chan struct{})}
+	var stalls []error
+	d := &Dialogue{
+		W:           w,
+		WriteBuffer: 8,
+		StallPolicy: StallDrop,
+		OnError:     func(_ context.Context, _ string, err error) { stalls = append(stalls, err) },
+	}
+
+	d.mu.Lock()
+	out := d.writerLocked()
+	d.mu.Unlock()
+
+	fmt.Fprint(out, "12345\n")
+
+	// the drain go routine may have taken the first write out of the buffer, fill it up.
+	for i := 0; len(stalls) == 0; i++ {
+		if i == 3 {
+			t.Fatal("expected the full buffer to drop the output")
+		}
+		fmt.Fprint(out, "abcdef\n")
+	}
+	close(w.open)
+	d.flushOutput()
+
+	var stall ErrWriteStalled
+	if !errors.As(stalls[0], &stall) || stall.Dropped != 7 {
+		t.Fatalf("expected a stall dropping 7 bytes, got: %v", stalls[0])
+	}
+	if !strings.HasPrefix(w.buf.String(), "12345\n") || strings.Count(w.buf.String(), "\n") > 2 {
+		t.Fatalf("expected the buffered output only, got: %q", w.buf.String())
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	tests := []struct {
+		policy   StallPolicy
+		expected func(err error) bool
+	}{
+		{StallDrop, func(err error) bool { return err == ErrEOF }},
+		{StallBlock, func(err error) bool { return errors.Is(err, os.ErrDeadlineExceeded) }},
+		{StallDisconnect, func(err error) bool { return err != nil }},
+	}
+
+	for _, tt := range tests {
+		// nothing reads the other end of the pipe.
+		conn, peer := net.Pipe()
+		defer peer.Close()
+
+		var mu sync.Mutex
+		var stalled bool
+		d := &Dialogue{
+			R:            strings.NewReader("say hi\nsay there\n"),
+			W:            conn,
+			WriteTimeout: 10 * time.Millisecond,
+			StallPolicy:  tt.policy,
+			OnError: func(_ context.Context, _ string, err error) {
+				mu.Lock()
+				stalled = stalled || errors.As(err, &ErrWriteStalled{})
+				mu.Unlock()
+			},
+		}
+		d.RegisterCommands(&Command{
+			Name: "say",
+			Exec: func(chain *CallChain, args []string) error {
+				out, _ := OutFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprintln(out, args)
+				return err
+			},
+		})
+
+		if err := d.Open(); !tt.expected(err) {
+			t.Fatalf("policy %v: unexpected err: %v", tt.policy, err)
+		}
+
+		mu.Lock()
+		if !stalled {
+			t.Fatalf("policy %v: expected the stall to be reported", tt.policy)
+		}
+		mu.Unlock()
+
+		if tt.policy == StallDisconnect {
+			if _, err := conn.Write([]byte("x")); err != io.ErrClosedPipe {
+				t.Fatalf("expected the connection to be closed, got: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package dialogue
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Highlight styles line with the theme of the dialogue for input frontends which redraw the line as it is typed: the known
+// command and sub command names are styled as commands, unknown or disabled command names as errors, flags as flags and
+// quoted strings as quoted. The command name is resolved in the current namespace. The whitespace of line is preserved.
+//
+// The theme is resolved when the dialogue is opened, Highlight returns line unstyled before that.
+func (d *Dialogue) Highlight(line string) string {
+	d.mu.Lock()
+	commands, t := d.enabledCommands(context.Background()), d.theme
+	d.mu.Unlock()
+
+	var b strings.Builder
+	var cmd *Command
+	first := true
+
+	for len(line) > 0 {
+		r, size := utf8.DecodeRuneInString(line)
+		if unicode.IsSpace(r) {
+			b.WriteString(line[:size])
+			line = line[size:]
+			continue
+		}
+
+		tok := nextToken(line)
+		line = line[len(tok):]
+
+		switch {
+		case r == '"' || r == '\'':
+			b.WriteString(t.style(t.Quoted, tok))
+		case first:
+			name := tok
+			if resolved, ok := d.namespace.resolve(tok, commands); ok {
+				name = resolved
+			}
+
+			if cmd = commands[name]; cmd != nil {
+				b.WriteString(t.style(t.Command, tok))
+			} else {
+				b.WriteString(t.style(t.Error, tok))
+			}
+		case strings.HasPrefix(tok, "-"):
+			b.WriteString(t.style(t.Flag, tok))
+		case cmd != nil && cmd.subCommand(tok) != nil:
+			cmd = cmd.subCommand(tok)
+			b.WriteString(t.style(t.Command, tok))
+		default:
+			b.WriteString(tok)
+		}
+		first = false
+	}
+
+	return b.String()
+}
+
+// nextToken returns the token at the start of s: a quoted string up to the closing quote (or the end of s) or the run of
+// non space characters.
+func nextToken(s string) string {
+	if q := s[0]; q == '"' || q == '\'' {
+		if i := strings.IndexByte(s[1:], q); i >= 0 {
+			return s[:i+2]
+		}
+
+		return s
+	}
+
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		return s[:i]
+	}
+
+	return s
+}
@@ -0,0 +1,60 @@
+package dialogue
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	theme := Theme{Command: "<c>", Flag: "<f>", Error: "<e>", Quoted: "<q>"}
+
+	d := &Dialogue{}
+	d.RegisterCommands(&Command{
+		Name:        "deploy",
+		SubCommands: []*Command{{Name: "app"}},
+	})
+
+	if out := d.Highlight("deploy -f x"); out != "deploy -f x" {
+		t.Fatalf("expected no styles before the theme is resolved, got: %q", out)
+	}
+
+	d.theme = theme
+
+	type testCase struct {
+		line string
+		want string
+	}
+
+	testCases := []testCase{
+		{"deploy  -force app 'my app' \"unterminated", "<c>deploy\x1b[0m  <f>-force\x1b[0m <c>app\x1b[0m <q>'my app'\x1b[0m <q>\"unterminated\x1b[0m"},
+		{"  nope x", "  <e>nope\x1b[0m x"},
+		{"deploy x app", "<c>deploy\x1b[0m x <c>app\x1b[0m"},
+	}
+
+	for _, tc := range testCases {
+		if out := d.Highlight(tc.line); out != tc.want {
+			t.Fatalf("Highlight(%q): expected %q, got %q", tc.line, tc.want, out)
+		}
+	}
+}
+
+func TestHighlightResolve(t *testing.T) {
+	d := &Dialogue{theme: Theme{Command: "<c>", Error: "<e>"}}
+	d.RegisterCommands(
+		&Command{Name: "net.ping"},
+		&Command{Name: "admin", Enabled: func(context.Context) bool { return false }},
+	)
+
+	if out := d.Highlight("ping"); out != "<e>ping\x1b[0m" {
+		t.Fatalf("expected ping to be unknown outside of the net namespace, got: %q", out)
+	}
+
+	d.namespace.set("net")
+	if out := d.Highlight("ping"); out != "<c>ping\x1b[0m" {
+		t.Fatalf("expected ping to resolve in the net namespace, got: %q", out)
+	}
+
+	if out := d.Highlight("admin"); out != "<e>admin\x1b[0m" {
+		t.Fatalf("expected the disabled command to be styled as an error, got: %q", out)
+	}
+}
@@ -0,0 +1,312 @@
+package dialogue
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HistoryEntry is a line read by the dialogue.
+type HistoryEntry struct {
+	Line string
+	Time time.Time // Time is zero if the entry was loaded from a history file without timestamps.
+}
+
+// history holds the lines read by the dialogue and appends them to the history file or, without one, to the state store.
+type history struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	size    int // size is the number of entries kept, see Dialogue.HistorySize.
+	file    *os.File
+	stamps  bool
+	store   StateStore
+}
+
+// defaultHistorySize is the default number of entries kept in the history.
+const defaultHistorySize = 500
+
+// historyKey is the key of the history in the state store. The entries are saved together under a single key, one
+// "<unix seconds> <line>" per line, so adding an entry writes one key however long the history is.
+const historyKey = "history"
+
+// open loads the entries of the history file at path and opens it for appending. The file uses the plain text format of GNU
+// readline and bash: one line per entry, optionally preceded by a "#<unix seconds>" timestamp comment. A file holding more
+// than size entries is rewritten with the last size entries.
+//
+// Without a path the entries are loaded from and saved to store, if any.
+func (h *history) open(ctx context.Context, path string, stamps bool, size int, store StateStore) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+
+	h.closeLocked()
+	h.entries, h.size, h.stamps, h.store = nil, size, stamps, nil
+	if path == "" {
+		if store == nil {
+			return nil
+		}
+
+		if err := h.loadLocked(ctx, store); err != nil {
+			return fmt.Errorf("dialogue: history: %w", err)
+		}
+		h.store = store
+
+		return nil
+	}
+
+	entries, err := readHistory(path)
+	if err != nil {
+		return fmt.Errorf("dialogue: history: %w", err)
+	}
+	h.entries = entries
+	if h.trimLocked() {
+		if err := writeHistory(path, h.entries); err != nil {
+			return fmt.Errorf("dialogue: history: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("dialogue: history: %w", err)
+	}
+	h.file = f
+
+	return nil
+}
+
+func (h *history) loadLocked(ctx context.Context, store StateStore) error {
+	v, ok, err := store.Get(ctx, historyKey)
+	if err != nil || !ok {
+		return err
+	}
+
+	for _, s := range strings.Split(strings.TrimSuffix(v, "\n"), "\n") {
+		var e HistoryEntry
+		stamp, line, _ := strings.Cut(s, " ")
+		if sec, err := strconv.ParseInt(stamp, 10, 64); err == nil && sec != 0 {
+			e.Time = time.Unix(sec, 0)
+		}
+		e.Line = line
+		h.entries = append(h.entries, e)
+	}
+	h.trimLocked()
+
+	return nil
+}
+
+// trimLocked drops the oldest entries past the size of the history, it reports whether any entry was dropped.
+func (h *history) trimLocked() bool {
+	n := len(h.entries) - h.size
+	if n <= 0 {
+		return false
+	}
+
+	h.entries = append(h.entries[:0], h.entries[n:]...)
+	return true
+}
+
+// encodeLocked returns the entries in the format saved in the state store, see historyKey.
+func (h *history) encodeLocked() string {
+	var b strings.Builder
+	for _, e := range h.entries {
+		var sec int64
+		if !e.Time.IsZero() {
+			sec = e.Time.Unix()
+		}
+
+		b.WriteString(strconv.FormatInt(sec, 10))
+		b.WriteByte(' ')
+		b.WriteString(e.Line)
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+func readHistory(path string) ([]HistoryEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	var stamp time.Time
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// readline only treats comments followed by a digit as timestamps.
+		if len(line) > 1 && line[0] == '#' && line[1] >= '0' && line[1] <= '9' {
+			if sec, err := strconv.ParseInt(line[1:], 10, 64); err == nil {
+				stamp = time.Unix(sec, 0)
+				continue
+			}
+		}
+
+		entries = append(entries, HistoryEntry{line, stamp})
+		stamp = time.Time{}
+	}
+
+	return entries, scanner.Err()
+}
+
+// writeHistory replaces the history file at path with entries, the entries with a time keep their timestamp comment.
+func writeHistory(path string, entries []HistoryEntry) error {
+	var b strings.Builder
+	for _, e := range entries {
+		writeHistoryEntry(&b, e, !e.Time.IsZero())
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeHistoryEntry writes e in the format of the history file, preceded by its timestamp comment if stamp is set.
+func writeHistoryEntry(b *strings.Builder, e HistoryEntry, stamp bool) {
+	if stamp {
+		fmt.Fprintf(b, "#%d\n", e.Time.Unix())
+	}
+	b.WriteString(e.Line)
+	b.WriteByte('\n')
+}
+
+// add records line and appends it to the history file or saves it in the state store.
+func (h *history) add(ctx context.Context, line string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e := HistoryEntry{line, time.Now()}
+	h.entries = append(h.entries, e)
+	h.trimLocked()
+	if h.store != nil {
+		return h.store.Set(ctx, historyKey, h.encodeLocked())
+	}
+
+	if h.file == nil {
+		return nil
+	}
+
+	var b strings.Builder
+	writeHistoryEntry(&b, e, h.stamps)
+
+	_, err := h.file.WriteString(b.String())
+	return err
+}
+
+func (h *history) close() {
+	h.mu.Lock()
+	h.closeLocked()
+	h.mu.Unlock()
+}
+
+func (h *history) closeLocked() {
+	h.store = nil
+	if h.file != nil {
+		h.file.Close()
+		h.file = nil
+	}
+}
+
+// defaultRecentInputLimit is the default number of lines kept by the recent input ring.
+const defaultRecentInputLimit = 50
+
+// inputRing keeps the last limit raw lines read by the dialogue, see RecentInputFromContext.
+type inputRing struct {
+	mu    sync.Mutex
+	limit int
+	lines []string
+}
+
+func (r *inputRing) add(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.limit <= 0 {
+		return
+	}
+
+	if len(r.lines) == r.limit {
+		r.lines = r.lines[:copy(r.lines, r.lines[1:])]
+	}
+	r.lines = append(r.lines, line)
+}
+
+// get returns a copy of the lines, oldest first.
+func (r *inputRing) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.lines...)
+}
+
+// reset drops the lines and sets the number of lines kept to limit.
+func (r *inputRing) reset(limit int) {
+	r.mu.Lock()
+	r.limit, r.lines = limit, nil
+	r.mu.Unlock()
+}
+
+// History returns the lines read by the dialogue, starting with the entries loaded from the history file.
+func (d *Dialogue) History() []HistoryEntry {
+	d.history.mu.Lock()
+	defer d.history.mu.Unlock()
+
+	return append([]HistoryEntry(nil), d.history.entries...)
+}
+
+func (d *Dialogue) historyCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		Structure:    name + " [count]",
+		HelpShort:    "lists the lines read by the dialogue, optionally only the last count",
+		ValidateArgs: Range(0, 1),
+		Exec: func(chain *CallChain, args []string) error {
+			entries := d.History()
+			start := 0
+			if len(args) == 1 {
+				count, err := strconv.Atoi(args[0])
+				if err != nil || count < 0 {
+					return d.reportError(chain.GetCurrent().Context(), name, fmt.Errorf("invalid count %v", args[0]))
+				}
+
+				if count < len(entries) {
+					start = len(entries) - count
+				}
+			}
+
+			rows := make([][]string, 0, len(entries)-start)
+			for i := start; i < len(entries); i++ {
+				rows = append(rows, []string{strconv.Itoa(i + 1), entries[i].Line})
+			}
+
+			return d.renderer.Table(rows)
+		},
+	}
+}
@@ -0,0 +1,177 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("echo a\n#1700000000\necho b\n# comment\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Dialogue{
+		R:                 strings.NewReader("echo c\nquit\n"),
+		W:                 nopReadWriter{},
+		QuitCmd:           "quit",
+		HistoryFile:       path,
+		HistoryTimestamps: true,
+	}
+	d.RegisterCommands(&Command{
+		Name: "echo",
+		Exec: func(_ *CallChain, _ []string) error { return nil },
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	entries := d.History()
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, e.Line)
+	}
+	if got := strings.Join(lines, "|"); got != "echo a|echo b|# comment|echo c|quit" {
+		t.Fatalf("unexpected history: %v", got)
+	}
+
+	if !entries[0].Time.IsZero() || entries[1].Time.Unix() != 1700000000 {
+		t.Fatalf("unexpected timestamps: %v %v", entries[0].Time, entries[1].Time)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the appended lines are preceded by timestamp comments.
+	appended := strings.Split(strings.TrimPrefix(string(b), "echo a\n#1700000000\necho b\n# comment\n"), "\n")
+	if len(appended) != 5 || !strings.HasPrefix(appended[0], "#") || appended[1] != "echo c" || appended[3] != "quit" {
+		t.Fatalf("unexpected history file: %q", b)
+	}
+}
+
+func TestHistorySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("echo a\n#1700000000\necho b\necho c\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemoryStore()
+	newDialogue := func(file string) *Dialogue {
+		d := &Dialogue{
+			R:           strings.NewReader("echo d\nquit\n"),
+			W:           nopReadWriter{},
+			QuitCmd:     "quit",
+			HistoryFile: file,
+			HistorySize: 2,
+			Store:       store,
+		}
+		d.RegisterCommands(&Command{
+			Name: "echo",
+			Exec: func(_ *CallChain, _ []string) error { return nil },
+		})
+
+		return d
+	}
+	lines := func(d *Dialogue) string {
+		var lines []string
+		for _, e := range d.History() {
+			lines = append(lines, e.Line)
+		}
+
+		return strings.Join(lines, "|")
+	}
+
+	d := newDialogue(path)
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+	if got := lines(d); got != "echo d|quit" {
+		t.Fatalf("unexpected history: %v", got)
+	}
+
+	// the file is trimmed when opened, the lines read afterwards are appended.
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "#1700000000\necho b\necho c\necho d\nquit\n" {
+		t.Fatalf("unexpected history file: %q", b)
+	}
+
+	for i := 0; i < 2; i++ {
+		d = newDialogue("")
+		if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+			t.Fatalf("recieved unexpected err: %v", err)
+		}
+	}
+	if got := lines(d); got != "echo d|quit" {
+		t.Fatalf("unexpected history: %v", got)
+	}
+
+	// the whole history is saved under a single key.
+	keys, _ := store.List(context.Background(), "")
+	if !reflect.DeepEqual(keys, []string{historyKey}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	if v, _, _ := store.Get(context.Background(), historyKey); strings.Count(v, "\n") != 2 {
+		t.Fatalf("expected the stored history to be trimmed, got: %q", v)
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	w := newWriteExpected(t, []byte("2  echo b\n3  history 2\n"))
+	d := &Dialogue{
+		R:          strings.NewReader("echo a\necho b\nhistory 2\nquit\n"),
+		W:          w,
+		QuitCmd:    "quit",
+		HistoryCmd: "history",
+	}
+	d.RegisterCommands(&Command{
+		Name: "echo",
+		Exec: func(_ *CallChain, _ []string) error { return nil },
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecentInput(t *testing.T) {
+	var recent []string
+	d := &Dialogue{
+		R:                strings.NewReader("echo a\n\n  report now\nquit\n"),
+		W:                nopReadWriter{},
+		QuitCmd:          "quit",
+		RecentInputLimit: 2,
+	}
+	d.RegisterCommands(
+		&Command{Name: "echo", Exec: func(_ *CallChain, _ []string) error { return nil }},
+		&Command{
+			Name: "report",
+			Exec: func(chain *CallChain, _ []string) error {
+				recent = RecentInputFromContext(chain.GetCurrent().Context())
+				return nil
+			},
+		},
+	)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if !reflect.DeepEqual(recent, []string{"", "  report now"}) {
+		t.Fatalf("unexpected recent input: %q", recent)
+	}
+}
@@ -0,0 +1,63 @@
+package dialogue
+
+import (
+	"fmt"
+	"sync"
+)
+
+// lazyCommand constructs a command registered by RegisterLazy once.
+type lazyCommand struct {
+	once  sync.Once
+	build func() *Command
+	cmd   *Command
+	err   error
+}
+
+// RegisterLazy registers a command named name which is only constructed by build when it is first invoked, build is called
+// at most once. Use it for heavyweight commands which open clients or read big configs to keep the startup fast.
+//
+// Until it is constructed the command is listed by the help output with its name only and it isnt completed past its
+// name. The command returned by build is registered under name whatever its Name field is. If the dialogue is running the
+// call is no-op.
+func (d *Dialogue) RegisterLazy(name string, build func() *Command) {
+	d.RegisterCommands(&Command{
+		Name: name,
+		lazy: &lazyCommand{build: build},
+	})
+}
+
+// lookup is like Dialogue.command but it constructs lazy commands.
+func (d *Dialogue) lookup(name string) (*Command, bool, error) {
+	cmd, ok := d.command(name)
+	if !ok || cmd.lazy == nil {
+		return cmd, ok, nil
+	}
+
+	built, err := d.construct(cmd)
+	return built, err == nil, err
+}
+
+// construct returns the command constructed by the lazy command cmd, initialised like the registered commands.
+func (d *Dialogue) construct(cmd *Command) (*Command, error) {
+	l := cmd.lazy
+	l.once.Do(func() {
+		// the once is spent even if build panics, the error stays until the command is constructed.
+		l.err = fmt.Errorf("dialogue: lazy command %v panicked while constructed", cmd.Name)
+		built := l.build()
+		if built == nil {
+			l.err = fmt.Errorf("dialogue: lazy command %v constructed a nil command", cmd.Name)
+			return
+		}
+		built.Name = cmd.Name
+
+		d.mu.Lock()
+		l.err = walkCommands(map[string]*Command{built.Name: built}, d.initCommand)
+		d.mu.Unlock()
+		if l.err == nil {
+			l.cmd = built
+			d.help.invalidate()
+		}
+	})
+
+	return l.cmd, l.err
+}
@@ -0,0 +1,85 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRegisterLazy(t *testing.T) {
+	w := newWriteExpected(t, []byte("heavy: \nheavy 3\nheavy 1\nheavy: constructed lazily\n"))
+
+	var builds int
+	d := &Dialogue{
+		R:       strings.NewReader("help\nheavy -n 3\nheavy\nhelp\nquit\n"),
+		W:       w,
+		Plain:   true,
+		HelpCmd: "help",
+		QuitCmd: "quit",
+		// only format the lazy command in the help output.
+		FormatHelp: func(cmd string, cmds map[string]*Command) string {
+			return cmds["heavy"].formatHelp(false)
+		},
+	}
+	d.RegisterLazy("heavy", func() *Command {
+		builds++
+		fs := flag.NewFlagSet("heavy", flag.ContinueOnError)
+		n := fs.Int("n", 1, "")
+
+		return &Command{
+			Name:      "ignored",
+			HelpShort: "constructed lazily",
+			FlagSet:   fs,
+			Exec: func(chain *CallChain, _ []string) error {
+				_, err := fmt.Fprintf(w, "%v %v\n", chain.GetCurrent().Name, *n)
+				return err
+			},
+		}
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if builds != 1 {
+		t.Fatalf("expected the command to be constructed once, got %v", builds)
+	}
+}
+
+func TestRegisterLazyErrors(t *testing.T) {
+	var reported []string
+	d := &Dialogue{
+		W: nopReadWriter{},
+		OnError: func(_ context.Context, cmd string, err error) {
+			reported = append(reported, cmd)
+		},
+	}
+	d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+	d.RegisterLazy("nil", func() *Command { return nil })
+	d.RegisterLazy("panics", func() *Command { panic("boom") })
+
+	if err := d.Execute(context.Background(), "nil"); err != nil {
+		t.Fatalf("expected the construction error to be reported, got: %v", err)
+	}
+
+	func() {
+		defer func() { recover() }()
+		d.Execute(context.Background(), "panics")
+	}()
+
+	// the panic spent the construction, the error is reported from now on.
+	if err := d.Execute(context.Background(), "panics"); err != nil {
+		t.Fatalf("expected the construction error to be reported, got: %v", err)
+	}
+
+	if strings.Join(reported, " ") != "nil panics" {
+		t.Fatalf("expected the errors of nil and panics to be reported, got: %v", reported)
+	}
+}
@@ -0,0 +1,298 @@
+package dialogue
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LineReader reads the lines of a dialogue, implement it to plug in a line editing library such as chzyer/readline or
+// golang.org/x/term. ReadLine displays prompt and returns the next line without the line ending, io.EOF once the input is
+// exhausted. It should return early with the context error when ctx is cancelled, which happens when the dialogue is closed.
+type LineReader interface {
+	ReadLine(ctx context.Context, prompt string) (string, error)
+}
+
+// LineReaderFunc adapts a function to the LineReader interface.
+type LineReaderFunc func(ctx context.Context, prompt string) (string, error)
+
+func (f LineReaderFunc) ReadLine(ctx context.Context, prompt string) (string, error) {
+	return f(ctx, prompt)
+}
+
+// scannerLineReader is the default line reader, it renders the prompt with r and scans the lines of the preamptive reader
+// which is cancelled by the base context of the dialogue.
+type scannerLineReader struct {
+	r       Renderer
+	scanner *bufio.Scanner
+	lines   *lineSplitter
+	src     *drainReader
+}
+
+func (r *scannerLineReader) ReadLine(_ context.Context, prompt string) (string, error) {
+	if err := r.r.Prompt(prompt); err != nil {
+		return "", err
+	}
+
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+
+		return "", io.EOF
+	}
+
+	if r.lines.tooLong {
+		r.lines.tooLong = false
+		return "", ErrInputLimit{"line length", r.lines.max}
+	}
+
+	return r.scanner.Text(), nil
+}
+
+// newScannerLineReader creates the default line reader over the preamptive reader.
+func (d *Dialogue) newScannerLineReader() *scannerLineReader {
+	lines := &lineSplitter{max: d.MaxLineLength}
+	src := &drainReader{r: d.pr}
+
+	return &scannerLineReader{r: d.renderer, scanner: newLineScanner(src, lines), lines: lines, src: src}
+}
+
+// newLineScanner creates the scanner splitting the lines of src with lines.
+func newLineScanner(src io.Reader, lines *lineSplitter) *bufio.Scanner {
+	scanner := bufio.NewScanner(src)
+	scanner.Split(lines.split)
+	if lines.max > 0 {
+		// leave room for the byte which exceeds the limit.
+		scanner.Buffer(make([]byte, 0, 4096), lines.max+2)
+	}
+
+	return scanner
+}
+
+// drainReader reads from r until drained is set, it then reports io.EOF so the scanner only returns the lines it already
+// buffered and r is left untouched for the next session. The reads of the preamptive reader are also cancelled by wait, if
+// set.
+type drainReader struct {
+	r       io.Reader
+	drained bool
+	wait    context.Context
+}
+
+func (r *drainReader) Read(p []byte) (int, error) {
+	if r.drained {
+		return 0, io.EOF
+	}
+
+	if pr, ok := r.r.(*PreamptiveReader); ok && r.wait != nil {
+		return pr.readContext(r.wait, p)
+	}
+
+	return r.r.Read(p)
+}
+
+// keyWaiter is implemented by the line readers which can wait for any key instead of a whole line, see WatchCmd. waitKey
+// returns the error of ctx once ctx is done, the line reader stays usable.
+type keyWaiter interface {
+	waitKey(ctx context.Context) error
+}
+
+// waitKey waits for the next bytes of the input and discards them along with the lines scanned ahead, if any. Once ctx is
+// done the scanner, which keeps the error of the cancelled read, is replaced and the stranded read is claimed by the next
+// line.
+func (r *scannerLineReader) waitKey(ctx context.Context) error {
+	r.lines.anyKey, r.src.wait = true, ctx
+	defer func() { r.lines.anyKey, r.src.wait = false, nil }()
+
+	if !r.scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			// any key empties the buffer of the scanner so no line is lost with it.
+			r.scanner = newLineScanner(r.src, r.lines)
+			return err
+		}
+
+		if err := r.scanner.Err(); err != nil {
+			return err
+		}
+
+		return io.EOF
+	}
+
+	return nil
+}
+
+// lineSplitter splits the lines like bufio.ScanLines but also ends them on a lone "\r", as sent by some telnet clients
+// and old Mac applications. The "\n" or NUL following a "\r" is dropped without waiting for it.
+//
+// The lines longer than max bytes, if positive, are dropped while they are read and replaced by an empty line with
+// tooLong set. The last line of the input is dropped if it isnt terminated and dropPartial is set.
+type lineSplitter struct {
+	max         int
+	dropPartial bool
+	afterCR     bool
+	discarding  bool // discarding reports whether the rest of the current line is dropped.
+	tooLong     bool // tooLong reports whether the last line was dropped.
+	anyKey      bool // anyKey makes any input a token, see scannerLineReader.waitKey.
+}
+
+func (l *lineSplitter) split(data []byte, atEOF bool) (int, []byte, error) {
+	skip := 0
+	if l.afterCR && len(data) > 0 {
+		l.afterCR = false
+		if data[0] == '\n' || data[0] == 0 {
+			skip = 1
+		}
+	}
+	data = data[skip:]
+
+	if l.anyKey && len(data) > 0 {
+		l.afterCR, l.discarding = false, false
+		return skip + len(data), []byte{}, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		l.afterCR = data[i] == '\r'
+		return skip + i + 1, l.token(data[:i]), nil
+	}
+
+	if atEOF && len(data) > 0 {
+		if l.dropPartial {
+			return skip + len(data), nil, nil
+		}
+
+		return skip + len(data), l.token(data), nil
+	}
+
+	if l.max > 0 && len(data) > l.max {
+		l.discarding = true
+		return skip + len(data), nil, nil
+	}
+
+	return skip, nil, nil
+}
+
+// token returns the line ending the current token.
+func (l *lineSplitter) token(line []byte) []byte {
+	if l.discarding || (l.max > 0 && len(line) > l.max) {
+		l.discarding, l.tooLong = false, true
+		return []byte{}
+	}
+
+	return line
+}
+
+// ErrInputLimit is reported when a line read by the dialogue exceeds one of its input limits, see Dialogue.MaxLineLength.
+// The line isnt dispatched.
+type ErrInputLimit struct {
+	Limit string // Limit names the exceeded limit: "line length", "tokens" or "depth".
+	Max   int
+}
+
+func (e ErrInputLimit) Error() string {
+	return fmt.Sprintf("dialogue: input exceeds the %v limit of %d", e.Limit, e.Max)
+}
+
+// checkInput returns an ErrInputLimit if line or its fields exceed the input limits of the dialogue.
+func (d *Dialogue) checkInput(line string, fields []string) error {
+	if d.MaxLineLength > 0 && len(line) > d.MaxLineLength {
+		return ErrInputLimit{"line length", d.MaxLineLength}
+	}
+
+	if d.MaxTokens > 0 && len(fields) > d.MaxTokens {
+		return ErrInputLimit{"tokens", d.MaxTokens}
+	}
+
+	return nil
+}
+
+// fieldsPool recycles the fields of the lines dispatched by Open and Execute, see splitFields.
+var fieldsPool = sync.Pool{New: func() any { return new([]string) }}
+
+// splitFields splits line around each run of white space like strings.Fields into a slice taken from fieldsPool. The
+// slice is handed back with putFields once the line is dispatched.
+func splitFields(line string) *[]string {
+	p := fieldsPool.Get().(*[]string)
+	fields := (*p)[:0]
+
+	start := -1
+	for i, r := range line {
+		switch {
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		case unicode.IsSpace(r) && start >= 0:
+			fields = append(fields, line[start:i])
+			start = -1
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, line[start:])
+	}
+
+	*p = fields
+	return p
+}
+
+// putFields clears the fields, dropping the references to the line, and puts them back in fieldsPool.
+func putFields(p *[]string) {
+	fields := *p
+	for i := range fields {
+		fields[i] = ""
+	}
+
+	*p = fields[:0]
+	fieldsPool.Put(p)
+}
+
+// ControlChars controls what happens to the control characters, other than tabs, of the lines read by the dialogue before
+// they are tokenized. Raw network input can carry escape sequences which corrupt the args and the prompt redraw.
+type ControlChars int
+
+const (
+	// ControlStrip drops the control characters and the ANSI escape sequences such as "\x1b[31m". This is the default.
+	ControlStrip ControlChars = iota
+
+	// ControlEscape replaces the control characters with their escaped form, "\x1b" for example.
+	ControlEscape
+
+	// ControlKeep keeps the control characters.
+	ControlKeep
+)
+
+// sanitize applies the ControlChars policy to line.
+func (d *Dialogue) sanitize(line string) string {
+	if d.ControlChars == ControlKeep || strings.IndexFunc(line, isControl) < 0 {
+		return line
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+
+		switch {
+		case r == '\x1b' && d.ControlChars == ControlStrip && strings.HasPrefix(line[i:], "["):
+			// skip the parameters of the control sequence up to its final byte.
+			i++
+			for i < len(line) && (line[i] < 0x40 || line[i] > 0x7e) {
+				i++
+			}
+			i++
+		case !isControl(r):
+			b.WriteRune(r)
+		case d.ControlChars == ControlEscape:
+			fmt.Fprintf(&b, "\\x%02x", r)
+		}
+	}
+
+	return b.String()
+}
+
+func isControl(r rune) bool {
+	return r != '\t' && unicode.IsControl(r)
+}
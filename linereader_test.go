@@ -0,0 +1,136 @@
+package dialogue
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLineReader(t *testing.T) {
+	lines := []string{"greet a", "greet b"}
+	var prompts []string
+	var greeted []string
+
+	d := &Dialogue{
+		Prefix: "> ",
+		W:      nopReadWriter{},
+		LineReader: LineReaderFunc(func(_ context.Context, prompt string) (string, error) {
+			prompts = append(prompts, prompt)
+			if len(lines) == 0 {
+				return "", io.EOF
+			}
+
+			line := lines[0]
+			lines = lines[1:]
+			return line, nil
+		}),
+	}
+	d.RegisterCommands(&Command{
+		Name: "greet",
+		Exec: func(_ *CallChain, args []string) error {
+			greeted = append(greeted, fmt.Sprint(args))
+			return nil
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrEOF) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if !reflect.DeepEqual(greeted, []string{"[a]", "[b]"}) || !reflect.DeepEqual(prompts, []string{"> ", "> ", "> "}) {
+		t.Fatalf("unexpected greetings %v with prompts %q", greeted, prompts)
+	}
+}
+
+func TestScanLines(t *testing.T) {
+	scanner := bufio.NewScanner(iotest.OneByteReader(strings.NewReader("a\r\nb\rc\r\x00d\n\re")))
+	scanner.Split((&lineSplitter{}).split)
+
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if expected := []string{"a", "b", "c", "d", "", "e"}; !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected %q, got: %q", expected, lines)
+	}
+}
+
+func TestControlChars(t *testing.T) {
+	tests := []struct {
+		policy   ControlChars
+		expected []string
+	}{
+		{ControlStrip, []string{"red", "a b"}},
+		{ControlEscape, []string{"\\x1b[31mred", "a b\\x07"}},
+		{ControlKeep, []string{"\x1b[31mred", "a b\a"}},
+	}
+
+	for _, tt := range tests {
+		var said []string
+		d := &Dialogue{
+			R:            strings.NewReader("say \x1b[31mred\r\nsay a\tb\a\r\n"),
+			W:            nopReadWriter{},
+			ControlChars: tt.policy,
+		}
+		d.RegisterCommands(&Command{
+			Name: "say",
+			Exec: func(_ *CallChain, args []string) error {
+				said = append(said, strings.Join(args, " "))
+				return nil
+			},
+		})
+
+		if err := d.Open(); !errors.Is(err, ErrEOF) {
+			t.Fatalf("recieved unexpected err: %v", err)
+		}
+
+		if !reflect.DeepEqual(said, tt.expected) {
+			t.Fatalf("policy %v: expected %q, got: %q", tt.policy, tt.expected, said)
+		}
+	}
+}
+
+func TestInputLimits(t *testing.T) {
+	var said []string
+	var limits []string
+	d := &Dialogue{
+		R:             strings.NewReader("say " + strings.Repeat("x", 10000) + "\nsay a b c d\nloop loop loop\nloop loop\nsay ok\n"),
+		W:             nopReadWriter{},
+		MaxLineLength: 50,
+		MaxTokens:     4,
+		MaxDepth:      2,
+		OnError: func(_ context.Context, _ string, err error) {
+			var limit ErrInputLimit
+			if errors.As(err, &limit) {
+				limits = append(limits, limit.Limit)
+			}
+		},
+	}
+	loop := &Command{Name: "loop", Exec: func(_ *CallChain, _ []string) error { return nil }}
+	loop.SubCommands = []*Command{loop}
+	d.RegisterCommands(loop, &Command{
+		Name: "say",
+		Exec: func(_ *CallChain, args []string) error {
+			said = append(said, strings.Join(args, " "))
+			return nil
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrEOF) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if expected := []string{"line length", "tokens", "depth"}; !reflect.DeepEqual(limits, expected) {
+		t.Fatalf("expected the limits %q, got: %q", expected, limits)
+	}
+	if !reflect.DeepEqual(said, []string{"ok"}) {
+		t.Fatalf("expected only the lines within the limits, got: %q", said)
+	}
+}
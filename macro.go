@@ -0,0 +1,211 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// macros holds the recorded macros of a dialogue and the state of the current recording.
+type macros struct {
+	mu        sync.Mutex
+	lines     map[string][]string // lines maps the macro names to the recorded lines.
+	recording string              // recording is the name of the macro being recorded, empty when not recording.
+	buf       []string            // buf holds the lines recorded so far.
+	playing   map[string]bool     // playing holds the macros being played, used to detect recursive macros.
+}
+
+// capture records line if a recording is in progress. The line isnt recorded if it differs from its redacted form since
+// the macros are persisted, see Dialogue.Redact.
+func (m *macros) capture(line, redacted string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.recording == "" {
+		return nil
+	}
+
+	if line != redacted {
+		return fmt.Errorf("line not recorded into macro %v: it holds redacted input", m.recording)
+	}
+
+	m.buf = append(m.buf, line)
+	return nil
+}
+
+// names returns the sorted names of the recorded macros.
+func (m *macros) names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]string, 0, len(m.lines))
+	for name := range m.lines {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// macroPrefix prefixes the keys of the macros in the state store.
+const macroPrefix = "macro/"
+
+// load reads the macros from store, if any.
+func (m *macros) load(ctx context.Context, store StateStore) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lines, m.recording, m.buf, m.playing = nil, "", nil, nil
+	if store == nil {
+		return nil
+	}
+
+	keys, err := store.List(ctx, macroPrefix)
+	if err != nil {
+		return fmt.Errorf("dialogue: macros: %w", err)
+	}
+
+	m.lines = make(map[string][]string, len(keys))
+	for _, key := range keys {
+		v, ok, err := store.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("dialogue: macros: %w", err)
+		}
+
+		if ok {
+			m.lines[strings.TrimPrefix(key, macroPrefix)] = strings.Split(v, "\n")
+		}
+	}
+
+	return nil
+}
+
+func (d *Dialogue) recordCommand(name string) *Command {
+	return &Command{
+		Name:      name,
+		Structure: fmt.Sprintf("%v start <macro-name> | %v stop", name, name),
+		HelpShort: "records the following lines into a macro",
+		HelpLong: `record start captures every following line into the named macro until record stop, the lines are still
+executed while recording. Recording a macro under an existing name replaces it.`,
+		ValidateArgs: func(args []string) error {
+			if len(args) > 0 && args[0] == "stop" {
+				return Range(1, 1)(args)
+			}
+
+			return Validate(args, Range(2, 2), func(args []string) error { return OneOf("start")(args[:1]) })
+		},
+		Exec: func(chain *CallChain, args []string) error {
+			ctx := chain.GetCurrent().Context()
+			m := &d.macros
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			if args[0] == "start" {
+				if m.recording != "" {
+					return d.reportError(ctx, name, fmt.Errorf("already recording macro %v", m.recording))
+				}
+
+				m.recording, m.buf = args[1], nil
+				return nil
+			}
+
+			if m.recording == "" {
+				return d.reportError(ctx, name, errors.New("not recording"))
+			}
+
+			if m.lines == nil {
+				m.lines = make(map[string][]string)
+			}
+			macro := m.recording
+			m.lines[macro] = m.buf
+			m.recording, m.buf = "", nil
+
+			if d.Store == nil {
+				return nil
+			}
+
+			if err := d.Store.Set(ctx, macroPrefix+macro, strings.Join(m.lines[macro], "\n")); err != nil {
+				return d.reportError(ctx, name, fmt.Errorf("saving macro: %w", err))
+			}
+
+			return nil
+		},
+	}
+}
+
+func (d *Dialogue) playCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		Structure:    fmt.Sprintf("%v [macro-name]", name),
+		HelpShort:    "replays a recorded macro or lists the macros",
+		ValidateArgs: Range(0, 1),
+		Exec: func(chain *CallChain, args []string) error {
+			ctx := chain.GetCurrent().Context()
+			m := &d.macros
+
+			if len(args) == 0 {
+				return d.printText(d.formatMacros())
+			}
+			macro := args[0]
+
+			m.mu.Lock()
+			lines, ok := m.lines[macro]
+			recursive := m.playing[macro]
+			if ok && !recursive {
+				if m.playing == nil {
+					m.playing = make(map[string]bool)
+				}
+				m.playing[macro] = true
+			}
+			m.mu.Unlock()
+
+			switch {
+			case !ok:
+				return d.reportError(ctx, name, fmt.Errorf("macro %v not found", macro))
+			case recursive:
+				return d.reportError(ctx, name, fmt.Errorf("macro %v plays itself", macro))
+			}
+
+			defer func() {
+				m.mu.Lock()
+				delete(m.playing, macro)
+				m.mu.Unlock()
+			}()
+
+			for _, line := range lines {
+				fields := strings.Fields(line)
+				if len(fields) == 0 {
+					continue
+				}
+
+				if err := d.dispatchHandler(ctx, line, fields); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+// formatMacros formats the names of the recorded macros under a heading, it returns an empty string if there are none.
+func (d *Dialogue) formatMacros() string {
+	names := d.macros.names()
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(d.theme.style(d.theme.Heading, "MACROS"))
+	b.WriteByte('\n')
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
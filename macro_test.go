@@ -0,0 +1,80 @@
+package dialogue
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMacro(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newDialogue := func(input string, w *writeExpected) *Dialogue {
+		d := &Dialogue{
+			R:         strings.NewReader(input),
+			W:         w,
+			QuitCmd:   "quit",
+			HelpCmd:   "help",
+			RecordCmd: "record",
+			PlayCmd:   "play",
+			Store:     store,
+			FormatHelp: func(_ string, _ map[string]*Command) string {
+				return "commands\n"
+			},
+		}
+		d.RegisterCommands(&Command{
+			Name: "echo",
+			Exec: func(_ *CallChain, args []string) error {
+				_, err := fmt.Fprintln(w, strings.Join(args, " "))
+				return err
+			},
+		})
+
+		return d
+	}
+
+	w := newWriteExpected(t, []byte(""+
+		"hello\n"+
+		"world\n"+
+		"hello\n"+
+		"world\n"+
+		"MACROS\ngreet\n"+
+		"commands\n\nMACROS\ngreet\n"+
+		"macro missing not found\n"+
+		"macro loop plays itself\n",
+	))
+	d := newDialogue(""+
+		"record start greet\necho hello\necho world\nrecord stop\n"+
+		"play greet\nplay\nhelp\nplay missing\n"+
+		"record start loop\nrecord stop\nrecord start loop\nplay loop\nrecord stop\nplay loop\n"+
+		"quit\n", w)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the macros are persisted across dialogues.
+	if store, err = OpenFileStore(path); err != nil {
+		t.Fatal(err)
+	}
+	w = newWriteExpected(t, []byte("hello\nworld\n"))
+	d = newDialogue("play greet\nquit\n", w)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,94 @@
+package dialogue
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// namespaceSep separates the namespace from the name of namespaced commands (net.ping).
+const namespaceSep = "."
+
+// namespaceOf returns the namespace of the command named name, empty for commands without a namespace.
+func namespaceOf(name string) string {
+	if i := strings.LastIndex(name, namespaceSep); i > 0 {
+		return name[:i]
+	}
+
+	return ""
+}
+
+// namespace holds the namespace selected by the use command, its commands are reachable without the prefix.
+type namespace struct {
+	atomic.Value
+}
+
+func (n *namespace) get() string {
+	ns, _ := n.Load().(string)
+	return ns
+}
+
+func (n *namespace) set(ns string) {
+	n.Store(ns)
+}
+
+// resolve returns the name of the command name refers to in the current namespace if there is one.
+func (n *namespace) resolve(name string, cmds map[string]*Command) (string, bool) {
+	if ns := n.get(); ns != "" {
+		if _, ok := cmds[ns+namespaceSep+name]; ok {
+			return ns + namespaceSep + name, true
+		}
+	}
+
+	return "", false
+}
+
+// groupByNamespace splits the sorted commands into the commands without a namespace and the commands of every namespace
+// in the order of the namespaces first command.
+func groupByNamespace(cmds []*Command) (root []*Command, names []string, groups map[string][]*Command) {
+	groups = make(map[string][]*Command)
+	for _, cmd := range cmds {
+		ns := namespaceOf(cmd.Name)
+		if ns == "" {
+			root = append(root, cmd)
+			continue
+		}
+
+		if _, ok := groups[ns]; !ok {
+			names = append(names, ns)
+		}
+		groups[ns] = append(groups[ns], cmd)
+	}
+
+	return root, names, groups
+}
+
+func (d *Dialogue) useCommand(name string) *Command {
+	return &Command{
+		Name:      name,
+		Structure: fmt.Sprintf("%v [<namespace> | -]", name),
+		HelpShort: "shows or sets the namespace whose commands are reachable without the prefix",
+		HelpLong: `use shows the current namespace when ran without arguments. When a namespace is set its commands can be called
+without the namespace prefix, "use net" makes "ping" call "net.ping". - clears the namespace.`,
+		ValidateArgs: Range(0, 1),
+		Exec: func(chain *CallChain, args []string) error {
+			if len(args) == 0 {
+				return d.renderer.PrintLine(d.namespace.get())
+			}
+
+			if args[0] == "-" {
+				d.namespace.set("")
+				return nil
+			}
+
+			for cmdName := range d.commands {
+				if strings.HasPrefix(cmdName, args[0]+namespaceSep) {
+					d.namespace.set(args[0])
+					return nil
+				}
+			}
+
+			return d.reportError(chain.GetCurrent().Context(), name, fmt.Errorf("no namespace named %v", args[0]))
+		},
+	}
+}
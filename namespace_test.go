@@ -0,0 +1,73 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNamespaces(t *testing.T) {
+	w := newWriteExpected(t, []byte(""+
+		"ping: pings a host\n\nDB\ndb.migrate: \n\nNET\nnet.ping: pings a net host\nnet.trace: \n"+
+		"global ping\n"+
+		"net ping\n"+
+		"net\n"+
+		"no namespace named nope\n"+
+		"global ping\n",
+	))
+
+	d := &Dialogue{
+		R:       strings.NewReader("help\nping\nuse net\nping\nuse\nuse nope\nuse -\nping\nquit\n"),
+		W:       w,
+		Plain:   true,
+		HelpCmd: "help",
+		UseCmd:  "use",
+		QuitCmd: "quit",
+	}
+
+	say := func(name, short, out string) *Command {
+		return &Command{Name: name, HelpShort: short, Exec: func(_ *CallChain, _ []string) error {
+			_, err := fmt.Fprintln(w, out)
+			return err
+		}}
+	}
+	d.RegisterCommands(
+		say("ping", "pings a host", "global ping"),
+		say("net.ping", "pings a net host", "net ping"),
+		say("net.trace", "", ""),
+		say("db.migrate", "", ""),
+	)
+
+	// only format the user commands in the help output.
+	d.FormatHelp = func(cmd string, cmds map[string]*Command) string {
+		user := make(map[string]*Command)
+		for name, c := range cmds {
+			if !c.immediate {
+				user[name] = c
+			}
+		}
+
+		return defaultHelpFormater(d.theme, cmd, user)
+	}
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	d.namespace.set("net")
+	out, err := d.DefaultCompleter().Complete(context.Background(), "p", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []Suggestion{{"ping", "pings a net host"}}; !reflect.DeepEqual(out, expected) {
+		t.Fatalf("expected %v but got %v", expected, out)
+	}
+}
@@ -0,0 +1,199 @@
+package dialogue
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultLastOutputLimit is the default number of bytes kept from the output of the previous command.
+const defaultLastOutputLimit = 64 << 10
+
+// defaultLastOutputs is the default number of previous outputs kept by the output ring.
+const defaultLastOutputs = 10
+
+// outputCapture wraps W, it captures the output written during a dispatch so it can be retrieved by the next ones. Only
+// the last limit bytes of every output are kept, in a ring of the keep last outputs.
+type outputCapture struct {
+	mu        sync.Mutex
+	w         io.Writer
+	tee       *transcript // tee records the output in the transcript, nil without Transcript.
+	limit     int
+	keep      int
+	capturing bool
+	cur       []byte
+	outputs   []string // outputs holds the previous outputs, oldest first.
+}
+
+func (c *outputCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tee != nil {
+		c.tee.output(p)
+	}
+
+	if c.capturing {
+		c.cur = append(c.cur, p...)
+		if over := len(c.cur) - c.limit; over > 0 {
+			c.cur = c.cur[:copy(c.cur, c.cur[over:])]
+		}
+	}
+
+	return c.w.Write(p)
+}
+
+// control writes the terminal control sequence seq to the wrapped writer, it isnt part of the output so it is neither
+// captured nor recorded in the transcript.
+func (c *outputCapture) control(seq string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := io.WriteString(c.w, seq)
+	return err
+}
+
+// begin starts capturing the output of a dispatch.
+func (c *outputCapture) begin() {
+	c.mu.Lock()
+	c.capturing = true
+	c.cur = c.cur[:0]
+	c.mu.Unlock()
+}
+
+// end stops capturing and makes the captured output the last output.
+func (c *outputCapture) end() {
+	c.flush()
+
+	c.mu.Lock()
+	c.capturing = false
+	if c.keep > 0 && len(c.outputs) >= c.keep {
+		c.outputs = c.outputs[:copy(c.outputs, c.outputs[len(c.outputs)-c.keep+1:])]
+	}
+	c.outputs = append(c.outputs, string(c.cur))
+	c.mu.Unlock()
+}
+
+// flush records the unterminated output line of a dispatch in the transcript.
+func (c *outputCapture) flush() {
+	if c.tee != nil {
+		c.tee.flush()
+	}
+}
+
+// setWriter replaces the wrapped writer.
+func (c *outputCapture) setWriter(w io.Writer) {
+	c.mu.Lock()
+	c.w = w
+	c.mu.Unlock()
+}
+
+// prompt marks prompt as the prompt of the next read, see syncWriter.setPrompt.
+func (c *outputCapture) prompt(prompt string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.w.(*syncWriter); ok {
+		s.setPrompt(prompt)
+	}
+}
+
+// reset drops the previous outputs.
+func (c *outputCapture) reset() {
+	c.mu.Lock()
+	c.cur, c.outputs = nil, nil
+	c.mu.Unlock()
+}
+
+// lastOutput returns the output captured by the previous dispatch.
+func (c *outputCapture) lastOutput() string {
+	out, _ := c.previous(1)
+	return out
+}
+
+// previous returns the output captured n dispatches ago, 1 being the previous dispatch. It reports false if the output
+// isnt kept.
+func (c *outputCapture) previous(n int) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n < 1 || n > len(c.outputs) {
+		return "", false
+	}
+
+	return c.outputs[len(c.outputs)-n], true
+}
+
+// previousOutputs returns the previous outputs, newest first.
+func (c *outputCapture) previousOutputs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]string, len(c.outputs))
+	for i, o := range c.outputs {
+		out[len(out)-1-i] = o
+	}
+
+	return out
+}
+
+// lastToken is replaced by the previous output in the lines dispatched by the dialogue, see Dialogue.ShowCmd.
+const lastToken = "$LAST"
+
+// expandLast replaces the fields which are exactly $LAST with the previous output without its trailing line ending. fields
+// is copied before it is changed.
+func (d *Dialogue) expandLast(fields []string) []string {
+	expanded := fields
+	for i, f := range fields {
+		if f != lastToken {
+			continue
+		}
+
+		if &expanded[0] == &fields[0] {
+			expanded = append([]string(nil), fields...)
+		}
+		expanded[i] = strings.TrimSuffix(d.out.lastOutput(), "\n")
+	}
+
+	return expanded
+}
+
+func (d *Dialogue) showCommand(name string) *Command {
+	last := &Command{
+		Name:         "last",
+		Structure:    "last [<n>]",
+		HelpShort:    "writes the output of the previous command again, or of the command n dispatches ago",
+		ValidateArgs: Range(0, 1),
+		Exec: func(chain *CallChain, args []string) error {
+			ctx := chain.GetCurrent().Context()
+			n := 1
+			if len(args) == 1 {
+				var err error
+				if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+					return d.reportError(ctx, name, fmt.Errorf("invalid output %q, expected a positive number", args[0]))
+				}
+			}
+
+			out, ok := d.out.previous(n)
+			if !ok && n > 1 {
+				return d.reportError(ctx, name, fmt.Errorf("output %d isnt kept", n))
+			}
+
+			return d.printText(out)
+		},
+	}
+
+	return &Command{
+		Name:         name,
+		Structure:    name + " last [<n>]",
+		HelpShort:    "shows the state kept by the dialogue",
+		SubCommands:  []*Command{last},
+		ValidateArgs: Range(0, 0),
+		Exec: func(_ *CallChain, _ []string) error {
+			// only reached without a sub command.
+			return d.printText(d.commands[name].formatHelp(true))
+		},
+	}
+}
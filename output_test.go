@@ -0,0 +1,157 @@
+package dialogue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLastOutput(t *testing.T) {
+	w := newWriteExpected(t, []byte(""+
+		"ok 1\nerr 2\nok 3\nerr 4\n"+
+		"err 2\nerr 4\n"+
+		"err 2\nerr 4\n"+
+		"ok 1\nerr 2\nok 3\nerr 4\n"+
+		"ok 1\nerr 2\nok 3\nerr 4\n",
+	))
+
+	d := &Dialogue{
+		R:       strings.NewReader("say\ngrep err\nshow last\nsay\nshow last\nquit\n"),
+		W:       w,
+		QuitCmd: "quit",
+		ShowCmd: "show",
+	}
+	d.RegisterCommands(
+		&Command{
+			Name: "say",
+			Exec: func(chain *CallChain, _ []string) error {
+				w, _ := OutFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprint(w, "ok 1\nerr 2\nok 3\nerr 4\n")
+				return err
+			},
+		},
+		&Command{
+			Name: "grep",
+			Exec: func(chain *CallChain, args []string) error {
+				ctx := chain.GetCurrent().Context()
+				w, _ := OutFromContext(ctx)
+				last, _ := LastOutputFromContext(ctx)
+
+				for _, line := range strings.SplitAfter(last, "\n") {
+					if line != "" && strings.Contains(line, args[0]) {
+						if _, err := fmt.Fprint(w, line); err != nil {
+							return err
+						}
+					}
+				}
+
+				return nil
+			},
+		},
+	)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutputRing(t *testing.T) {
+	var echoed []string
+	var previous []string
+	var hookErr error
+	w := newWriteExpected(t, []byte("a\nb\nc\nb\noutput 3 isnt kept\n"))
+	d := &Dialogue{
+		W:           w,
+		ShowCmd:     "show",
+		LastOutputs: 2,
+		OnError: func(_ context.Context, _ string, err error) {
+			hookErr = err
+		},
+	}
+	d.RegisterCommands(
+		&Command{
+			Name: "say",
+			Exec: func(chain *CallChain, args []string) error {
+				previous = PreviousOutputsFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprintln(d.out, args[0])
+				return err
+			},
+		},
+		&Command{
+			Name: "echo",
+			Exec: func(_ *CallChain, args []string) error {
+				echoed = append([]string(nil), args...)
+				return nil
+			},
+		},
+	)
+
+	for _, line := range []string{"say a", "say b", "say c", "show last 2", "echo x $LAST", "show last 3"} {
+		if err := d.Execute(context.Background(), line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(previous, []string{"b\n", "a\n"}) {
+		t.Fatalf("expected the previous outputs newest first, got: %q", previous)
+	}
+	if !reflect.DeepEqual(echoed, []string{"x", "b"}) {
+		t.Fatalf("expected $LAST to be replaced by the previous output, got: %q", echoed)
+	}
+	if hookErr == nil {
+		t.Fatal("expected the outputs past LastOutputs to be dropped")
+	}
+
+	chain, err := d.ParseLine("echo $LAST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := chain.GetCurrent().Args(); !reflect.DeepEqual(args, []string{"output 3 isnt kept"}) {
+		t.Fatalf("expected ParseLine to replace $LAST, got: %q", args)
+	}
+}
+
+func TestOutputCaptureLimit(t *testing.T) {
+	c := &outputCapture{w: nopReadWriter{}, limit: 4}
+
+	c.begin()
+	fmt.Fprint(c, "abc")
+	fmt.Fprint(c, "defg")
+	c.end()
+
+	if out := c.lastOutput(); out != "defg" {
+		t.Fatalf("expected the last 4 bytes to be kept, got: %q", out)
+	}
+}
+
+func TestOutputCaptureControl(t *testing.T) {
+	var w, record bytes.Buffer
+	c := &outputCapture{w: &w, tee: &transcript{w: &record}, limit: 64}
+
+	c.begin()
+	fmt.Fprint(c, "a\n")
+	c.control("\x1b[2J")
+	fmt.Fprint(c, "b\n")
+	c.end()
+
+	if w.String() != "a\n\x1b[2Jb\n" {
+		t.Fatalf("expected the sequence to be written in order, got: %q", w.String())
+	}
+	if out := c.lastOutput(); out != "a\nb\n" {
+		t.Fatalf("expected the sequence not to be captured, got: %q", out)
+	}
+	if strings.Contains(record.String(), "\x1b") {
+		t.Fatalf("expected the sequence not to be recorded, got: %q", record.String())
+	}
+}
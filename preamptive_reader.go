@@ -53,6 +53,9 @@ type PreamptiveReader struct {
 	writeFromRead chan []byte // reads from the reader.
 	bytesRead     chan int    // signals that the request read is over to whoever is intereseted.
 	err           error       // sticky error.
+
+	pending bool   // pending reports whether a read cancelled by readContext is still stranded on the source reader.
+	rest    []byte // rest holds the bytes of the stranded read which didnt fit in the buffer of the read claiming it.
 }
 
 // listen reads from r or buf on demand.
@@ -102,11 +105,24 @@ func (r *PreamptiveReader) readFromBuf(buf []byte) (int, error) {
 // The listen go routine wont get cleaned up till the stranded read returns, up until the cleanup, the first registered read will claim the
 // stranded read and work as expected.
 func (r *PreamptiveReader) Read(buf []byte) (int, error) {
+	return r.readContext(context.Background(), buf)
+}
+
+// readContext is like Read but it also returns early with the error of ctx once ctx is done. Unlike a cancellation of the
+// context of the reader, the read stranded by ctx is claimed by the next read which returns its bytes. The buffer passed to
+// the cancelled read must not be reused since the stranded read still writes to it.
+func (r *PreamptiveReader) readContext(ctx context.Context, buf []byte) (int, error) {
 	if !r.claimRead.CompareAndSwap(false, true) {
 		return 0, errors.New("cannot claim a read during another read")
 	}
 	defer r.claimRead.Store(false)
 
+	if len(r.rest) > 0 {
+		n := copy(buf, r.rest)
+		r.rest = r.rest[n:]
+		return n, nil
+	}
+
 	// check if we are claiming a faulty read, if when claiming a reader we dont have an error we will
 	// either be the first ones to find out about the error or find no error at all.
 	if r.err != nil {
@@ -121,6 +137,7 @@ func (r *PreamptiveReader) Read(buf []byte) (int, error) {
 			return 0, nil
 		}
 
+		r.pending = false
 		r.writeFromMem <- buf
 
 		n, ok := <-r.bytesRead
@@ -132,12 +149,36 @@ func (r *PreamptiveReader) Read(buf []byte) (int, error) {
 	default:
 	}
 
+	// a read stranded by readContext is still going on, claim it instead of requesting a new one.
+	if r.pending {
+		select {
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case n, ok := <-r.bytesRead:
+			r.pending = false
+			if !ok {
+				return 0, r.err
+			}
+
+			read := r.buf[:n]
+			r.buf = nil
+			n = copy(buf, read)
+			r.rest = read[n:]
+			return n, nil
+		}
+	}
+
 	// context not cancelled and we claimed the reader. We need to request a new read.
 	r.writeFromRead <- buf
 
 	select {
 	case <-r.ctx.Done():
 		return 0, r.ctx.Err()
+	case <-ctx.Done():
+		r.pending = true
+		return 0, ctx.Err()
 	case n, ok := <-r.bytesRead:
 		r.buf = nil // nullate the buffer when a 1:1 communication has gone through.
 
@@ -148,3 +189,13 @@ func (r *PreamptiveReader) Read(buf []byte) (int, error) {
 		return n, nil
 	}
 }
+
+// drain discards the bytes buffered by the reader and releases its listen go routine once the read stranded on the source,
+// if any, returns. The reader must not be used afterwards.
+func (r *PreamptiveReader) drain() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r.ctx = ctx
+	go io.Copy(io.Discard, r)
+}
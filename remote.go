@@ -0,0 +1,147 @@
+package dialogue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// RemoteClient forwards command lines to a remote dialogue and streams back its output, use its CommandNotFound method as
+// the CommandNotFound handler of a local dialogue to extend a remote one: the local commands take precedence and every
+// other line is forwarded.
+//
+// The remote dialogue is a plain Dialogue reading from and writing to the connection (R and W set to the same net.Conn
+// for example), it must have a non empty Prefix which delimits the output of every command.
+type RemoteClient struct {
+	// Dial opens the connection to the remote dialogue, it is called lazily and again after the connection broke. Any
+	// transport works: a TCP connection, an SSH session or an in memory pipe.
+	Dial func(ctx context.Context) (io.ReadWriteCloser, error)
+
+	// Prompt is the Prefix of the remote dialogue, it ends the output of every command. Prefer a distinctive prompt since
+	// output which happens to end with it is cut short.
+	Prompt string
+
+	mu   sync.Mutex
+	conn io.ReadWriteCloser
+}
+
+// CommandNotFound forwards the line of the dispatch in ctx (see LineFromContext) to the remote dialogue and writes the
+// output to the output of the dispatch. The connection is closed if ctx is cancelled while waiting for the output.
+func (c *RemoteClient) CommandNotFound(ctx context.Context, args []string) error {
+	line, ok := LineFromContext(ctx)
+	if !ok {
+		line = strings.Join(args, " ")
+	}
+
+	w, ok := OutFromContext(ctx)
+	if !ok {
+		w = io.Discard
+	}
+
+	return c.Forward(ctx, line, w)
+}
+
+// Forward sends line to the remote dialogue and copies its output to w.
+func (c *RemoteClient) Forward(ctx context.Context, line string, w io.Writer) error {
+	if c.Prompt == "" {
+		return errors.New("dialogue: remote: empty prompt")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		conn, err := c.Dial(ctx)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+
+		// consume the first prompt of the remote dialogue.
+		if err := c.copyOutput(ctx, io.Discard); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(c.conn, line+"\n"); err != nil {
+		c.closeLocked()
+		return err
+	}
+
+	return c.copyOutput(ctx, w)
+}
+
+// copyOutput copies the output of the remote dialogue to w up to the next prompt, the connection is dropped on errors.
+func (c *RemoteClient) copyOutput(ctx context.Context, w io.Writer) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	conn := c.conn
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close() // unblock the read.
+		case <-done:
+		}
+	}()
+
+	err := c.readUntilPrompt(w)
+	if err != nil {
+		c.closeLocked()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// readUntilPrompt copies the output to w up to the prompt. The remote dialogue writes the prompt and waits for the next
+// line after every command, so the prompt is recognised when the output read so far ends with it.
+func (c *RemoteClient) readUntilPrompt(w io.Writer) error {
+	prompt := []byte(c.Prompt)
+	buf := make([]byte, 4096)
+
+	var pending []byte
+	for {
+		n, err := c.conn.Read(buf)
+		pending = append(pending, buf[:n]...)
+		if bytes.HasSuffix(pending, prompt) {
+			_, err := w.Write(pending[:len(pending)-len(prompt)])
+			return err
+		}
+
+		// hold back the bytes which could be the start of the prompt.
+		if keep := len(pending) - len(prompt); keep > 0 {
+			if _, err := w.Write(pending[:keep]); err != nil {
+				return err
+			}
+			pending = append(pending[:0], pending[keep:]...)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the connection to the remote dialogue, the next forwarded line dials again.
+func (c *RemoteClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closeLocked()
+}
+
+func (c *RemoteClient) closeLocked() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
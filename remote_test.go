@@ -0,0 +1,56 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestRemoteClient(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+
+	rd := &Dialogue{Prefix: "remote> ", R: remote, W: remote}
+	rd.RegisterCommands(&Command{
+		Name: "uptime",
+		Exec: func(chain *CallChain, args []string) error {
+			w, _ := OutFromContext(chain.GetCurrent().Context())
+			_, err := fmt.Fprintf(w, "up %v\npartial", strings.Join(args, " "))
+			return err
+		},
+	})
+	go rd.Open()
+	defer rd.Close()
+
+	client := &RemoteClient{
+		Dial:   func(context.Context) (io.ReadWriteCloser, error) { return local, nil },
+		Prompt: "remote> ",
+	}
+
+	w := newWriteExpected(t, []byte("local\nup 3 days\npartialup 4 days\npartial"))
+	d := &Dialogue{
+		R:               strings.NewReader("hello\nuptime 3 days\nuptime 4  days\nquit\n"),
+		W:               w,
+		QuitCmd:         "quit",
+		CommandNotFound: client.CommandNotFound,
+	}
+	d.RegisterCommands(&Command{
+		Name: "hello",
+		Exec: func(_ *CallChain, _ []string) error {
+			_, err := fmt.Fprintln(w, "local")
+			return err
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+package dialogue
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Renderer renders the interactions of the default handlers and builtin commands, implement it to embed a dialogue in a
+// GUI or TUI frontend (bubbletea or a web terminal for example) and render them natively. The output of the user commands
+// still goes to the writer returned by OutFromContext.
+type Renderer interface {
+	// PrintLine renders a line of text, multi line texts such as the help output are rendered with a single call.
+	PrintLine(line string) error
+
+	// PrintError renders an error reported to the user, such as an invalid argument or an unknown command.
+	PrintError(err error) error
+
+	// Prompt renders the prompt of the default line reader and the confirmation prompts.
+	Prompt(prompt string) error
+
+	// Table renders rows of cells, such as the scheduled commands.
+	Table(rows [][]string) error
+}
+
+// TextRenderer is optionally implemented by the renderers which render the multi line texts, such as the help output, as
+// is instead of as a single line with PrintLine. The text usually ends with a line ending but it isnt guaranteed.
+type TextRenderer interface {
+	PrintText(text string) error
+}
+
+// writerRenderer is the default renderer, it writes to w styled with theme and the errors to errW.
+type writerRenderer struct {
+	w     io.Writer
+	errW  io.Writer
+	theme Theme
+}
+
+func (r writerRenderer) PrintLine(line string) error {
+	_, err := fmt.Fprintln(r.w, line)
+	return err
+}
+
+func (r writerRenderer) PrintText(text string) error {
+	_, err := io.WriteString(r.w, text)
+	return err
+}
+
+func (r writerRenderer) PrintError(err error) error {
+	_, werr := fmt.Fprintln(r.errW, r.theme.style(r.theme.Error, err.Error()))
+	return werr
+}
+
+func (r writerRenderer) Prompt(prompt string) error {
+	_, err := io.WriteString(r.w, prompt)
+	return err
+}
+
+func (r writerRenderer) Table(rows [][]string) error {
+	tw := tabwriter.NewWriter(r.w, 0, 2, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// resolveRendererLocked sets the renderer used by the default handlers, the theme must be resolved.
+func (d *Dialogue) resolveRendererLocked() {
+	d.renderer = d.Renderer
+	if d.renderer == nil {
+		d.renderer = writerRenderer{d.out, d.eout, d.theme}
+	}
+}
+
+// printText renders a text ending with a line ending through the renderer, empty texts arent rendered. The text is
+// rendered with PrintText if the renderer is a TextRenderer and as a single line otherwise.
+func (d *Dialogue) printText(s string) error {
+	return printText(d.renderer, s)
+}
+
+func printText(r Renderer, s string) error {
+	if s == "" {
+		return nil
+	}
+
+	if tr, ok := r.(TextRenderer); ok {
+		return tr.PrintText(s)
+	}
+
+	return r.PrintLine(strings.TrimSuffix(s, "\n"))
+}
+
+// rendererTo returns the default renderer r writing to w, custom renderers are returned as is.
+func (d *Dialogue) rendererTo(r Renderer, w io.Writer) Renderer {
+	if wr, ok := r.(writerRenderer); ok {
+		return writerRenderer{w, wr.errW, wr.theme}
+	}
+
+	return r
+}
+
+// commandRenderer returns the renderer of the command named name, the default renderer writes to its Output if it has
+// one. Custom renderers are returned as is.
+func (d *Dialogue) commandRenderer(name string) Renderer {
+	if r, ok := d.renderer.(writerRenderer); ok {
+		if cmd, _ := d.command(name); cmd != nil && cmd.Output != nil {
+			return writerRenderer{cmd.Output, cmd.Output, r.theme}
+		}
+	}
+
+	return d.renderer
+}
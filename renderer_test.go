@@ -0,0 +1,79 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// recordRenderer records the rendered interactions.
+type recordRenderer struct {
+	calls []string
+}
+
+func (r *recordRenderer) PrintLine(line string) error {
+	r.calls = append(r.calls, "line: "+line)
+	return nil
+}
+
+func (r *recordRenderer) PrintError(err error) error {
+	r.calls = append(r.calls, "error: "+err.Error())
+	return nil
+}
+
+func (r *recordRenderer) Prompt(prompt string) error {
+	r.calls = append(r.calls, "prompt: "+prompt)
+	return nil
+}
+
+func (r *recordRenderer) Table(rows [][]string) error {
+	r.calls = append(r.calls, fmt.Sprintf("table: %v", rows))
+	return nil
+}
+
+func TestRenderer(t *testing.T) {
+	r := &recordRenderer{}
+	d := &Dialogue{
+		Prefix:       "> ",
+		R:            strings.NewReader("nope\nverbosity\nschedules\nquit\n"),
+		W:            nopReadWriter{},
+		Renderer:     r,
+		QuitCmd:      "quit",
+		VerbosityCmd: "verbosity",
+		SchedulesCmd: "schedules",
+		FormatHelp:   func(string, map[string]*Command) string { return "help\n" },
+	}
+	d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	expected := []string{
+		"prompt: > ", "error: Command: nope not found", "line: help",
+		"prompt: > ", "line: normal",
+		"prompt: > ", "table: []",
+		"prompt: > ",
+	}
+	if !reflect.DeepEqual(r.calls, expected) {
+		t.Fatalf("expected %q but got %q", expected, r.calls)
+	}
+}
+
+func TestRendererStateDump(t *testing.T) {
+	r := &recordRenderer{}
+	d := &Dialogue{W: nopReadWriter{}, Renderer: r}
+	d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+	if err := d.Execute(context.Background(), "noop"); err != nil {
+		t.Fatal(err)
+	}
+
+	d.handleSignal(syscall.SIGQUIT)
+	if len(r.calls) != 1 || !strings.HasPrefix(r.calls[0], "table: [[running false] [commands 1]") {
+		t.Fatalf("expected the state to be rendered as a table, got: %q", r.calls)
+	}
+}
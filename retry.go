@@ -0,0 +1,114 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type attemptKey struct{}
+
+// RetryPolicy retries the executions of a command which fail, such as network probes or eventual consistency checks, see
+// Command.Retry.
+type RetryPolicy struct {
+	// Attempts is the maximum number of executions of the command, values below 2 disable the retries.
+	Attempts int
+
+	// Backoff optionally returns the delay before the attempt following attempt, the attempts are numbered from 1. The
+	// attempts are retried right away when it is nil, see ExponentialBackoff.
+	Backoff func(attempt int) time.Duration
+
+	// RetryIf optionally reports whether the error of an execution is retried. By default every error is retried except
+	// the aborts, the context errors and ErrDialogueClosed.
+	RetryIf func(err error) bool
+}
+
+// retries reports whether err is retried.
+func (p *RetryPolicy) retries(err error) bool {
+	if p.RetryIf != nil {
+		return p.RetryIf(err)
+	}
+
+	return !errors.As(err, &ErrAborted{}) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded) &&
+		!errors.Is(err, ErrDialogueClosed)
+}
+
+// ExponentialBackoff returns a RetryPolicy.Backoff which waits base before the second attempt and doubles the delay on
+// every attempt up to max, a non positive max doesnt cap the delay.
+func ExponentialBackoff(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 1; i < attempt && (max <= 0 || delay < max); i++ {
+			delay *= 2
+		}
+
+		if max > 0 && delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+// AttemptFromContext returns the attempt of the current execution of a command with a RetryPolicy, starting at 1. The sub
+// commands advanced to with a context derived from the context of their invocation inherit the attempt. It returns 1 for
+// the commands which arent retried.
+//
+// Middleware such as Timing read it from the context of the invocation once the hop returns to report the number of
+// attempts.
+func AttemptFromContext(ctx context.Context) int {
+	if attempt, ok := ctx.Value(attemptKey{}).(int); ok {
+		return attempt
+	}
+
+	return 1
+}
+
+// wrapRetry wraps the hops of the call chain with retry if any of them has a RetryPolicy. It has to be called before the
+// middleware of the dialogue wraps the chain so the middleware sees a retried hop as a single execution.
+func (c *CallChain) wrapRetry() {
+	for _, inv := range *c {
+		if inv.Retry != nil && inv.Retry.Attempts > 1 {
+			c.Wrap(retry)
+			return
+		}
+	}
+}
+
+// retry executes the hop until it succeeds, its error isnt retried or it ran out of attempts. The chain is restored before
+// every attempt since the hop can advance it.
+func retry(next StepFunc) StepFunc {
+	return func(chain *CallChain, args []string) error {
+		inv := chain.GetCurrent()
+		p := inv.Retry
+		if p == nil || p.Attempts < 2 {
+			return next(chain, args)
+		}
+
+		ctx := inv.Context()
+		saved := *chain
+		for attempt := 1; ; attempt++ {
+			*chain = saved
+			inv.ctx = context.WithValue(ctx, attemptKey{}, attempt)
+
+			err := next(chain, args)
+			if err == nil || attempt >= p.Attempts || !p.retries(err) {
+				return err
+			}
+
+			var delay time.Duration
+			if p.Backoff != nil {
+				delay = p.Backoff(attempt)
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package dialogue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var buf bytes.Buffer
+	var calls, rootCalls, reported int
+	var attempts []int
+	report := func(ctx context.Context, _ string, _ time.Duration) {
+		reported = AttemptFromContext(ctx)
+	}
+
+	errFlaky := errors.New("flaky")
+	d := &Dialogue{W: &buf, Middleware: []func(StepFunc) StepFunc{Timing(0, report)}}
+	sub := &Command{
+		Name:  "sub",
+		Retry: &RetryPolicy{Attempts: 3, Backoff: ExponentialBackoff(time.Millisecond, 0)},
+		Exec: func(chain *CallChain, _ []string) error {
+			calls++
+			ctx := chain.GetCurrent().Context()
+			attempts = append(attempts, AttemptFromContext(ctx))
+
+			// the chain is restored before every attempt.
+			return chain.AdvanceExec(1, ctx)
+		},
+	}
+	d.RegisterCommands(
+		&Command{
+			Name:        "probe",
+			SubCommands: []*Command{sub},
+			Exec: func(_ *CallChain, _ []string) error {
+				rootCalls++
+				if rootCalls < 3 {
+					return errFlaky
+				}
+				return nil
+			},
+		},
+		&Command{
+			Name:  "fatal",
+			Retry: &RetryPolicy{Attempts: 3, RetryIf: func(err error) bool { return err != errFlaky }},
+			Exec: func(_ *CallChain, _ []string) error {
+				calls++
+				return errFlaky
+			},
+		},
+	)
+
+	if err := d.Execute(context.Background(), "probe sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 3 || rootCalls != 3 || len(attempts) != 3 || attempts[2] != 3 {
+		t.Fatalf("expected 3 attempts, got %d calls, %d root calls and attempts %v", calls, rootCalls, attempts)
+	}
+
+	if reported != 3 || !strings.Contains(buf.String(), "(3 attempts)") {
+		t.Fatalf("expected the attempts to be reported, got %d and output %q", reported, buf.String())
+	}
+
+	calls = 0
+	if err := d.Execute(context.Background(), "fatal"); err != errFlaky {
+		t.Fatalf("expected %v, got: %v", errFlaky, err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected RetryIf to stop the retries, got %d calls", calls)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+
+	for attempt, expected := range map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond, 3: 40 * time.Millisecond, 4: 50 * time.Millisecond, 10: 50 * time.Millisecond} {
+		if got := backoff(attempt); got != expected {
+			t.Fatalf("expected a delay of %v before the attempt following %d, got %v", expected, attempt, got)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type scheduleKey struct{}
+
+// schedule is a line dispatched periodically in the background.
+type schedule struct {
+	id       int
+	interval time.Duration
+	line     string
+	cancel   context.CancelFunc
+}
+
+// scheduler runs the schedules of a dialogue, every schedule runs in its own go routine until it is unscheduled or the
+// dialogue closes.
+type scheduler struct {
+	mu        sync.Mutex
+	next      int
+	schedules map[int]*schedule
+	wg        sync.WaitGroup
+}
+
+// start schedules line to be dispatched every interval, the schedule stops when ctx is cancelled.
+func (s *scheduler) start(d *Dialogue, ctx context.Context, interval time.Duration, line string) *schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next++
+	sch := &schedule{id: s.next, interval: interval, line: line}
+	ctx, sch.cancel = context.WithCancel(context.WithValue(ctx, scheduleKey{}, sch.id))
+
+	if s.schedules == nil {
+		s.schedules = make(map[int]*schedule)
+	}
+	s.schedules[sch.id] = sch
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.remove(sch.id)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := d.dispatchScheduled(ctx, sch); err != nil {
+				d.reportError(ctx, strings.Fields(line)[0], fmt.Errorf("schedule %d stopped: %w", sch.id, err))
+				return
+			}
+		}
+	}()
+
+	return sch
+}
+
+// remove cancels and removes the schedule with the provided id, it reports false if there is no such schedule.
+func (s *scheduler) remove(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sch, ok := s.schedules[id]
+	if !ok {
+		return false
+	}
+
+	sch.cancel()
+	delete(s.schedules, id)
+	return true
+}
+
+// list returns the schedules ordered by id.
+func (s *scheduler) list() []*schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*schedule, 0, len(s.schedules))
+	for _, sch := range s.schedules {
+		out = append(out, sch)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].id < out[j].id
+	})
+
+	return out
+}
+
+// cancel cancels and removes every schedule without waiting for them to exit, a schedule waiting for the current dispatch
+// returns without dispatching.
+func (s *scheduler) cancel() {
+	for _, sch := range s.list() {
+		s.remove(sch.id)
+	}
+}
+
+// stop cancels every schedule and waits for them to exit.
+func (s *scheduler) stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// dispatchScheduled dispatches the line of sch after writing a header which attributes the following output to it. The
+// scheduled dispatches dont touch the state of the dispatches of the user: they arent queued into the transaction, arent
+// recorded for undo and their output isnt captured as the last output.
+func (d *Dialogue) dispatchScheduled(ctx context.Context, sch *schedule) error {
+	d.dispatching.Lock()
+	defer d.dispatching.Unlock()
+
+	// the schedule could have been cancelled while waiting for the current dispatch.
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	defer d.out.flush()
+
+	header := fmt.Sprintf("[%d] %v", sch.id, d.redact(sch.line))
+	if err := d.renderer.PrintLine(d.theme.style(d.theme.Heading, header)); err != nil {
+		return err
+	}
+
+	return d.dispatchHandler(ctx, sch.line, strings.Fields(sch.line))
+}
+
+// scheduledFromContext reports if the dispatch of ctx was started by a schedule.
+func scheduledFromContext(ctx context.Context) bool {
+	_, ok := ctx.Value(scheduleKey{}).(int)
+	return ok
+}
+
+func (d *Dialogue) everyCommand(name string) *Command {
+	return &Command{
+		Name:      name,
+		Structure: fmt.Sprintf("%v <interval> <command-line>", name),
+		HelpShort: "dispatches a command line periodically in the background",
+		HelpLong: `every dispatches the command line every interval (such as 5s or 1m) until it is unscheduled or the dialogue
+closes. The output of every run is preceded by the id of the schedule and the command line. Schedules need an open
+dialogue, they are stopped when it is closed, shut down or reset.`,
+		ValidateArgs: func(args []string) error {
+			if err := Range(2, -1)(args); err != nil {
+				return err
+			}
+
+			if interval, err := time.ParseDuration(args[0]); err != nil || interval <= 0 {
+				return fmt.Errorf("invalid interval %q, expected a positive duration such as 5s or 1m", args[0])
+			}
+
+			return nil
+		},
+		Exec: func(chain *CallChain, args []string) error {
+			interval, _ := time.ParseDuration(args[0])
+			line := strings.Join(args[1:], " ")
+
+			// a schedule started outside of Open would outlive the dialogue.
+			d.mu.Lock()
+			ctx, running := d.ctx, d.running
+			d.mu.Unlock()
+			if !running {
+				return d.reportError(chain.GetCurrent().Context(), name, errors.New("schedules need an open dialogue"))
+			}
+
+			sch := d.schedules.start(d, ctx, interval, line)
+			return d.renderer.PrintLine(fmt.Sprintf("scheduled %d", sch.id))
+		},
+	}
+}
+
+func (d *Dialogue) schedulesCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		HelpShort:    "lists the scheduled command lines",
+		ValidateArgs: Range(0, 0),
+		Exec: func(_ *CallChain, _ []string) error {
+			var rows [][]string
+			for _, sch := range d.schedules.list() {
+				rows = append(rows, []string{strconv.Itoa(sch.id), fmt.Sprintf("every %v", sch.interval), d.redact(sch.line)})
+			}
+
+			return d.renderer.Table(rows)
+		},
+	}
+}
+
+func (d *Dialogue) unscheduleCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		Structure:    fmt.Sprintf("%v <schedule-id>", name),
+		HelpShort:    "stops a scheduled command line",
+		ValidateArgs: Range(1, 1),
+		Exec: func(chain *CallChain, args []string) error {
+			id, err := strconv.Atoi(args[0])
+			if err != nil || !d.schedules.remove(id) {
+				return d.reportError(chain.GetCurrent().Context(), name, errors.New("no schedule "+args[0]))
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,192 @@
+package dialogue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestScheduler(t *testing.T) {
+	r, pw := io.Pipe()
+	w := &syncBuffer{}
+	ticks := make(chan struct{}, 16)
+
+	d := &Dialogue{
+		R:             r,
+		W:             w,
+		QuitCmd:       "quit",
+		EveryCmd:      "every",
+		SchedulesCmd:  "schedules",
+		UnscheduleCmd: "unschedule",
+	}
+	d.RegisterCommands(&Command{
+		Name: "tick",
+		Exec: func(_ *CallChain, _ []string) error {
+			ticks <- struct{}{}
+			return nil
+		},
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- d.Open() }()
+
+	io.WriteString(pw, "every 0s tick\nevery 5ms tick\nschedules\n")
+	<-ticks
+	<-ticks
+	io.WriteString(pw, "unschedule 1\nunschedule 2\nschedules\nquit\n")
+
+	if err := <-errs; !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	out := w.String()
+	for _, want := range []string{
+		"invalid interval \"0s\"",
+		"scheduled 1\n",
+		"1  every 5ms  tick\n",
+		"[1] tick\n",
+		"no schedule 2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got: %q", want, out)
+		}
+	}
+
+	if n := len(d.schedules.list()); n != 0 {
+		t.Fatalf("expected no schedules after close, got %d", n)
+	}
+}
+
+func TestSchedulerIsolation(t *testing.T) {
+	r, pw := io.Pipe()
+	ticks, said, peeked := make(chan struct{}, 64), make(chan struct{}), make(chan string)
+
+	d := &Dialogue{R: r, W: &syncBuffer{}, QuitCmd: "quit", EveryCmd: "every", BeginCmd: "begin", CommitCmd: "commit"}
+	d.RegisterCommands(
+		&Command{
+			Name: "probe",
+			Exec: func(chain *CallChain, _ []string) error {
+				out, _ := OutFromContext(chain.GetCurrent().Context())
+				io.WriteString(out, "probe\n")
+				ticks <- struct{}{}
+				return nil
+			},
+			Undo: func(_ context.Context, _ []string) error { return nil },
+		},
+		&Command{
+			Name: "say",
+			Exec: func(chain *CallChain, args []string) error {
+				out, _ := OutFromContext(chain.GetCurrent().Context())
+				io.WriteString(out, strings.Join(args, " ")+"\n")
+				said <- struct{}{}
+				return nil
+			},
+		},
+		&Command{
+			Name: "peek",
+			Exec: func(chain *CallChain, _ []string) error {
+				last, _ := LastOutputFromContext(chain.GetCurrent().Context())
+				peeked <- last
+				return nil
+			},
+		},
+	)
+
+	// waitTicks waits for the schedule to run after the dispatches which preceded the call.
+	waitTicks := func() {
+		for len(ticks) > 0 {
+			<-ticks
+		}
+		for i := 0; i < 2; i++ {
+			select {
+			case <-ticks:
+			case <-time.After(time.Second):
+				t.Fatal("expected the schedule to keep running")
+			}
+		}
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- d.Open() }()
+
+	io.WriteString(pw, "every 5ms probe\n")
+	<-ticks
+	io.WriteString(pw, "say user\n")
+	<-said
+	waitTicks()
+
+	io.WriteString(pw, "peek\n")
+	if last := <-peeked; last != "user\n" {
+		t.Fatalf("expected the last output of the user, got: %q", last)
+	}
+
+	io.WriteString(pw, "begin\n")
+	for open := false; !open; {
+		d.dispatching.Lock()
+		open = d.tx != nil
+		d.dispatching.Unlock()
+	}
+	waitTicks()
+
+	d.dispatching.Lock()
+	queued := len(d.tx.entries)
+	d.dispatching.Unlock()
+	if queued != 0 {
+		t.Fatalf("expected the schedule to run outside of the transaction, got %d queued lines", queued)
+	}
+
+	io.WriteString(pw, "quit\n")
+	if err := <-errs; !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if n := len(d.undo.groups); n != 0 {
+		t.Fatalf("expected the schedule not to be recorded for undo, got %d groups", n)
+	}
+}
+
+func TestSchedulerNeedsOpenDialogue(t *testing.T) {
+	var hookErr error
+	d := &Dialogue{
+		W:        nopReadWriter{},
+		EveryCmd: "every",
+		OnError: func(_ context.Context, _ string, err error) {
+			hookErr = err
+		},
+	}
+	d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+
+	// a schedule started without Open would never be stopped.
+	if err := d.Execute(context.Background(), "every 10ms noop"); err != nil {
+		t.Fatal(err)
+	}
+
+	if hookErr == nil || len(d.schedules.list()) != 0 {
+		t.Fatalf("expected the schedule to be rejected, got: %v", hookErr)
+	}
+}
@@ -0,0 +1,134 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownGrace is the default grace period of the shutdown triggered by SIGTERM.
+const defaultShutdownGrace = 5 * time.Second
+
+// foreground tracks the command dispatched from R, it can be interrupted by SIGINT and the cancel key.
+type foreground struct {
+	mu         sync.Mutex
+	cancel     context.CancelFunc // cancel cancels the context of the foreground command, nil if none is running.
+	line       string             // line is the line of the foreground command.
+	interrupts int                // interrupts counts the SIGINTs received since the last command started.
+}
+
+// startForeground returns the parent context of the dispatch of line. If the dialogue handles signals or the cancel key
+// the context is cancelled by SIGINT or the cancel key.
+func (d *Dialogue) startForeground(line string) context.Context {
+	if !d.HandleSignals && !d.HandleCancelKey {
+		return d.ctx
+	}
+
+	ctx, cancel := context.WithCancel(d.ctx)
+
+	d.fg.mu.Lock()
+	d.fg.cancel, d.fg.line, d.fg.interrupts = cancel, line, 0
+	d.fg.mu.Unlock()
+
+	return ctx
+}
+
+// stopForeground releases the context of the foreground command.
+func (d *Dialogue) stopForeground() {
+	d.fg.mu.Lock()
+	defer d.fg.mu.Unlock()
+
+	if d.fg.cancel != nil {
+		d.fg.cancel()
+	}
+	d.fg.cancel, d.fg.line = nil, ""
+}
+
+// notifySignals handles the signals received by the process until the returned function is called.
+func (d *Dialogue) notifySignals() (stop func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-c:
+				d.handleSignal(sig)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// handleSignal applies the signal policy of the dialogue: SIGINT cancels the foreground command and the second one closes
+// the dialogue, SIGTERM shuts the dialogue down gracefully and SIGQUIT dumps the state of the dialogue to W.
+func (d *Dialogue) handleSignal(sig os.Signal) {
+	switch sig {
+	case os.Interrupt:
+		d.fg.mu.Lock()
+		d.fg.interrupts++
+		n, cancel := d.fg.interrupts, d.fg.cancel
+		d.fg.mu.Unlock()
+
+		if n >= 2 {
+			go d.Close()
+			return
+		}
+
+		if cancel != nil {
+			cancel()
+		}
+		if !d.Quiet {
+			d.renderer.PrintError(errors.New("interrupted, press ^C again to quit"))
+		}
+	case syscall.SIGTERM:
+		grace := d.ShutdownGrace
+		if grace <= 0 {
+			grace = defaultShutdownGrace
+		}
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), grace)
+			defer cancel()
+
+			d.Shutdown(ctx)
+		}()
+	case syscall.SIGQUIT:
+		d.dumpState(d.renderer)
+	}
+}
+
+// dumpState renders a summary of the state of the dialogue as a table with r.
+func (d *Dialogue) dumpState(r Renderer) error {
+	d.mu.Lock()
+	running, commands := d.running, len(d.commands)
+	d.mu.Unlock()
+
+	d.fg.mu.Lock()
+	line := d.fg.line
+	d.fg.mu.Unlock()
+
+	return r.Table([][]string{
+		{"running", fmt.Sprint(running)},
+		{"commands", strconv.Itoa(commands)},
+		{"foreground", strconv.Quote(line)},
+		{"verbosity", fmt.Sprint(d.verbosity.get())},
+		{"trace", fmt.Sprint(d.trace.Load())},
+		{"dry-run", fmt.Sprint(d.dryRun.Load())},
+		{"schedules", strconv.Itoa(len(d.schedules.list()))},
+		{"history", strconv.Itoa(len(d.History()))},
+	})
+}
@@ -0,0 +1,90 @@
+package dialogue
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignals(t *testing.T) {
+	r, pw := io.Pipe()
+	w := &syncBuffer{}
+	started, cancelled := make(chan struct{}), make(chan struct{})
+
+	d := &Dialogue{
+		R:             r,
+		W:             w,
+		HandleSignals: true,
+	}
+	d.RegisterCommands(&Command{
+		Name: "block",
+		Exec: func(chain *CallChain, _ []string) error {
+			close(started)
+			<-chain.GetCurrent().Context().Done()
+			close(cancelled)
+			return nil
+		},
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- d.Open() }()
+
+	io.WriteString(pw, "block\n")
+	<-started
+
+	// the first interrupt only cancels the running command.
+	d.handleSignal(os.Interrupt)
+	<-cancelled
+
+	var dump bytes.Buffer
+	d.handleSignal(syscall.SIGQUIT)
+	d.dumpState(d.rendererTo(d.renderer, &dump))
+	if !strings.Contains(dump.String(), "verbosity   normal\n") {
+		t.Fatalf("unexpected state dump: %q", dump.String())
+	}
+
+	d.handleSignal(os.Interrupt)
+	if err := <-errs; !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if out := w.String(); !strings.Contains(out, "interrupted, press ^C again to quit\n") {
+		t.Fatalf("expected interrupt notice, got: %q", out)
+	}
+}
+
+func TestHandleSignalsTerminate(t *testing.T) {
+	r, pw := io.Pipe()
+	started := make(chan struct{})
+
+	d := &Dialogue{
+		R:             r,
+		W:             nopReadWriter{},
+		HandleSignals: true,
+		ShutdownGrace: 10 * time.Millisecond,
+	}
+	d.RegisterCommands(&Command{
+		Name: "start",
+		Exec: func(_ *CallChain, _ []string) error {
+			close(started)
+			return nil
+		},
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- d.Open() }()
+
+	io.WriteString(pw, "start\n")
+	<-started
+
+	// the dialogue is blocked reading, the grace period expires.
+	d.handleSignal(syscall.SIGTERM)
+	if err := <-errs; !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+}
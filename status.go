@@ -0,0 +1,158 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// lastResult tracks the outcome of the dispatches of the lines read from R and passed to Execute, the status command
+// shows the previous one.
+type lastResult struct {
+	mu     sync.Mutex
+	cur    result
+	prev   result
+	failed int // failed counts the failed dispatches.
+}
+
+// result is the outcome of a single dispatch.
+type result struct {
+	name     string
+	start    time.Time
+	duration time.Duration
+	err      error // err is the last error of the dispatch, reported or returned.
+}
+
+// status returns the exit status of the result: 0 on success, the code of an ExitError or 1 for any other error.
+func (r result) status() int {
+	var exit *ExitError
+	switch {
+	case r.err == nil:
+		return 0
+	case errors.As(r.err, &exit):
+		return exit.Code
+	default:
+		return 1
+	}
+}
+
+// begin starts tracking the dispatch of the command named name.
+func (l *lastResult) begin(name string) {
+	l.mu.Lock()
+	l.cur = result{name: name, start: time.Now()}
+	l.mu.Unlock()
+}
+
+// fail records err as the error of the tracked dispatch. The errors of the dispatches which arent tracked are dropped by
+// the next begin.
+func (l *lastResult) fail(err error) {
+	l.swapErr(err)
+}
+
+// swapErr replaces the error of the tracked dispatch with err and returns the replaced error.
+func (l *lastResult) swapErr(err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	old := l.cur.err
+	l.cur.err = err
+	return old
+}
+
+// end stops tracking the dispatch which returned err. When skip is set the dispatch isnt recorded, the status command
+// doesnt replace the result it shows.
+func (l *lastResult) end(err error, skip bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if skip {
+		return
+	}
+
+	if err != nil {
+		l.cur.err = err
+	}
+	if l.cur.err != nil {
+		l.failed++
+	}
+	l.cur.duration = time.Since(l.cur.start)
+	l.prev = l.cur
+}
+
+// get returns the result of the previous dispatch, ok is false if there was none.
+func (l *lastResult) get() (res result, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.prev, l.prev.name != ""
+}
+
+// failures returns the number of failed dispatches.
+func (l *lastResult) failures() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.failed
+}
+
+// reset drops the tracked results.
+func (l *lastResult) reset() {
+	l.mu.Lock()
+	l.cur, l.prev, l.failed = result{}, result{}, 0
+	l.mu.Unlock()
+}
+
+// beginResult starts tracking the dispatch of the line starting with the command named by name.
+func (d *Dialogue) beginResult(name string) {
+	if cmd, ok := d.command(name); ok {
+		name = cmd.Name
+	}
+
+	d.last.begin(name)
+}
+
+// endResult stops tracking the current dispatch, the dispatches of the status command arent recorded.
+func (d *Dialogue) endResult(err error) {
+	d.last.mu.Lock()
+	name := d.last.cur.name
+	d.last.mu.Unlock()
+
+	d.last.end(err, d.StatusCmd != "" && name == d.StatusCmd)
+}
+
+// dispatchResult dispatches line as a nested dispatch of the current command, failed is the last error the dispatch reported
+// to the user and err the error it returned. The errors of the nested dispatch dont count as errors of the current command.
+func (d *Dialogue) dispatchResult(ctx context.Context, line string, fields []string) (failed, err error) {
+	outer := d.last.swapErr(nil)
+	err = d.dispatchHandler(ctx, line, fields)
+	failed = d.last.swapErr(outer)
+
+	return failed, err
+}
+
+func (d *Dialogue) statusCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		HelpShort:    "shows the name, exit status, duration and error of the previous command",
+		ValidateArgs: Range(0, 0),
+		Exec: func(_ *CallChain, _ []string) error {
+			res, ok := d.last.get()
+			if !ok {
+				return d.renderer.PrintLine("no previous command")
+			}
+
+			rows := [][]string{
+				{"command", res.name},
+				{"status", strconv.Itoa(res.status())},
+				{"duration", res.duration.Round(time.Millisecond).String()},
+			}
+			if res.err != nil {
+				rows = append(rows, []string{"error", res.err.Error()})
+			}
+
+			return d.renderer.Table(rows)
+		},
+	}
+}
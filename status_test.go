@@ -0,0 +1,53 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStatusCommand(t *testing.T) {
+	w := &syncBuffer{}
+	d := &Dialogue{W: w, StatusCmd: "status"}
+	d.RegisterCommands(
+		&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }},
+		&Command{
+			Name: "deploy",
+			Exec: func(chain *CallChain, _ []string) error {
+				return chain.Abort(errors.New("nothing to deploy"))
+			},
+		},
+	)
+
+	run := func(line string) string {
+		start := len(w.String())
+		if err := d.Execute(context.Background(), line); err != nil {
+			t.Fatal(err)
+		}
+
+		return w.String()[start:]
+	}
+
+	if out := run("status"); out != "no previous command\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+
+	run("deploy")
+	out := run("status")
+	for _, expected := range []string{"command   deploy\n", "status    1\n", "duration  ", "error     deploy: aborted: nothing to deploy\n"} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("expected %q in output: %q", expected, out)
+		}
+	}
+
+	// the status command doesnt replace the previous result.
+	if again := run("status"); again != out {
+		t.Fatalf("expected the same status, got: %q", again)
+	}
+
+	run("noop")
+	if out := run("status"); !strings.Contains(out, "status    0\n") || strings.Contains(out, "error") {
+		t.Fatalf("unexpected status after success: %q", out)
+	}
+}
@@ -0,0 +1,176 @@
+package dialogue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StateStore persists the user state of a dialogue, such as the recorded macros, across restarts. Keys are namespaced by
+// the feature storing them ("macro/<name>"). Implementations must be safe for concurrent use, back them with a shared
+// database (like Redis) to share the state between multiple instances.
+type StateStore interface {
+	// Get returns the value stored under key, it reports false if there is no such key.
+	Get(ctx context.Context, key string) (string, bool, error)
+
+	// Set stores value under key replacing any previous value.
+	Set(ctx context.Context, key, value string) error
+
+	// Delete removes key, deleting a missing key isnt an error.
+	Delete(ctx context.Context, key string) error
+
+	// List returns the sorted keys starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// MemoryStore is an in memory StateStore, the state is lost when the process exits.
+type MemoryStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// NewMemoryStore creates an empty in memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string]string)}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.values[key]
+	return v, ok, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = value
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.values, key)
+	return nil
+}
+
+func (s *MemoryStore) List(_ context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return listKeys(s.values, prefix), nil
+}
+
+// listKeys returns the sorted keys of values starting with prefix.
+func listKeys(values map[string]string, prefix string) []string {
+	var keys []string
+	for k := range values {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// FileStore is a StateStore backed by a JSON file. The file is read once when the store is opened and rewritten on every
+// change, concurrent processes sharing the file overwrite each others changes.
+type FileStore struct {
+	mu     sync.Mutex
+	path   string
+	values map[string]string
+}
+
+// OpenFileStore opens the store backed by the file at path, a missing file is created on the first change.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, values: make(map[string]string)}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dialogue: store: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &s.values); err != nil {
+		return nil, fmt.Errorf("dialogue: store: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Get(_ context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.values[key]
+	return v, ok, nil
+}
+
+func (s *FileStore) Set(_ context.Context, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = value
+	return s.saveLocked()
+}
+
+func (s *FileStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.values[key]; !ok {
+		return nil
+	}
+
+	delete(s.values, key)
+	return s.saveLocked()
+}
+
+func (s *FileStore) List(_ context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return listKeys(s.values, prefix), nil
+}
+
+// saveLocked writes the values to a temporary file and renames it over the store file so the store file is never left half
+// written.
+func (s *FileStore) saveLocked() error {
+	b, err := json.MarshalIndent(s.values, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("dialogue: store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("dialogue: store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("dialogue: store: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("dialogue: store: %w", err)
+	}
+
+	return nil
+}
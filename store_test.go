@@ -0,0 +1,111 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStateStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	fileStore, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]StateStore{
+		"Memory": NewMemoryStore(),
+		"File":   fileStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			for k, v := range map[string]string{"macro/b": "2", "macro/a": "1", "alias/x": "y"} {
+				if err := store.Set(ctx, k, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if v, ok, err := store.Get(ctx, "macro/a"); err != nil || !ok || v != "1" {
+				t.Fatalf("expected 1 under macro/a, got: %q %v %v", v, ok, err)
+			}
+
+			if err := store.Delete(ctx, "macro/a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Delete(ctx, "missing"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok, _ := store.Get(ctx, "macro/a"); ok {
+				t.Fatal("expected macro/a to be deleted")
+			}
+
+			keys, err := store.List(ctx, "macro/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(keys, []string{"macro/b"}) {
+				t.Fatalf("unexpected keys: %v", keys)
+			}
+		})
+	}
+
+	// the file store survives reopening.
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, _ := reopened.List(ctx, "")
+	if !reflect.DeepEqual(keys, []string{"alias/x", "macro/b"}) {
+		t.Fatalf("unexpected keys after reopening: %v", keys)
+	}
+}
+
+func TestStoreBacksSessionState(t *testing.T) {
+	store := NewMemoryStore()
+	newDialogue := func(input string) *Dialogue {
+		d := &Dialogue{
+			R:        strings.NewReader(input),
+			W:        nopReadWriter{},
+			QuitCmd:  "quit",
+			AliasCmd: "alias",
+			EnvCmd:   "env",
+			Store:    store,
+		}
+		d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+
+		return d
+	}
+
+	d := newDialogue("alias n noop\nenv KEY=value\nquit\n")
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	// the aliases, the variables and the history are loaded by the next dialogue.
+	d = newDialogue("quit\n")
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if line, ok := d.userAlias.get("n"); !ok || line != "noop" {
+		t.Fatalf("expected the alias to be persisted, got: %q %v", line, ok)
+	}
+	if v, ok := d.lookupEnv("KEY"); !ok || v != "value" {
+		t.Fatalf("expected the variable to be persisted, got: %q %v", v, ok)
+	}
+
+	var lines []string
+	for _, e := range d.History() {
+		lines = append(lines, e.Line)
+	}
+	want := []string{"alias n noop", "env KEY=value", "quit", "quit"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("expected history %q, got: %q", want, lines)
+	}
+}
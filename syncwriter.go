@@ -0,0 +1,114 @@
+package dialogue
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// SyncWriter returns a writer which serializes the writes to w, every write is written at once so the lines written by
+// concurrent producers with a single write, as fmt.Fprintln does, never interleave. The dialogue wraps W with it so the
+// output of the schedules and of the signal notices can be written while the prompt is displayed: the prompt line is
+// cleared (or ended if W isnt a terminal), the output is written on its own lines and the prompt is written again after
+// it. The characters typed after the prompt are still read but they arent redrawn. The dialogue redraws the prompt at most
+// once per Dialogue.RedrawInterval, the writer returned by SyncWriter redraws it after every write.
+func SyncWriter(w io.Writer) io.Writer {
+	return &syncWriter{w: w}
+}
+
+// defaultRedrawInterval is the default minimum interval between the redraws of the prompt, see Dialogue.RedrawInterval.
+const defaultRedrawInterval = 50 * time.Millisecond
+
+type syncWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	prompt   string        // prompt is the prompt the reader loop is waiting on, empty if it isnt waiting.
+	shown    bool          // shown reports whether prompt was written.
+	interval time.Duration // interval is the minimum interval between the redraws of prompt, 0 redraws it right away.
+	erased   bool          // erased reports whether prompt was erased by the output and waits to be redrawn.
+	midLine  bool          // midLine reports whether the output written since prompt was erased ends mid line.
+	timer    *time.Timer   // timer redraws prompt, nil if no redraw is pending.
+}
+
+// setPrompt marks prompt as the prompt of the next read, the output written after it redraws it. An empty prompt ends
+// the read.
+func (s *syncWriter) setPrompt(prompt string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.prompt, s.shown, s.erased = prompt, false, false
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.shown {
+		s.shown = s.prompt != "" && string(p) == s.prompt
+		return s.w.Write(p)
+	}
+
+	// the output following the erased prompt coalesces into a single redraw.
+	if !s.erased {
+		if err := s.erasePrompt(); err != nil {
+			return 0, err
+		}
+		s.erased = true
+	}
+
+	n, err := s.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if len(p) > 0 {
+		s.midLine = p[len(p)-1] != '\n'
+	}
+
+	if s.interval <= 0 {
+		return n, s.redrawLocked()
+	}
+
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.interval, s.redraw)
+	}
+
+	return n, nil
+}
+
+// redraw writes the erased prompt again.
+func (s *syncWriter) redraw() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timer = nil
+	s.redrawLocked() // the errors surface on the next write.
+}
+
+func (s *syncWriter) redrawLocked() error {
+	if !s.erased {
+		return nil
+	}
+	s.erased = false
+
+	prompt := s.prompt
+	if s.midLine {
+		prompt = "\n" + prompt
+	}
+
+	_, err := io.WriteString(s.w, prompt)
+	return err
+}
+
+// erasePrompt clears the line of the displayed prompt or ends it if w isnt a terminal.
+func (s *syncWriter) erasePrompt() error {
+	if IsTerminal(s.w) {
+		return ClearLine(s.w)
+	}
+
+	_, err := io.WriteString(s.w, "\n")
+	return err
+}
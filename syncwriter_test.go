@@ -0,0 +1,88 @@
+package dialogue
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyncWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := SyncWriter(&buf)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				fmt.Fprintln(w, strings.Repeat(fmt.Sprint(i), 64))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 800 {
+		t.Fatalf("expected 800 lines, got: %v", len(lines))
+	}
+	for _, line := range lines {
+		if line != strings.Repeat(line[:1], 64) {
+			t.Fatalf("expected the lines not to interleave, got: %q", line)
+		}
+	}
+}
+
+func TestSyncWriterPrompt(t *testing.T) {
+	var buf bytes.Buffer
+	w := SyncWriter(&buf).(*syncWriter)
+
+	// the output written before the prompt isnt redrawn.
+	fmt.Fprint(w, "hi\n")
+	w.setPrompt("> ")
+	fmt.Fprint(w, "> ")
+	fmt.Fprint(w, "tick\n")
+	fmt.Fprint(w, "partial")
+	w.setPrompt("")
+	fmt.Fprint(w, "done\n")
+
+	if expected := "hi\n> \ntick\n> \npartial\n> done\n"; buf.String() != expected {
+		t.Fatalf("expected %q, got: %q", expected, buf.String())
+	}
+}
+
+func TestSyncWriterRedrawInterval(t *testing.T) {
+	var buf syncBuffer
+	w := &syncWriter{w: &buf, interval: 20 * time.Millisecond}
+
+	w.setPrompt("> ")
+	fmt.Fprint(w, "> ")
+	for _, line := range []string{"a\n", "b\n", "c"} {
+		fmt.Fprint(w, line)
+	}
+
+	// the burst of output is written right away, the prompt is redrawn once after it.
+	if expected := "> \na\nb\nc"; buf.String() != expected {
+		t.Fatalf("expected %q, got: %q", expected, buf.String())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for expected := "> \na\nb\nc\n> "; buf.String() != expected; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q, got: %q", expected, buf.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// ending the read cancels the pending redraw.
+	fmt.Fprint(w, "d\n")
+	w.setPrompt("")
+	time.Sleep(40 * time.Millisecond)
+	if expected := "> \na\nb\nc\n> \nd\n"; buf.String() != expected {
+		t.Fatalf("expected %q, got: %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,91 @@
+package dialogue
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// IsTerminal reports whether v, a reader or a writer such as os.Stdin or the output of a command (see OutFromContext), is
+// a terminal. The dialogue uses it for its color, prompt and interactive defaults, use it to make the same decisions.
+func IsTerminal(v any) bool {
+	for unwrapped := false; !unwrapped; {
+		switch w := v.(type) {
+		case *outputCapture:
+			v = w.w
+		case *syncWriter:
+			v = w.w
+		case *flowWriter:
+			v = w.w
+		default:
+			unwrapped = true
+		}
+	}
+
+	f, ok := v.(*os.File)
+	return ok && isatty(f)
+}
+
+// The helpers below write terminal control sequences only when w is a terminal, writers such as pipes, files and
+// transcripts are left untouched. The output of the dialogue passed to the commands (see OutFromContext) is a terminal if
+// W is, the sequences written to it arent part of LastOutputFromContext or of the Transcript.
+
+// ClearScreen clears the terminal w writes to and moves the cursor to the top left corner.
+func ClearScreen(w io.Writer) error {
+	return writeControl(w, "\x1b[H\x1b[2J")
+}
+
+// ClearLine clears the line the cursor is on and moves the cursor to its start, use it to redraw progress lines.
+func ClearLine(w io.Writer) error {
+	return writeControl(w, "\r\x1b[2K")
+}
+
+// MoveCursor moves the cursor dx columns to the right and dy rows down, negative values move it left and up.
+func MoveCursor(w io.Writer, dx, dy int) error {
+	var seq string
+	switch {
+	case dx > 0:
+		seq += fmt.Sprintf("\x1b[%dC", dx)
+	case dx < 0:
+		seq += fmt.Sprintf("\x1b[%dD", -dx)
+	}
+
+	switch {
+	case dy > 0:
+		seq += fmt.Sprintf("\x1b[%dB", dy)
+	case dy < 0:
+		seq += fmt.Sprintf("\x1b[%dA", -dy)
+	}
+
+	return writeControl(w, seq)
+}
+
+// writeControl writes the control sequence seq to w if w is a terminal. The sequences written to the output of the
+// dialogue bypass the last output and the transcript.
+func writeControl(w io.Writer, seq string) error {
+	if seq == "" || !IsTerminal(w) {
+		return nil
+	}
+
+	if c, ok := w.(*outputCapture); ok {
+		return c.control(seq)
+	}
+
+	_, err := io.WriteString(w, seq)
+	return err
+}
+
+func (d *Dialogue) clearCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		HelpShort:    "clears the screen",
+		ValidateArgs: Range(0, 0),
+		Exec: func(_ *CallChain, _ []string) error {
+			if d.Plain {
+				return nil
+			}
+
+			return ClearScreen(d.out)
+		},
+	}
+}
@@ -0,0 +1,53 @@
+package dialogue
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+)
+
+func TestTerminalControlNonTTY(t *testing.T) {
+	var buf bytes.Buffer
+	for _, write := range []func() error{
+		func() error { return ClearScreen(&buf) },
+		func() error { return ClearLine(&buf) },
+		func() error { return MoveCursor(&buf, -2, 3) },
+	} {
+		if err := write(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := &Dialogue{W: &buf, ClearCmd: "clear"}
+	d.RegisterCommands(&Command{Name: "noop", Exec: func(_ *CallChain, _ []string) error { return nil }})
+	if err := d.Execute(context.Background(), "clear"); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 0 {
+		t.Fatalf("expected no control sequences on a non terminal writer, got: %q", buf.String())
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	// the null device is a character device but not a terminal.
+	for _, v := range []any{devNull, r, w, &bytes.Buffer{}, &outputCapture{w: w}, nil} {
+		if IsTerminal(v) {
+			t.Fatalf("expected %T not to be a terminal", v)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package dialogue
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// TermSize is the size of the terminal in character cells.
+type TermSize struct {
+	Width, Height int
+}
+
+type termSizeKey struct{}
+
+// TermSizeFromContext returns the size of the terminal the dialogue writes to at the time the current command was
+// dispatched. It reports false if the size is unknown, such as when W isnt a terminal.
+func TermSizeFromContext(ctx context.Context) (TermSize, bool) {
+	v, ok := ctx.Value(termSizeKey{}).(TermSize)
+	return v, ok && v.Width > 0
+}
+
+// termSize holds the detected terminal size of a dialogue, it is refreshed when the terminal is resized.
+type termSize struct {
+	mu   sync.Mutex
+	size TermSize
+}
+
+func (t *termSize) get() TermSize {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.size
+}
+
+// detect refreshes the size from w if it is a terminal, falling back to the COLUMNS and LINES environment variables.
+func (t *termSize) detect(w any) {
+	size, ok := TermSize{}, false
+	if f, isFile := w.(*os.File); isFile && IsTerminal(f) {
+		size, ok = getTermSize(f)
+	}
+
+	if !ok {
+		size.Width, _ = strconv.Atoi(os.Getenv("COLUMNS"))
+		size.Height, _ = strconv.Atoi(os.Getenv("LINES"))
+	}
+
+	t.mu.Lock()
+	t.size = size
+	t.mu.Unlock()
+}
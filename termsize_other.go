@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package dialogue
+
+import "os"
+
+// getTermSize isnt supported on this platform, the size falls back to the COLUMNS and LINES environment variables.
+func getTermSize(_ *os.File) (TermSize, bool) {
+	return TermSize{}, false
+}
+
+// watchResize is a no-op on this platform.
+func (t *termSize) watchResize(_ any, _ func()) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,58 @@
+package dialogue
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTermSizeFromContext(t *testing.T) {
+	t.Setenv("COLUMNS", "120")
+	t.Setenv("LINES", "40")
+
+	var size TermSize
+	var ok bool
+
+	d := &Dialogue{
+		R:       strings.NewReader("size\nquit\n"),
+		W:       nopReadWriter{},
+		QuitCmd: "quit",
+	}
+	d.RegisterCommands(&Command{
+		Name: "size",
+		Exec: func(chain *CallChain, _ []string) error {
+			size, ok = TermSizeFromContext(chain.GetCurrent().Context())
+			return nil
+		},
+	})
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if !ok || size != (TermSize{120, 40}) {
+		t.Fatalf("expected 120x40 terminal, got: %v %v", size, ok)
+	}
+
+	t.Setenv("COLUMNS", "")
+	d.term.detect(nopReadWriter{})
+	if _, ok := TermSizeFromContext(d.dispatchContext(d.ctx, "", nil)); ok {
+		t.Fatal("expected unknown terminal size")
+	}
+}
+
+func TestHelpFollowsTermSize(t *testing.T) {
+	var term termSize
+	h := commandHelpFormater{term: &term}
+	cmd := &Command{Name: "long", HelpLong: strings.Repeat("word ", 20)}
+	cmd.initFlagSet()
+
+	term.size = TermSize{Width: 30}
+	narrow := h.format(cmd, true)
+	term.size = TermSize{Width: 200}
+	wide := h.format(cmd, true)
+
+	if strings.Count(narrow, "\n") <= strings.Count(wide, "\n") {
+		t.Fatalf("expected the help to be wrapped to the current width, got %q and %q", narrow, wide)
+	}
+}
@@ -0,0 +1,48 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package dialogue
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// getTermSize queries the size of the terminal f.
+func getTermSize(f *os.File) (TermSize, bool) {
+	var ws struct {
+		row, col, xpixel, ypixel uint16
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.col == 0 {
+		return TermSize{}, false
+	}
+
+	return TermSize{Width: int(ws.col), Height: int(ws.row)}, true
+}
+
+// watchResize refreshes t from w and calls onResize on every SIGWINCH until the returned function is called.
+func (t *termSize) watchResize(w any, onResize func()) (stop func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGWINCH)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-c:
+				t.detect(w)
+				onResize()
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
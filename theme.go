@@ -0,0 +1,55 @@
+package dialogue
+
+import (
+	"io"
+	"os"
+)
+
+// Theme styles the output of the default formatters and handlers. Every field holds an ANSI escape sequence (such as
+// "\x1b[1m" for bold) written before the styled text, the text is followed by a reset sequence. Empty fields leave the text
+// unstyled.
+type Theme struct {
+	Heading string // Heading styles the section headings of the help output.
+	Command string // Command styles the command names and structures in the help output.
+	Flag    string // Flag styles the flag names in the help output.
+	Error   string // Error styles the errors and the not found message.
+	Prompt  string // Prompt styles the dialogue prefix.
+	Quoted  string // Quoted styles the quoted strings of highlighted input, see Dialogue.Highlight.
+}
+
+// DefaultTheme is the theme used when W is a terminal and the NO_COLOR environment variable isnt set to a non empty value.
+var DefaultTheme = Theme{
+	Heading: "\x1b[1m",
+	Command: "\x1b[36m",
+	Flag:    "\x1b[33m",
+	Error:   "\x1b[31m",
+	Prompt:  "\x1b[32m",
+	Quoted:  "\x1b[35m",
+}
+
+// NoColorTheme leaves all the output unstyled.
+var NoColorTheme = Theme{}
+
+// style wraps s with the provided style of the theme.
+func (t Theme) style(style, s string) string {
+	if style == "" || s == "" {
+		return s
+	}
+
+	return style + s + "\x1b[0m"
+}
+
+// resolveTheme returns the theme to use for w when no theme was provided: NoColorTheme if NO_COLOR is set and not empty
+// (see no-color.org) or if w isnt a terminal, DefaultTheme otherwise.
+func resolveTheme(w io.Writer) Theme {
+	if noColor() || !IsTerminal(w) {
+		return NoColorTheme
+	}
+
+	return DefaultTheme
+}
+
+// noColor reports whether the NO_COLOR environment variable disables the colors, an empty value doesnt.
+func noColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
@@ -0,0 +1,62 @@
+package dialogue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type timingKey struct{}
+
+// Timing returns a middleware (see Dialogue.Middleware) which measures the execution time of every dispatched command and
+// writes "took 3.2s" to the output of the command when it took threshold or longer. A zero threshold writes the time of
+// every command, a negative one never writes it.
+//
+// report is optional, it is called with the execution time of every command, use it to feed metrics. The time of a call
+// chain is measured once, from its first command, the commands it advances to with a context derived from the context of
+// their invocation arent measured on their own.
+//
+// The time of a command with a RetryPolicy covers all its attempts, the context passed to report carries the number of
+// attempts (see AttemptFromContext) which is also written next to the time when above one.
+func Timing(threshold time.Duration, report func(ctx context.Context, cmd string, took time.Duration)) func(next StepFunc) StepFunc {
+	return func(next StepFunc) StepFunc {
+		return func(chain *CallChain, args []string) error {
+			inv := chain.GetCurrent()
+			ctx := inv.Context()
+			if ctx.Value(timingKey{}) != nil {
+				return next(chain, args)
+			}
+			inv.ctx = context.WithValue(ctx, timingKey{}, true)
+
+			start := time.Now()
+			err := next(chain, args)
+			took := time.Since(start)
+
+			attempts := AttemptFromContext(inv.Context())
+			if report != nil {
+				report(context.WithValue(ctx, attemptKey{}, attempts), inv.Name, took)
+			}
+
+			if threshold >= 0 && took >= threshold {
+				if w, ok := OutFromContext(ctx); ok {
+					if attempts > 1 {
+						fmt.Fprintf(w, "took %v (%d attempts)\n", roundDuration(took), attempts)
+					} else {
+						fmt.Fprintf(w, "took %v\n", roundDuration(took))
+					}
+				}
+			}
+
+			return err
+		}
+	}
+}
+
+// roundDuration rounds d for display: to a tenth of a second from one second on, to the millisecond below.
+func roundDuration(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(100 * time.Millisecond)
+	}
+
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,44 @@
+package dialogue
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTiming(t *testing.T) {
+	var buf bytes.Buffer
+	var reported []string
+	report := func(_ context.Context, cmd string, took time.Duration) {
+		reported = append(reported, cmd)
+	}
+
+	d := &Dialogue{W: &buf, Middleware: []func(StepFunc) StepFunc{Timing(20*time.Millisecond, report)}}
+	sub := &Command{
+		Name: "slow",
+		Exec: func(chain *CallChain, _ []string) error {
+			time.Sleep(30 * time.Millisecond)
+			return chain.AdvanceExec(1, chain.GetCurrent().Context())
+		},
+	}
+	d.RegisterCommands(
+		&Command{Name: "net", SubCommands: []*Command{sub}, Exec: func(_ *CallChain, _ []string) error { return nil }},
+		&Command{Name: "fast", Exec: func(_ *CallChain, _ []string) error { return nil }},
+	)
+
+	for _, line := range []string{"net slow", "fast"} {
+		if err := d.Execute(context.Background(), line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if out := buf.String(); strings.Count(out, "took ") != 1 || !strings.HasPrefix(out, "took ") {
+		t.Fatalf("expected a single timing line, got: %q", out)
+	}
+
+	if strings.Join(reported, " ") != "slow fast" {
+		t.Fatalf("expected the call chains to be reported once, got: %v", reported)
+	}
+}
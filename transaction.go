@@ -0,0 +1,178 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// transaction queues the commands dispatched between begin and commit.
+type transaction struct {
+	entries []txEntry
+}
+
+// txEntry is a queued command, the command is parsed again at commit since the flag sets are shared between invocations.
+type txEntry struct {
+	line   string
+	fields []string
+}
+
+// queue checks cmd, the command named by fields[0], like a normal dispatch would and queues it.
+func (tx *transaction) queue(d *Dialogue, ctx context.Context, cmd *Command, line string, fields []string) error {
+	cmdCtx, err := d.commandContext(ctx, cmd.Name)
+	if err != nil {
+		return err
+	}
+
+	callChain, err := d.prepare(cmdCtx, cmd.Name, cmd, fields[1:], true)
+	if callChain == nil || err != nil {
+		return err
+	}
+	callChain.clean()
+
+	// the fields of the line are recycled once it is dispatched.
+	tx.entries = append(tx.entries, txEntry{line, append([]string(nil), fields...)})
+	return nil
+}
+
+// commit executes the queued commands in order. If any command fails the commands executed before it are reverted and the
+// error is returned along with any rollback errors. The errors which end the session, such as an ExitError, are returned as
+// is without reverting anything, see endsSession.
+func (tx *transaction) commit(d *Dialogue) error {
+	var groups []undoGroup
+	for _, e := range tx.entries {
+		group, err := tx.exec(d, e)
+		if endsSession(err) {
+			for _, group := range groups {
+				d.undo.push(group)
+			}
+
+			return err
+		}
+		if err != nil {
+			if rbErr := tx.rollback(d, groups); rbErr != nil {
+				return fmt.Errorf("%v: %w (%v)", e.fields[0], err, rbErr)
+			}
+
+			return fmt.Errorf("%v: %w", e.fields[0], err)
+		}
+
+		groups = append(groups, group)
+	}
+
+	for _, group := range groups {
+		d.undo.push(group)
+	}
+
+	return nil
+}
+
+// endsSession reports whether err ends the session, like the errors of Exit and of the quit command.
+func endsSession(err error) bool {
+	return errors.Is(err, ErrDialogueClosed) || errors.As(err, &ErrTerminatedByCommand{})
+}
+
+// exec executes a single queued command.
+func (tx *transaction) exec(d *Dialogue, e txEntry) (undoGroup, error) {
+	cmd, _, err := d.lookup(e.fields[0])
+	if err != nil {
+		return nil, err
+	}
+	ctx := d.dispatchContext(d.ctx, e.line, cmd)
+
+	cmdCtx, err := d.commandContext(ctx, cmd.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// the command was confirmed when queued.
+	callChain, err := d.prepare(cmdCtx, cmd.Name, cmd, e.fields[1:], false)
+	if err != nil {
+		return nil, err
+	}
+	if callChain == nil {
+		return nil, errors.New("command no longer valid")
+	}
+
+	chain := *callChain
+	defer chain.clean()
+
+	if err := callChain.run(cmdCtx, d.execOrder(cmd)); err != nil {
+		return nil, err
+	}
+
+	return newUndoGroup(chain), nil
+}
+
+// rollback reverts groups in the opposite order of execution.
+func (tx *transaction) rollback(d *Dialogue, groups []undoGroup) error {
+	var errs []string
+	for i := len(groups) - 1; i >= 0; i-- {
+		if err := groups[i].undo(d.ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("rollback: %v", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (d *Dialogue) beginCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		HelpShort:    "starts a transaction, the following commands are queued until commit or abort",
+		ValidateArgs: Range(0, 0),
+		Exec: func(chain *CallChain, _ []string) error {
+			if d.tx != nil {
+				return d.reportError(chain.GetCurrent().Context(), name, errors.New("transaction already in progress"))
+			}
+
+			d.tx = &transaction{}
+			return nil
+		},
+	}
+}
+
+func (d *Dialogue) commitCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		HelpShort:    "executes the commands queued by the current transaction",
+		ValidateArgs: Range(0, 0),
+		Exec: func(chain *CallChain, _ []string) error {
+			ctx := chain.GetCurrent().Context()
+			tx := d.tx
+			if tx == nil {
+				return d.reportError(ctx, name, errors.New("no transaction in progress"))
+			}
+			d.tx = nil
+
+			if err := tx.commit(d); endsSession(err) {
+				return err
+			} else if err != nil {
+				return d.reportError(ctx, name, fmt.Errorf("transaction rolled back: %w", err))
+			}
+
+			return nil
+		},
+	}
+}
+
+func (d *Dialogue) abortCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		HelpShort:    "discards the commands queued by the current transaction",
+		ValidateArgs: Range(0, 0),
+		Exec: func(chain *CallChain, _ []string) error {
+			if d.tx == nil {
+				return d.reportError(chain.GetCurrent().Context(), name, errors.New("no transaction in progress"))
+			}
+
+			d.tx = nil
+			return nil
+		},
+	}
+}
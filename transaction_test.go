@@ -0,0 +1,125 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	w := newWriteExpected(t, []byte(""+
+		"add: expected 1 arguments but got 0\n"+
+		"[a b]\n"+
+		"transaction rolled back: fail: boom\n"+
+		"[a b]\n"+
+		"[a b]\n"+
+		"no transaction in progress\n",
+	))
+
+	var values []string
+	d := &Dialogue{
+		R: strings.NewReader("" +
+			"begin\nadd a\nadd\nadd b\ncommit\nshow\n" +
+			"begin\nadd c\nfail\nadd d\ncommit\nshow\n" +
+			"begin\nadd e\nabort\nshow\n" +
+			"commit\nquit\n",
+		),
+		W:         w,
+		QuitCmd:   "quit",
+		BeginCmd:  "begin",
+		CommitCmd: "commit",
+		AbortCmd:  "abort",
+	}
+	d.RegisterCommands(
+		&Command{
+			Name:         "add",
+			ValidateArgs: Range(1, 1),
+			Exec: func(_ *CallChain, args []string) error {
+				values = append(values, args[0])
+				return nil
+			},
+			Undo: func(_ context.Context, _ []string) error {
+				values = values[:len(values)-1]
+				return nil
+			},
+		},
+		&Command{
+			Name: "fail",
+			Exec: func(_ *CallChain, _ []string) error {
+				return errors.New("boom")
+			},
+		},
+		&Command{
+			Name: "show",
+			Exec: func(_ *CallChain, _ []string) error {
+				_, err := fmt.Fprintln(w, values)
+				return err
+			},
+		},
+	)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionNestedAndFatal(t *testing.T) {
+	w := newWriteExpected(t, []byte("[x x]\nbye\n"))
+
+	var values []string
+	d := &Dialogue{
+		R:         strings.NewReader("begin\nrepeat 2 add x\nabort\nshow\nbegin\nadd a\nbye\nadd b\ncommit\n"),
+		W:         w,
+		BeginCmd:  "begin",
+		CommitCmd: "commit",
+		AbortCmd:  "abort",
+		RepeatCmd: "repeat",
+	}
+	d.RegisterCommands(
+		&Command{
+			Name: "add",
+			Exec: func(_ *CallChain, args []string) error {
+				values = append(values, args[0])
+				return nil
+			},
+			Undo: func(_ context.Context, _ []string) error {
+				values = values[:len(values)-1]
+				return nil
+			},
+		},
+		&Command{
+			Name: "bye",
+			Exec: func(_ *CallChain, _ []string) error {
+				return Exit(3, "bye")
+			},
+		},
+		&Command{
+			Name: "show",
+			Exec: func(_ *CallChain, _ []string) error {
+				_, err := fmt.Fprintln(w, values)
+				return err
+			},
+		},
+	)
+
+	// the lines dispatched by repeat run right away and exiting from the transaction ends the session.
+	if err := d.Open(); !errors.As(err, &ErrTerminatedByCommand{}) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"x", "x", "a"}; fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v but got %v", expected, values)
+	}
+	if status := d.ExitStatus(); status != 3 {
+		t.Fatalf("expected exit status 3, got: %v", status)
+	}
+}
@@ -0,0 +1,84 @@
+package dialogue
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// transcriptTimeFormat is the format of the timestamps of the transcript records.
+const transcriptTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// transcript writes the records of a session to Transcript, one timestamped line per prompt, input line and output line:
+//
+//	2024-01-02T15:04:05.000Z prompt: app>
+//	2024-01-02T15:04:06.120Z input: echo hi
+//	2024-01-02T15:04:06.121Z output: hi
+type transcript struct {
+	mu      sync.Mutex
+	w       io.Writer
+	partial []byte // partial holds the output written since the last line ending.
+	prompt  []byte // prompt is the rendered prompt, it is dropped from the output since it is recorded on its own.
+}
+
+// record writes a record of kind, the pending output is written first.
+func (t *transcript) record(kind, text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.flushLocked()
+	t.prompt = nil
+	t.writeLocked(kind, text)
+}
+
+// recordPrompt records the prompt prefix, rendered is dropped from the output when the line reader writes it.
+func (t *transcript) recordPrompt(prefix, rendered string) {
+	t.record("prompt", prefix)
+
+	t.mu.Lock()
+	t.prompt = []byte(rendered)
+	t.mu.Unlock()
+}
+
+// output records the complete lines of p, the last line is kept until it ends or the next record.
+func (t *transcript) output(p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.prompt) > 0 && bytes.HasPrefix(p, t.prompt) {
+		p = p[len(t.prompt):]
+		t.prompt = nil
+	}
+
+	t.partial = append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			return
+		}
+
+		t.writeLocked("output", string(t.partial[:i]))
+		t.partial = t.partial[:copy(t.partial, t.partial[i+1:])]
+	}
+}
+
+// flush writes the pending output.
+func (t *transcript) flush() {
+	t.mu.Lock()
+	t.flushLocked()
+	t.mu.Unlock()
+}
+
+func (t *transcript) flushLocked() {
+	if len(t.partial) > 0 {
+		t.writeLocked("output", string(t.partial))
+		t.partial = t.partial[:0]
+	}
+}
+
+// writeLocked writes a record, the errors are dropped so a failing transcript doesnt disrupt the session.
+func (t *transcript) writeLocked(kind, text string) {
+	fmt.Fprintf(t.w, "%v %v: %v\n", time.Now().Format(transcriptTimeFormat), kind, text)
+}
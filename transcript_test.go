@@ -0,0 +1,67 @@
+package dialogue
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscript(t *testing.T) {
+	var tr bytes.Buffer
+	interactive := true
+	d := &Dialogue{
+		Prefix:      "$ ",
+		R:           strings.NewReader("echo hi\npart\n"),
+		W:           nopReadWriter{},
+		Transcript:  &tr,
+		Interactive: &interactive,
+		FormatHelp:  func(string, map[string]*Command) string { return "" },
+	}
+	d.RegisterCommands(
+		&Command{
+			Name: "echo",
+			Exec: func(chain *CallChain, args []string) error {
+				out, _ := OutFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprintln(out, strings.Join(args, " "))
+				return err
+			},
+		},
+		&Command{
+			Name: "part",
+			Exec: func(chain *CallChain, args []string) error {
+				out, _ := OutFromContext(chain.GetCurrent().Context())
+				_, err := fmt.Fprint(out, "no newline")
+				return err
+			},
+		},
+	)
+
+	if err := d.Open(); err != ErrEOF {
+		t.Fatalf("expected %v, got: %v", ErrEOF, err)
+	}
+
+	expected := []string{
+		"prompt: $ ",
+		"input: echo hi",
+		"output: hi",
+		"prompt: $ ",
+		"input: part",
+		"output: no newline",
+		"prompt: $ ",
+	}
+	lines := strings.Split(strings.TrimSuffix(tr.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %v records, got: %q", len(expected), lines)
+	}
+	for i, line := range lines {
+		stamp, record, _ := strings.Cut(line, " ")
+		if _, err := time.Parse(transcriptTimeFormat, stamp); err != nil {
+			t.Fatalf("record %v: %v", i, err)
+		}
+		if record != expected[i] {
+			t.Fatalf("record %v: expected %q, got: %q", i, expected[i], record)
+		}
+	}
+}
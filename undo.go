@@ -0,0 +1,108 @@
+package dialogue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// undoEntry records an execution of a command which can be undone.
+type undoEntry struct {
+	cmd  *Command
+	args []string
+}
+
+// undoGroup holds the entries of a single dispatch in the order they executed.
+type undoGroup []undoEntry
+
+// undoStack holds the undoable executions of the current session, every dispatch pushes a group of entries which are
+// undone together.
+type undoStack struct {
+	mu     sync.Mutex
+	groups []undoGroup
+}
+
+// newUndoGroup records the executed invocations of chain which have an Undo function in the order they executed, the leaf
+// executes first by default and the root first with ExecRootFirst.
+func newUndoGroup(chain CallChain) undoGroup {
+	executed := []*Invocation(chain)
+	if len(chain) > 0 && chain[0].ran != nil {
+		executed = *chain[0].ran
+	}
+
+	var group undoGroup
+	for _, inv := range executed {
+		if inv.Undo == nil || !inv.executed {
+			continue
+		}
+
+		// Exec can modify the args in place.
+		group = append(group, undoEntry{inv.Command, append([]string(nil), inv.args...)})
+	}
+
+	return group
+}
+
+// push records group on the stack, empty groups are ignored.
+func (s *undoStack) push(group undoGroup) {
+	if len(group) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	s.groups = append(s.groups, group)
+	s.mu.Unlock()
+}
+
+// pop removes the last group of entries, it returns nil if the stack is empty.
+func (s *undoStack) pop() undoGroup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.groups) == 0 {
+		return nil
+	}
+
+	group := s.groups[len(s.groups)-1]
+	s.groups = s.groups[:len(s.groups)-1]
+	return group
+}
+
+func (s *undoStack) reset() {
+	s.mu.Lock()
+	s.groups = nil
+	s.mu.Unlock()
+}
+
+// undo reverts the group in the opposite order of execution so the changes depending on each other are unwound last in,
+// first out.
+func (g undoGroup) undo(ctx context.Context) error {
+	for i := len(g) - 1; i >= 0; i-- {
+		if err := g[i].cmd.Undo(ctx, g[i].args); err != nil {
+			return fmt.Errorf("%v: %w", g[i].cmd.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Dialogue) undoCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		HelpShort:    "reverts the last command which can be undone",
+		ValidateArgs: Range(0, 0),
+		Exec: func(chain *CallChain, _ []string) error {
+			group := d.undo.pop()
+			if group == nil {
+				return d.renderer.PrintLine("nothing to undo")
+			}
+
+			ctx := chain.GetCurrent().Context()
+			if err := group.undo(ctx); err != nil {
+				return d.reportError(ctx, name, err)
+			}
+
+			return nil
+		},
+	}
+}
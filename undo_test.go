@@ -0,0 +1,96 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	w := newWriteExpected(t, []byte("[a b]\n[a]\n[a d c]\n[a]\n[]\nnothing to undo\n"))
+
+	var values []string
+	show := &Command{
+		Name: "show",
+		Exec: func(_ *CallChain, _ []string) error {
+			_, err := fmt.Fprintln(w, values)
+			return err
+		},
+	}
+	add := &Command{
+		Name: "add",
+		Exec: func(chain *CallChain, args []string) error {
+			values = append(values, args...)
+
+			if next := chain.Next(chain.GetCurrent().Context()); next != nil {
+				return chain.AdvanceExec(1, next.Context())
+			}
+
+			return nil
+		},
+		Undo: func(_ context.Context, args []string) error {
+			values = values[:len(values)-len(args)]
+			return nil
+		},
+	}
+	add.SubCommands = []*Command{add}
+
+	d := &Dialogue{
+		R:       strings.NewReader("add a\nadd b\nshow\nundo\nshow\nadd c add d\nshow\nundo\nshow\nundo\nshow\nundo\nquit\n"),
+		W:       w,
+		QuitCmd: "quit",
+		UndoCmd: "undo",
+	}
+	d.RegisterCommands(add, show)
+
+	if err := d.Open(); !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUndoRootFirst(t *testing.T) {
+	var values []string
+	push := &Command{
+		Name: "push",
+		Exec: func(_ *CallChain, args []string) error {
+			values = append(values, args...)
+			return nil
+		},
+		Undo: func(_ context.Context, args []string) error {
+			// the changes are unwound last in, first out.
+			if top := values[len(values)-1]; top != args[0] {
+				return fmt.Errorf("expected to undo %v first, got: %v", top, args[0])
+			}
+			values = values[:len(values)-1]
+			return nil
+		},
+	}
+	push.SubCommands = []*Command{push}
+
+	var undoErr error
+	d := &Dialogue{
+		W:         nopReadWriter{},
+		UndoCmd:   "undo",
+		ExecOrder: ExecRootFirst,
+		OnError: func(_ context.Context, _ string, err error) {
+			undoErr = err
+		},
+	}
+	d.RegisterCommands(push)
+
+	for _, line := range []string{"push a push b push c", "undo"} {
+		if err := d.Execute(context.Background(), line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if undoErr != nil || len(values) != 0 {
+		t.Fatalf("expected every push to be undone, got: %v %v", values, undoErr)
+	}
+}
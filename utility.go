@@ -0,0 +1,156 @@
+package dialogue
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (d *Dialogue) sleepCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		Structure:    name + " <duration>",
+		HelpShort:    "waits for the duration, such as 2s or 1m30s",
+		ValidateArgs: Range(1, 1),
+		Exec: func(chain *CallChain, args []string) error {
+			ctx := chain.GetCurrent().Context()
+			dur, err := time.ParseDuration(args[0])
+			if err != nil {
+				return d.reportError(ctx, name, fmt.Errorf("invalid duration %v", args[0]))
+			}
+
+			timer := time.NewTimer(dur)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+
+			return nil
+		},
+	}
+}
+
+func (d *Dialogue) waitForCommand(name string) *Command {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(d.eout)
+	timeout := fs.Duration("timeout", 30*time.Second, "specifies how long to wait for the command to succeed")
+	interval := fs.Duration("interval", time.Second, "specifies the interval between runs")
+
+	return &Command{
+		Name:      name,
+		Structure: fmt.Sprintf("%v [-timeout 30s] [-interval 1s] <command-line>", name),
+		HelpShort: "runs a command line until it succeeds",
+		HelpLong: `wait-for runs the command line every -interval until it doesnt report an error, an error is reported if it
+didnt succeed within -timeout.`,
+		FlagSet:      fs,
+		ValidateArgs: Range(1, -1),
+		Exec: func(chain *CallChain, args []string) error {
+			ctx := chain.GetCurrent().Context()
+			if *timeout <= 0 || *interval <= 0 {
+				return d.reportError(ctx, name, fmt.Errorf("invalid timeout %v or interval %v, expected positive durations", *timeout, *interval))
+			}
+			line := strings.Join(args, " ")
+
+			ctx, cancel := context.WithTimeout(ctx, *timeout)
+			defer cancel()
+
+			ticker := time.NewTicker(*interval)
+			defer ticker.Stop()
+
+			for {
+				failed, err := d.dispatchResult(ctx, line, args)
+				if err != nil || failed == nil {
+					return err
+				}
+
+				select {
+				case <-ctx.Done():
+					return d.reportError(ctx, name, fmt.Errorf("%v didnt succeed within %v: %w", line, *timeout, failed))
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+}
+
+func (d *Dialogue) repeatCommand(name string) *Command {
+	return &Command{
+		Name:         name,
+		Structure:    name + " <count> <command-line>",
+		HelpShort:    "runs a command line count times",
+		ValidateArgs: Range(2, -1),
+		Exec: func(chain *CallChain, args []string) error {
+			ctx := chain.GetCurrent().Context()
+			count, err := strconv.Atoi(args[0])
+			if err != nil || count < 0 {
+				return d.reportError(ctx, name, fmt.Errorf("invalid count %v, expected a positive number", args[0]))
+			}
+			line := strings.Join(args[1:], " ")
+
+			for i := 0; i < count && ctx.Err() == nil; i++ {
+				if err := d.dispatchHandler(ctx, line, args[1:]); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func (d *Dialogue) envCommand(name string) *Command {
+	return &Command{
+		Name:      name,
+		Structure: fmt.Sprintf("%v [<key>[=<value>]]...", name),
+		HelpShort: "shows or sets the environment variables of the session",
+		HelpLong: `env lists the variables set in the session when ran without arguments, "env KEY" shows a single variable and
+"env KEY=VALUE" sets it for the commands dispatched after it, including their flags bound with Command.EnvPrefix. The
+variables are set for the session only, the process environment isnt changed and is only shown for the named keys.`,
+		Exec: func(chain *CallChain, args []string) error {
+			ctx := chain.GetCurrent().Context()
+			if len(args) == 0 {
+				return d.renderer.Table(d.userEnv.rows())
+			}
+
+			for _, arg := range args {
+				key, value, ok := strings.Cut(arg, "=")
+				if key == "" {
+					return d.reportError(ctx, name, fmt.Errorf("invalid variable %q, expected a key", arg))
+				}
+
+				if ok {
+					if err := d.userEnv.set(ctx, key, value); err != nil {
+						return d.reportError(ctx, name, fmt.Errorf("saving %v: %w", key, err))
+					}
+					continue
+				}
+
+				value, ok = d.lookupEnv(key)
+				if !ok {
+					return d.reportError(ctx, name, fmt.Errorf("%v isnt set", key))
+				}
+
+				if err := d.renderer.PrintLine(value); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+// lookupEnv looks key up in the variables set with EnvCmd and then in the environment of the process.
+func (d *Dialogue) lookupEnv(key string) (string, bool) {
+	if value, ok := d.userEnv.get(key); ok {
+		return value, true
+	}
+
+	return os.LookupEnv(key)
+}
@@ -0,0 +1,113 @@
+package dialogue
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUtilityCommands(t *testing.T) {
+	var runs int
+	var hookErr error
+	d := &Dialogue{
+		W:          nopReadWriter{},
+		SleepCmd:   "sleep",
+		WaitForCmd: "wait-for",
+		RepeatCmd:  "repeat",
+		OnError: func(_ context.Context, _ string, err error) {
+			hookErr = err
+		},
+	}
+	d.RegisterCommands(&Command{
+		Name: "flaky",
+		Exec: func(chain *CallChain, _ []string) error {
+			runs++
+			if runs < 3 {
+				return chain.Abort(errors.New("not ready"))
+			}
+
+			return nil
+		},
+	})
+
+	start := time.Now()
+	if err := d.Execute(context.Background(), "sleep 50ms"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected to sleep 50ms, slept %v", elapsed)
+	}
+
+	if err := d.Execute(context.Background(), "wait-for -interval 10ms flaky"); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 3 {
+		t.Fatalf("expected 3 runs until success, got %v", runs)
+	}
+
+	runs = 0
+	if err := d.Execute(context.Background(), "repeat 2 flaky"); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 2 {
+		t.Fatalf("expected 2 runs, got %v", runs)
+	}
+
+	runs, hookErr = -100, nil
+	if err := d.Execute(context.Background(), "wait-for -timeout 30ms -interval 10ms flaky"); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.As(hookErr, &ErrAborted{}) {
+		t.Fatalf("expected the timeout to report the last error, got: %v", hookErr)
+	}
+}
+
+func TestEnvCommand(t *testing.T) {
+	const key = "DIALOGUE_TEST_ENV_N"
+	os.Unsetenv(key)
+
+	var hookErr error
+	var got int
+	w := newWriteExpected(t, []byte("DIALOGUE_TEST_ENV_N  3\n3\ninvalid variable \"=3\", expected a key\n"))
+	d := &Dialogue{
+		W:      w,
+		EnvCmd: "env",
+		OnError: func(_ context.Context, _ string, err error) {
+			hookErr = err
+		},
+	}
+
+	fs := flag.NewFlagSet("count", flag.ContinueOnError)
+	n := fs.Int("n", 1, "")
+	d.RegisterCommands(&Command{
+		Name:      "count",
+		EnvPrefix: "DIALOGUE_TEST_ENV_",
+		FlagSet:   fs,
+		Exec: func(_ *CallChain, _ []string) error {
+			got = *n
+			return nil
+		},
+	})
+
+	for _, line := range []string{"env " + key + "=3", "env", "env " + key, "count", "env =3"} {
+		if err := d.Execute(context.Background(), line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got != 3 {
+		t.Fatalf("expected the session variable to set the flag, got: %v", got)
+	}
+	if _, ok := os.LookupEnv(key); ok {
+		t.Fatal("expected the process environment to stay untouched")
+	}
+	if hookErr == nil {
+		t.Fatal("expected an invalid variable to be reported")
+	}
+}
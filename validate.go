@@ -0,0 +1,77 @@
+package dialogue
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ArgsValidator checks the positional arguments of a command and returns a non nil error describing why the arguments
+// are invalid.
+type ArgsValidator func(args []string) error
+
+// Validate runs args through the provided validators in order and returns the first error encountered. It is intended to be
+// used inside Command.ValidateArgs:
+//
+//	ValidateArgs: func(args []string) error {
+//		return dialogue.Validate(args, dialogue.Range(1, 3), dialogue.OneOf("start", "stop"))
+//	}
+func Validate(args []string, validators ...ArgsValidator) error {
+	for _, v := range validators {
+		if err := v(args); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Range validates that the number of arguments is between min and max (inclusive). A negative max means there is no upper
+// bound on the number of arguments.
+func Range(min, max int) ArgsValidator {
+	return func(args []string) error {
+		n := len(args)
+
+		switch {
+		case max < 0 && n < min:
+			return fmt.Errorf("expected at least %d arguments but got %d", min, n)
+		case max >= 0 && min == max && n != min:
+			return fmt.Errorf("expected %d arguments but got %d", min, n)
+		case max >= 0 && (n < min || n > max):
+			return fmt.Errorf("expected between %d and %d arguments but got %d", min, max, n)
+		}
+
+		return nil
+	}
+}
+
+// Match validates that every argument matches the regular expression re.
+func Match(re *regexp.Regexp) ArgsValidator {
+	return func(args []string) error {
+		for _, arg := range args {
+			if !re.MatchString(arg) {
+				return fmt.Errorf("argument %q doesnt match %v", arg, re)
+			}
+		}
+
+		return nil
+	}
+}
+
+// OneOf validates that every argument is one of the provided values.
+func OneOf(values ...string) ArgsValidator {
+	return func(args []string) error {
+	outer:
+		for _, arg := range args {
+			for _, v := range values {
+				if arg == v {
+					continue outer
+				}
+			}
+
+			return fmt.Errorf("argument %q must be one of: %v", arg, strings.Join(values, ", "))
+		}
+
+		return nil
+	}
+}
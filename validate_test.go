@@ -0,0 +1,37 @@
+package dialogue
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	type testCase struct {
+		args       []string
+		validators []ArgsValidator
+		ok         bool
+	}
+
+	testCases := []testCase{
+		{[]string{"a"}, []ArgsValidator{Range(1, 1)}, true},
+		{[]string{}, []ArgsValidator{Range(1, 3)}, false},
+		{[]string{"a", "b", "c", "d"}, []ArgsValidator{Range(1, 3)}, false},
+		{[]string{"a", "b", "c", "d"}, []ArgsValidator{Range(1, -1)}, true},
+		{[]string{"12", "34"}, []ArgsValidator{Match(regexp.MustCompile(`^\d+$`))}, true},
+		{[]string{"12", "x4"}, []ArgsValidator{Match(regexp.MustCompile(`^\d+$`))}, false},
+		{[]string{"json"}, []ArgsValidator{Range(1, 1), OneOf("json", "table")}, true},
+		{[]string{"yaml"}, []ArgsValidator{Range(1, 1), OneOf("json", "table")}, false},
+		{[]string{"json", "table"}, []ArgsValidator{Range(1, 1), OneOf("json", "table")}, false},
+	}
+
+	for _, tc := range testCases {
+		err := Validate(tc.args, tc.validators...)
+		if tc.ok && err != nil {
+			t.Fatalf("expected args %v to be valid but got: %v", tc.args, err)
+		}
+
+		if !tc.ok && err == nil {
+			t.Fatalf("expected args %v to be invalid", tc.args)
+		}
+	}
+}
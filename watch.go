@@ -0,0 +1,85 @@
+package dialogue
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (d *Dialogue) watchCommand(name string) *Command {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(d.eout)
+	seconds := fs.Float64("n", 2, "specifies the interval between runs in seconds")
+
+	return &Command{
+		Name:      name,
+		Structure: fmt.Sprintf("%v [-n seconds] <command-line>", name),
+		HelpShort: "runs a command line repeatedly until a key is pressed",
+		HelpLong: `watch runs the command line every -n seconds redrawing its output, the screen is cleared between runs when the
+dialogue writes to a terminal. Watching stops on the next key read, the input is discarded. Terminals which arent in raw
+mode only send the keys once enter is pressed, with a custom line reader watching stops on the next line.`,
+		FlagSet:      fs,
+		ValidateArgs: Range(1, -1),
+		Exec: func(chain *CallChain, args []string) error {
+			ctx := chain.GetCurrent().Context()
+			if *seconds <= 0 {
+				return d.reportError(ctx, name, fmt.Errorf("invalid interval %v, expected a positive number of seconds", *seconds))
+			}
+			interval := time.Duration(*seconds * float64(time.Second))
+			line := strings.Join(args, " ")
+			redraw := IsTerminal(d.W) && !d.Plain
+
+			// the line reader is owned by the reader loop which is blocked on this dispatch, wait for the read to finish
+			// before giving it back.
+			reader, ok := ctx.Value(lineReaderKey{}).(LineReader)
+			if !ok {
+				return ErrNoInput
+			}
+			// the wait is cancelled once watching stops so an interrupt doesnt wait for one more key.
+			waitCtx, cancelWait := context.WithCancel(ctx)
+			stop := make(chan struct{})
+			go func() {
+				if kw, ok := reader.(keyWaiter); ok {
+					kw.waitKey(waitCtx)
+				} else {
+					reader.ReadLine(waitCtx, "")
+				}
+				close(stop)
+			}()
+			defer func() {
+				cancelWait()
+				<-stop
+			}()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				if redraw {
+					if err := ClearScreen(d.out); err != nil {
+						return err
+					}
+				}
+
+				header := fmt.Sprintf("Every %v: %v (press any key to stop)", interval, line)
+				if err := d.renderer.PrintLine(d.theme.style(d.theme.Heading, header)); err != nil {
+					return err
+				}
+
+				if err := d.dispatchHandler(ctx, line, args); err != nil {
+					return err
+				}
+
+				select {
+				case <-stop:
+					return nil
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+}
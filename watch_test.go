@@ -0,0 +1,151 @@
+package dialogue
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	r, pw := io.Pipe()
+	w := &syncBuffer{}
+	ticks := make(chan []string, 16)
+
+	d := &Dialogue{
+		R:        r,
+		W:        w,
+		QuitCmd:  "quit",
+		WatchCmd: "watch",
+	}
+	d.RegisterCommands(&Command{
+		Name: "tick",
+		Exec: func(_ *CallChain, args []string) error {
+			ticks <- append([]string(nil), args...)
+			return nil
+		},
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- d.Open() }()
+
+	io.WriteString(pw, "watch -n 0.005 tick a b\n")
+	for i := 0; i < 3; i++ {
+		if args := <-ticks; strings.Join(args, " ") != "a b" {
+			t.Fatalf("expected args [a b], got: %v", args)
+		}
+	}
+	// any key stops the watch, not only a whole line.
+	io.WriteString(pw, "q")
+	io.WriteString(pw, "tick c\n")
+
+	// the watch stopped and the reader loop took over.
+	for args := range ticks {
+		if strings.Join(args, " ") == "c" {
+			break
+		}
+	}
+	io.WriteString(pw, "quit\n")
+
+	if err := <-errs; !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+
+	if out := w.String(); !strings.Contains(out, "Every 5ms: tick a b (press any key to stop)\n") {
+		t.Fatalf("expected watch header, got: %q", out)
+	}
+}
+
+func TestWatchTransaction(t *testing.T) {
+	r, pw := io.Pipe()
+	ticks := make(chan struct{}, 16)
+
+	d := &Dialogue{R: r, W: &syncBuffer{}, QuitCmd: "quit", WatchCmd: "watch", BeginCmd: "begin"}
+	d.RegisterCommands(&Command{
+		Name: "tick",
+		Exec: func(_ *CallChain, _ []string) error {
+			ticks <- struct{}{}
+			return nil
+		},
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- d.Open() }()
+
+	// the ticks of the watch run inside the transaction instead of being queued.
+	io.WriteString(pw, "begin\nwatch -n 0.005 tick\n")
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ticks:
+		case <-time.After(time.Second):
+			t.Fatal("expected the watch to run the command line")
+		}
+	}
+	io.WriteString(pw, "q")
+	io.WriteString(pw, "quit\n")
+
+	if err := <-errs; !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+}
+
+func TestWatchInterrupt(t *testing.T) {
+	r, pw := io.Pipe()
+	ticks := make(chan []string, 16)
+	returned := make(chan struct{})
+
+	d := &Dialogue{
+		R:             r,
+		W:             &syncBuffer{},
+		QuitCmd:       "quit",
+		WatchCmd:      "watch",
+		HandleSignals: true,
+		Middleware: []func(next StepFunc) StepFunc{
+			func(next StepFunc) StepFunc {
+				return func(chain *CallChain, args []string) error {
+					err := next(chain, args)
+					if chain.GetCurrent().Name == "watch" {
+						close(returned)
+					}
+					return err
+				}
+			},
+		},
+	}
+	d.RegisterCommands(&Command{
+		Name: "tick",
+		Exec: func(_ *CallChain, args []string) error {
+			ticks <- append([]string(nil), args...)
+			return nil
+		},
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- d.Open() }()
+
+	io.WriteString(pw, "watch -n 0.005 tick a\n")
+	<-ticks
+
+	// the interrupt stops the watch without waiting for a key.
+	d.handleSignal(os.Interrupt)
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("expected the watch to return once interrupted")
+	}
+
+	// the line reader keeps working, the stranded read returns the next line.
+	io.WriteString(pw, "tick c\n")
+	for args := range ticks {
+		if strings.Join(args, " ") == "c" {
+			break
+		}
+	}
+	io.WriteString(pw, "quit\n")
+
+	if err := <-errs; !errors.Is(err, ErrDialogueClosed) {
+		t.Fatalf("recieved unexpected err: %v", err)
+	}
+}
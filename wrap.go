@@ -0,0 +1,163 @@
+package dialogue
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// minWrapWidth is the narrowest column the help text is wrapped to, narrower columns arent wrapped at all.
+const minWrapWidth = 20
+
+// HelpLayout controls the layout of the flag and sub command tables of the default help output.
+type HelpLayout struct {
+	// Padding is the number of spaces between the columns. Defaults to 2.
+	Padding int
+
+	// MinWidth is the minimum width of the first column (flags and command names).
+	MinWidth int
+
+	// MaxWidth optionally limits the width of the first column, the description of wider cells starts on the next line.
+	MaxWidth int
+
+	// Truncate truncates the descriptions which dont fit the help width with an ellipsis instead of wrapping them.
+	Truncate bool
+}
+
+// tableWriter replaces the tabwriter of the help output when wrapping or when a layout is provided: it aligns the
+// "left\tright\n" rows written to it and wraps the right column to the width with a hanging indent.
+type tableWriter struct {
+	b      *strings.Builder
+	width  int
+	layout HelpLayout
+	buf    strings.Builder
+}
+
+func (w *tableWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *tableWriter) Flush() error {
+	rows := strings.Split(strings.TrimSuffix(w.buf.String(), "\n"), "\n")
+	w.buf.Reset()
+
+	// the cells are padded like the tabwriter pads them by default.
+	pad := w.layout.Padding
+	if pad <= 0 {
+		pad = 2
+	}
+
+	col := w.layout.MinWidth
+	for _, row := range rows {
+		left, _, _ := strings.Cut(row, "\t")
+		if n := visibleLen(left); n > col && (w.layout.MaxWidth <= 0 || n <= w.layout.MaxWidth) {
+			col = n
+		}
+	}
+	col += pad
+
+	for _, row := range rows {
+		left, right, ok := strings.Cut(row, "\t")
+		w.b.WriteString(left)
+		if !ok {
+			w.b.WriteByte('\n')
+			continue
+		}
+
+		// cells wider than the column push their description to the next line.
+		if n := visibleLen(left) + pad; n > col {
+			w.b.WriteByte('\n')
+			w.b.WriteString(strings.Repeat(" ", col))
+		} else {
+			w.b.WriteString(strings.Repeat(" ", col-visibleLen(left)))
+		}
+
+		lines := wrapText(right, w.width-col)
+		if w.layout.Truncate {
+			lines = []string{truncateText(right, w.width-col)}
+		}
+
+		for i, line := range lines {
+			if i > 0 {
+				w.b.WriteByte('\n')
+				w.b.WriteString(strings.Repeat(" ", col))
+			}
+			w.b.WriteString(line)
+		}
+		w.b.WriteByte('\n')
+	}
+
+	return nil
+}
+
+// wrapLines wraps every line of s longer than width.
+func wrapLines(s string, width int) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(wrapText(line, width), "\n")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// wrapText breaks s into lines of at most width visible characters at the spaces between words, longer words are left on
+// their own line. s is returned as is if width is narrower than minWrapWidth.
+func wrapText(s string, width int) []string {
+	if width < minWrapWidth || visibleLen(s) <= width {
+		return []string{s}
+	}
+
+	var lines []string
+	var line strings.Builder
+	var n int
+	for _, word := range strings.Fields(s) {
+		wn := visibleLen(word)
+		if n > 0 && n+1+wn > width {
+			lines = append(lines, line.String())
+			line.Reset()
+			n = 0
+		}
+
+		if n > 0 {
+			line.WriteByte(' ')
+			n++
+		}
+		line.WriteString(word)
+		n += wn
+	}
+
+	return append(lines, line.String())
+}
+
+// truncateText shortens s to width characters ending with an ellipsis. s is returned as is if width is narrower than
+// minWrapWidth.
+func truncateText(s string, width int) string {
+	if width < minWrapWidth || visibleLen(s) <= width {
+		return s
+	}
+
+	runes := []rune(s)
+	if len(runes) > width-1 {
+		runes = runes[:width-1]
+	}
+
+	return strings.TrimRight(string(runes), " ") + "…"
+}
+
+// visibleLen returns the number of characters of s excluding the ANSI escape sequences added by the theme.
+func visibleLen(s string) int {
+	var n int
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			if end := strings.IndexByte(s[i:], 'm'); end >= 0 {
+				i += end + 1
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		n++
+	}
+
+	return n
+}